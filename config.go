@@ -2,6 +2,7 @@ package log
 
 import (
 	"os"
+	"strings"
 
 	"github.com/ml444/glog/filter"
 	"github.com/ml444/glog/formatter"
@@ -63,33 +64,86 @@ type Config struct {
 	// tracking ID is the core of the entire call link. Customize this
 	// function to return the Trace ID, and then record it in the log.
 	TraceIDFunc func(entry *message.Entry) string
+
+	// Reopen the files of the file handlers on SIGHUP, for cooperation with
+	// external rotation tools such as logrotate. See also Logger.Reopen.
+	ReopenOnSIGHUP bool
 }
 
 type FileHandlerConfig = handler.FileHandlerConfig
 type StreamHandlerConfig = handler.StreamHandlerConfig
 type SyslogHandlerConfig = handler.SyslogHandlerConfig
+type SyslogFraming = handler.SyslogFraming
+type HTTPHandlerConfig = handler.HTTPHandlerConfig
+type LokiHandlerConfig = handler.LokiHandlerConfig
+type ElasticsearchHandlerConfig = handler.ElasticsearchHandlerConfig
+type OTLPHandlerConfig = handler.OTLPHandlerConfig
+type OTLPEncoding = handler.OTLPEncoding
+type GELFHandlerConfig = handler.GELFHandlerConfig
+type GELFCompression = handler.GELFCompression
+type FluentHandlerConfig = handler.FluentHandlerConfig
+type JournaldHandlerConfig = handler.JournaldHandlerConfig
+type WebhookHandlerConfig = handler.WebhookHandlerConfig
+type WebhookAlert = handler.WebhookAlert
+type WebhookStats = handler.WebhookStats
+type SMTPHandlerConfig = handler.SMTPHandlerConfig
+type SMTPDigest = handler.SMTPDigest
+type FingersCrossedConfig = handler.FingersCrossedConfig
+type FingersCrossedGroup = handler.FingersCrossedGroup
+type FingersCrossedStats = handler.FingersCrossedStats
+type TeeBranchStats = handler.TeeBranchStats
+type RingHandlerConfig = handler.RingHandlerConfig
+type RingHandler = handler.RingHandler
+type RingQuery = handler.RingQuery
+type RingStats = handler.RingStats
+type HTTPEncoding = handler.HTTPEncoding
+type BatchConfig = handler.BatchConfig
+type RetryConfig = handler.RetryConfig
 type BackpressureStrategy = handler.BackpressureStrategy
 type BackpressureConfig = handler.BackpressureConfig
 type BackpressureStats = handler.BackpressureStats
+type SyncPolicy = handler.SyncPolicy
+type DurabilityConfig = handler.DurabilityConfig
+type SyncStats = handler.SyncStats
 
 type BaseFormatterConfig = formatter.BaseFormatterConfig
 type TextFormatterConfig = formatter.TextFormatterConfig
 type JSONFormatterConfig = formatter.JSONFormatterConfig
 type XMLFormatterConfig = formatter.XMLFormatterConfig
+type GELFFormatterConfig = formatter.GELFFormatterConfig
+type RFC5424FormatterConfig = formatter.RFC5424FormatterConfig
 
 type HandlerConfig struct {
-	File   *FileHandlerConfig
-	Stream *StreamHandlerConfig
-	Syslog *SyslogHandlerConfig
+	File          *FileHandlerConfig
+	Stream        *StreamHandlerConfig
+	Syslog        *SyslogHandlerConfig
+	HTTP          *HTTPHandlerConfig
+	Loki          *LokiHandlerConfig
+	Elasticsearch *ElasticsearchHandlerConfig
+	OTLP          *OTLPHandlerConfig
+	GELF          *GELFHandlerConfig
+	Fluent        *FluentHandlerConfig
+	Journald      *JournaldHandlerConfig
+	Webhook       *WebhookHandlerConfig
+	SMTP          *SMTPHandlerConfig
 }
 
 type FormatterConfig struct {
 	Text *TextFormatterConfig
 	JSON *JSONFormatterConfig
 	XML  *XMLFormatterConfig
+	GELF *GELFFormatterConfig
+	// RFC5424 replaces the header the syslog handler builds from its config.
+	RFC5424 *RFC5424FormatterConfig
+}
+
+func (c FormatterConfig) isEmpty() bool {
+	return c.Text == nil && c.JSON == nil && c.XML == nil && c.GELF == nil && c.RFC5424 == nil
 }
 
 type WorkerConfig struct {
+	// Name identifies a branch (see AddBranch) in the errors and stats.
+	Name            string
 	CacheSize       int
 	Level           Level
 	HandlerCfg      HandlerConfig
@@ -98,7 +152,11 @@ type WorkerConfig struct {
 	CustomFilter    filter.IFilter
 	CustomFormatter formatter.IFormatter
 	Backpressure    BackpressureConfig
-	loggerName      string
+	// FingersCrossed wraps the handler in a FingersCrossedHandler.
+	FingersCrossed *FingersCrossedConfig
+	// Branches replace the handler of the worker with a TeeHandler, see AddBranch.
+	Branches   []*WorkerConfig
+	loggerName string
 }
 
 func NewWorkerConfig(level Level, size int) *WorkerConfig {
@@ -140,6 +198,51 @@ func (w *WorkerConfig) SetSyslogHandlerConfig(c *SyslogHandlerConfig) *WorkerCon
 	return w
 }
 
+func (w *WorkerConfig) SetHTTPHandlerConfig(c *HTTPHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.HTTP = c
+	return w
+}
+
+func (w *WorkerConfig) SetLokiHandlerConfig(c *LokiHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.Loki = c
+	return w
+}
+
+func (w *WorkerConfig) SetElasticsearchHandlerConfig(c *ElasticsearchHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.Elasticsearch = c
+	return w
+}
+
+func (w *WorkerConfig) SetOTLPHandlerConfig(c *OTLPHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.OTLP = c
+	return w
+}
+
+func (w *WorkerConfig) SetGELFHandlerConfig(c *GELFHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.GELF = c
+	return w
+}
+
+func (w *WorkerConfig) SetFluentHandlerConfig(c *FluentHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.Fluent = c
+	return w
+}
+
+func (w *WorkerConfig) SetJournaldHandlerConfig(c *JournaldHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.Journald = c
+	return w
+}
+
+func (w *WorkerConfig) SetWebhookHandlerConfig(c *WebhookHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.Webhook = c
+	return w
+}
+
+func (w *WorkerConfig) SetSMTPHandlerConfig(c *SMTPHandlerConfig) *WorkerConfig {
+	w.HandlerCfg.SMTP = c
+	return w
+}
+
 func (w *WorkerConfig) SetTextFormatterConfig(c *TextFormatterConfig) *WorkerConfig {
 	w.FormatterCfg.Text = c
 	return w
@@ -155,6 +258,34 @@ func (w *WorkerConfig) SetXMLFormatterConfig(c *XMLFormatterConfig) *WorkerConfi
 	return w
 }
 
+func (w *WorkerConfig) SetGELFFormatterConfig(c *GELFFormatterConfig) *WorkerConfig {
+	w.FormatterCfg.GELF = c
+	return w
+}
+
+func (w *WorkerConfig) SetRFC5424FormatterConfig(c *RFC5424FormatterConfig) *WorkerConfig {
+	w.FormatterCfg.RFC5424 = c
+	return w
+}
+
+// AddBranch makes the worker send each entry to several handlers, those of
+// its branches, instead of its own. A branch is configured like a worker:
+// its handler and formatter configs (or custom ones) make its output, while
+// its Level and CustomFilter are its routing rule. CacheSize and Backpressure
+// only apply to the worker. A failing branch does not affect the others.
+func (w *WorkerConfig) AddBranch(b *WorkerConfig) *WorkerConfig {
+	w.Branches = append(w.Branches, b)
+	return w
+}
+
+// SetFingersCrossedConfig buffers the entries below cfg.PassLevel until one
+// at cfg.TriggerLevel comes, see handler.FingersCrossedHandler. The worker
+// Level must be low enough to let them through.
+func (w *WorkerConfig) SetFingersCrossedConfig(c *FingersCrossedConfig) *WorkerConfig {
+	w.FingersCrossed = c
+	return w
+}
+
 func (w *WorkerConfig) SetHandler(h handler.IHandler) *WorkerConfig {
 	w.CustomHandler = h
 	return w
@@ -208,94 +339,192 @@ func (c *Config) Check() {
 			workerCfg.Level = PrintLevel
 		}
 		workerCfg.Backpressure = workerCfg.Backpressure.Normalize(handler.BackpressureStrategyBlock)
-		if workerCfg.CustomHandler != nil {
-			continue
+		c.checkOutput(workerCfg)
+	}
+	c.WorkerConfigList = validWorkerConfigs
+}
+
+// checkOutput fills the defaults of the handler and formatter configs of a
+// worker or a branch.
+func (c *Config) checkOutput(w *WorkerConfig) {
+	for _, b := range w.Branches {
+		b.loggerName = c.LoggerName
+		c.checkOutput(b)
+	}
+	if w.CustomHandler != nil {
+		return
+	}
+	if w.CustomFormatter == nil && w.FormatterCfg.isEmpty() {
+		if w.HandlerCfg.Elasticsearch != nil {
+			w.FormatterCfg.JSON = NewDefaultJSONFormatterConfig()
 		}
-		if cc := workerCfg.FormatterCfg.Text; cc != nil {
-			if cc.LoggerName == "" {
-				cc.LoggerName = c.LoggerName
-			}
-			if cc.TimeLayout == "" {
-				cc.TimeLayout = c.TimeLayout
-			}
-			if c.EnableColorRender != nil && cc.EnableColor == false {
-				cc.EnableColor = *c.EnableColorRender
-			}
+		if w.HandlerCfg.GELF != nil {
+			w.FormatterCfg.GELF = NewDefaultGELFFormatterConfig()
 		}
-		if cc := workerCfg.FormatterCfg.JSON; cc != nil {
-			if cc.LoggerName == "" {
-				cc.LoggerName = c.LoggerName
-			}
-			if cc.TimeLayout == "" {
-				cc.TimeLayout = c.TimeLayout
-			}
+	}
+	if cc := w.FormatterCfg.Text; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
 		}
-		if cc := workerCfg.FormatterCfg.XML; cc != nil {
-			if cc.LoggerName == "" {
-				cc.LoggerName = c.LoggerName
-			}
-			if cc.TimeLayout == "" {
-				cc.TimeLayout = c.TimeLayout
-			}
+		if cc.TimeLayout == "" {
+			cc.TimeLayout = c.TimeLayout
 		}
-		if cc := workerCfg.HandlerCfg.File; cc != nil {
-			if cc.FileName == "" {
-				cc.FileName = c.LoggerName
-			}
-			if cc.FileDir == "" {
-				curDir, err := os.Getwd()
-				if err != nil {
-					println(err.Error())
-				} else {
-					cc.FileDir = curDir
-				}
-			}
-			if cc.RotatorType == 0 {
-				cc.RotatorType = handler.FileRotatorTypeTimeAndSize
-			}
-			if cc.MaxFileSize == 0 {
-				cc.MaxFileSize = defaultMaxFileSize
-			}
-			if cc.BulkWriteSize == 0 {
-				cc.BulkWriteSize = 10485760
-			}
-			if cc.BufferSize == 0 {
-				cc.BufferSize = 10000
-			}
-			cc.Backpressure = cc.Backpressure.Normalize(handler.BackpressureStrategyDrop)
-			if cc.Interval == 0 {
-				cc.Interval = 60 * 60
-			}
-			if cc.TimeSuffixFmt == "" {
-				cc.TimeSuffixFmt = "2006010215"
-			}
-			if cc.ReMatch == "" {
-				cc.ReMatch = `^\d{4}\d{2}\d{2}\d{2}(\.\w+)?$`
-			}
-			if cc.FileSuffix == "" {
-				cc.FileSuffix = "log"
-			}
-			if cc.ErrCallback == nil {
-				cc.ErrCallback = c.OnError
+		if c.EnableColorRender != nil && cc.EnableColor == false {
+			cc.EnableColor = *c.EnableColorRender
+		}
+	}
+	if cc := w.FormatterCfg.JSON; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+		if cc.TimeLayout == "" {
+			cc.TimeLayout = c.TimeLayout
+		}
+	}
+	if cc := w.FormatterCfg.XML; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+		if cc.TimeLayout == "" {
+			cc.TimeLayout = c.TimeLayout
+		}
+	}
+	if cc := w.FormatterCfg.GELF; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+	}
+	if cc := w.FormatterCfg.RFC5424; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+	}
+	if cc := w.HandlerCfg.File; cc != nil {
+		if cc.FileName == "" {
+			cc.FileName = c.LoggerName
+		}
+		if cc.FileDir == "" {
+			curDir, err := os.Getwd()
+			if err != nil {
+				println(err.Error())
+			} else {
+				cc.FileDir = curDir
 			}
 		}
+		if cc.RotatorType == 0 {
+			cc.RotatorType = handler.FileRotatorTypeTimeAndSize
+		}
+		if cc.MaxFileSize == 0 {
+			cc.MaxFileSize = defaultMaxFileSize
+		}
+		if cc.BulkWriteSize == 0 {
+			cc.BulkWriteSize = 10485760
+		}
+		if cc.BufferSize == 0 {
+			cc.BufferSize = 10000
+		}
+		cc.Backpressure = cc.Backpressure.Normalize(handler.BackpressureStrategyDrop)
+		if cc.Interval == 0 {
+			cc.Interval = 60 * 60
+		}
+		if cc.TimeSuffixFmt == "" {
+			cc.TimeSuffixFmt = "2006010215"
+		}
+		if cc.ReMatch == "" {
+			cc.ReMatch = `^\d{4}\d{2}\d{2}\d{2}(\.\w+)?$`
+		}
+		if cc.FileSuffix == "" {
+			cc.FileSuffix = "log"
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
 
-		if cc := workerCfg.HandlerCfg.Stream; cc != nil {
-			if cc.Streamer == nil {
-				cc.Streamer = os.Stdout
-			}
+	if cc := w.HandlerCfg.Stream; cc != nil {
+		if cc.Streamer == nil {
+			cc.Streamer = os.Stdout
 		}
-		if cc := workerCfg.HandlerCfg.Syslog; cc != nil {
-			if cc.Network == "" {
-				cc.Network = "udp"
-			}
-			if cc.Address == "" {
-				cc.Address = "localhost:514"
-			}
-			if cc.Tag == "" {
-				cc.Tag = c.LoggerName
-			}
+	}
+	if cc := w.HandlerCfg.Syslog; cc != nil {
+		if cc.Network == "" {
+			cc.Network = "udp"
+		}
+		if cc.Address == "" {
+			cc.Address = "localhost:514"
+		}
+		if cc.Tag == "" {
+			cc.Tag = c.LoggerName
+		}
+	}
+	if cc := w.HandlerCfg.HTTP; cc != nil {
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.Loki; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.Elasticsearch; cc != nil {
+		if cc.Index == "" {
+			// Index names must be lowercase.
+			cc.Index = strings.ToLower(c.LoggerName) + "-{2006.01.02}"
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.OTLP; cc != nil {
+		if cc.ServiceName == "" {
+			cc.ServiceName = c.LoggerName
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.GELF; cc != nil {
+		if cc.Network == "" {
+			cc.Network = "udp"
+		}
+		if cc.Address == "" {
+			cc.Address = "localhost:12201"
+		}
+	}
+	if cc := w.HandlerCfg.Fluent; cc != nil {
+		if cc.Address == "" {
+			cc.Address = "localhost:24224"
+		}
+		if cc.Tag == "" {
+			cc.Tag = c.LoggerName
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.Journald; cc != nil {
+		if cc.Identifier == "" {
+			cc.Identifier = c.LoggerName
+		}
+	}
+	if cc := w.HandlerCfg.Webhook; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
+		}
+	}
+	if cc := w.HandlerCfg.SMTP; cc != nil {
+		if cc.LoggerName == "" {
+			cc.LoggerName = c.LoggerName
+		}
+		if cc.ErrCallback == nil {
+			cc.ErrCallback = c.OnError
 		}
 	}
-	c.WorkerConfigList = validWorkerConfigs
 }
@@ -0,0 +1,145 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ml444/glog/message"
+)
+
+// Keys of the built-in context extractors. The value found for FieldTraceID is
+// stored in Entry.TraceID, all the others become entry fields.
+const (
+	FieldTraceID = "trace_id"
+	FieldSpanID  = "span_id"
+	FieldTenant  = "tenant"
+	FieldUser    = "user"
+)
+
+// ContextExtractor returns the value it finds in ctx; ok is false when there is none.
+// The logging methods without a context pass context.Background().
+type ContextExtractor func(ctx context.Context) (value interface{}, ok bool)
+
+type contextExtractor struct {
+	key string
+	fn  ContextExtractor
+}
+
+type ctxKey int
+
+const (
+	ctxKeyLogger ctxKey = iota
+	ctxKeyTraceID
+	ctxKeySpanID
+	ctxKeyTenant
+	ctxKeyUser
+)
+
+var (
+	extractorsMu sync.Mutex
+	// extractors holds a []contextExtractor, replaced as a whole on every change.
+	extractors atomic.Value
+)
+
+func init() {
+	extractors.Store([]contextExtractor{
+		{key: FieldTraceID, fn: valueExtractor(ctxKeyTraceID)},
+		{key: FieldSpanID, fn: valueExtractor(ctxKeySpanID)},
+		{key: FieldTenant, fn: valueExtractor(ctxKeyTenant)},
+		{key: FieldUser, fn: valueExtractor(ctxKeyUser)},
+	})
+}
+
+func valueExtractor(k ctxKey) ContextExtractor {
+	return func(ctx context.Context) (interface{}, bool) {
+		v := ctx.Value(k)
+		return v, v != nil
+	}
+}
+
+// RegisterContextExtractor sets the extractor of key, replacing the existing one
+// (including the built-in ones). A nil fn removes the extractor of key.
+func RegisterContextExtractor(key string, fn ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	old := extractors.Load().([]contextExtractor)
+	list := make([]contextExtractor, 0, len(old)+1)
+	replaced := false
+	for _, ex := range old {
+		if ex.key != key {
+			list = append(list, ex)
+			continue
+		}
+		replaced = true
+		if fn != nil {
+			list = append(list, contextExtractor{key: key, fn: fn})
+		}
+	}
+	if !replaced && fn != nil {
+		list = append(list, contextExtractor{key: key, fn: fn})
+	}
+	extractors.Store(list)
+}
+
+// ContextFields runs the registered extractors against ctx.
+func ContextFields(ctx context.Context) (traceID string, fields message.Fields) {
+	if ctx == nil {
+		return "", nil
+	}
+	for _, ex := range extractors.Load().([]contextExtractor) {
+		v, ok := ex.fn(ctx)
+		if !ok {
+			continue
+		}
+		if ex.key == FieldTraceID {
+			traceID = fmt.Sprint(v)
+			continue
+		}
+		fields = append(fields, message.Field{Key: ex.key, Value: v})
+	}
+	return traceID, fields
+}
+
+// applyContext adds the values extracted from ctx to entry.
+func applyContext(ctx context.Context, entry *message.Entry) {
+	traceID, fields := ContextFields(ctx)
+	if traceID != "" {
+		entry.TraceID = traceID
+	}
+	if len(fields) > 0 {
+		entry.Fields = entry.Fields.Merge(fields)
+	}
+}
+
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, ctxKeyTraceID, traceID)
+}
+
+func ContextWithSpanID(ctx context.Context, spanID string) context.Context {
+	return context.WithValue(ctx, ctxKeySpanID, spanID)
+}
+
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, ctxKeyTenant, tenant)
+}
+
+func ContextWithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, ctxKeyUser, user)
+}
+
+// NewContext returns a copy of ctx carrying l, e.g. a logger derived with With.
+func NewContext(ctx context.Context, l ILogger) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger, l)
+}
+
+// FromContext returns the logger stored by NewContext, or the package logger.
+func FromContext(ctx context.Context) ILogger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKeyLogger).(ILogger); ok && l != nil {
+			return l
+		}
+	}
+	return logger
+}
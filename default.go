@@ -2,7 +2,9 @@ package log
 
 import (
 	"os"
+	"time"
 
+	"github.com/ml444/glog/filter"
 	"github.com/ml444/glog/formatter"
 	"github.com/ml444/glog/handler"
 )
@@ -20,6 +22,7 @@ const (
 	FileRotatorTypeTime        RotatorType = 1
 	FileRotatorTypeSize        RotatorType = 2
 	FileRotatorTypeTimeAndSize RotatorType = 3
+	FileRotatorTypeExternal    RotatorType = 4
 )
 const (
 	BackpressureStrategyUnset   BackpressureStrategy = handler.BackpressureStrategyUnset
@@ -27,15 +30,81 @@ const (
 	BackpressureStrategyDrop    BackpressureStrategy = handler.BackpressureStrategyDrop
 	BackpressureStrategyTimeout BackpressureStrategy = handler.BackpressureStrategyTimeout
 	BackpressureStrategySample  BackpressureStrategy = handler.BackpressureStrategySample
+	BackpressureStrategySpill   BackpressureStrategy = handler.BackpressureStrategySpill
 )
 
 func NewBackpressureConfig(strategy BackpressureStrategy) BackpressureConfig {
 	return handler.NewBackpressureConfig(strategy)
 }
 
+const (
+	SyncPolicyNever    SyncPolicy = handler.SyncPolicyNever
+	SyncPolicyBytes    SyncPolicy = handler.SyncPolicyBytes
+	SyncPolicyInterval SyncPolicy = handler.SyncPolicyInterval
+	SyncPolicyLevel    SyncPolicy = handler.SyncPolicyLevel
+)
+
+func NewDurabilityConfig(policy SyncPolicy) DurabilityConfig {
+	return handler.NewDurabilityConfig(policy)
+}
+
+const (
+	HTTPEncodingNDJSON    HTTPEncoding = handler.HTTPEncodingNDJSON
+	HTTPEncodingJSONArray HTTPEncoding = handler.HTTPEncodingJSONArray
+)
+
+const (
+	FingersCrossedByRoutine FingersCrossedGroup = handler.FingersCrossedByRoutine
+	FingersCrossedByTrace   FingersCrossedGroup = handler.FingersCrossedByTrace
+)
+
+const (
+	WebhookTemplateSlack = handler.WebhookTemplateSlack
+	WebhookTemplateTeams = handler.WebhookTemplateTeams
+)
+
+const (
+	SyslogFramingAuto           SyslogFraming = handler.SyslogFramingAuto
+	SyslogFramingOctetCounting  SyslogFraming = handler.SyslogFramingOctetCounting
+	SyslogFramingNonTransparent SyslogFraming = handler.SyslogFramingNonTransparent
+)
+
+const (
+	GELFCompressionNone GELFCompression = handler.GELFCompressionNone
+	GELFCompressionGzip GELFCompression = handler.GELFCompressionGzip
+	GELFCompressionZlib GELFCompression = handler.GELFCompressionZlib
+)
+
+const (
+	OTLPEncodingProtobuf OTLPEncoding = handler.OTLPEncodingProtobuf
+	OTLPEncodingJSON     OTLPEncoding = handler.OTLPEncodingJSON
+)
+
+// NewBranchConfig is a branch of a worker (see WorkerConfig.AddBranch) that
+// receives the entries at lvl or above.
+func NewBranchConfig(name string, lvl Level) *WorkerConfig {
+	return &WorkerConfig{Name: name, Level: lvl}
+}
+
+// NewFingersCrossedConfig buffers the entries below InfoLevel, 100 per
+// goroutine for at most a minute, until one at trigger or above comes.
+func NewFingersCrossedConfig(trigger Level) *FingersCrossedConfig {
+	return handler.NewFingersCrossedConfig(trigger)
+}
+
+func NewBatchConfig(maxCount, maxBytes int, maxAge time.Duration) BatchConfig {
+	return handler.NewBatchConfig(maxCount, maxBytes, maxAge)
+}
+
+func NewRetryConfig(maxAttempts int, initial, max time.Duration) RetryConfig {
+	return handler.NewRetryConfig(maxAttempts, initial, max)
+}
+
 var (
 	ErrBackpressureDropped = handler.ErrBackpressureDropped
 	ErrBackpressureTimeout = handler.ErrBackpressureTimeout
+	ErrSpillFull           = handler.ErrSpillFull
+	ErrSpillDirInUse       = handler.ErrSpillDirInUse
 )
 
 const (
@@ -117,6 +186,127 @@ func NewDefaultFileHandlerConfig(dir string) *FileHandlerConfig {
 	}
 }
 
+// NewDefaultHTTPHandlerConfig posts NDJSON batches of up to 100 entries or 1MB,
+// at least every second, retrying 5 times.
+func NewDefaultHTTPHandlerConfig(url string) *HTTPHandlerConfig {
+	return &HTTPHandlerConfig{
+		URL:      url,
+		Encoding: HTTPEncodingNDJSON,
+		Timeout:  10 * time.Second,
+		Batch:    handler.NewBatchConfig(100, 1<<20, time.Second).WithQueueSize(10000),
+		Retry:    handler.NewRetryConfig(5, 100*time.Millisecond, 10*time.Second),
+	}
+}
+
+func NewDefaultLokiHandlerConfig(url string) *LokiHandlerConfig {
+	return &LokiHandlerConfig{
+		URL:     url,
+		Timeout: 10 * time.Second,
+		Batch:   handler.NewBatchConfig(1000, 1<<20, time.Second).WithQueueSize(10000),
+		Retry:   handler.NewRetryConfig(5, 100*time.Millisecond, 10*time.Second),
+	}
+}
+
+// NewDefaultElasticsearchHandlerConfig indexes into daily indices named after
+// the logger, e.g. "app-2024.05.17", adding "@timestamp" to the documents.
+func NewDefaultElasticsearchHandlerConfig(url string) *ElasticsearchHandlerConfig {
+	return &ElasticsearchHandlerConfig{
+		URL:            url,
+		TimestampField: "@timestamp",
+		Timeout:        10 * time.Second,
+		Batch:          handler.NewBatchConfig(1000, 5<<20, time.Second).WithQueueSize(10000),
+		Retry:          handler.NewRetryConfig(5, 100*time.Millisecond, 10*time.Second),
+	}
+}
+
+func NewDefaultOTLPHandlerConfig(url string) *OTLPHandlerConfig {
+	return &OTLPHandlerConfig{
+		URL:      url,
+		Encoding: OTLPEncodingProtobuf,
+		Timeout:  10 * time.Second,
+		Batch:    handler.NewBatchConfig(512, 4<<20, time.Second).WithQueueSize(10000),
+		Retry:    handler.NewRetryConfig(5, 100*time.Millisecond, 10*time.Second),
+	}
+}
+
+// NewDefaultGELFHandlerConfig sends UDP datagrams of up to 1420 bytes, gzip
+// compressing the messages from 1KB.
+func NewDefaultGELFHandlerConfig(address string) *GELFHandlerConfig {
+	return &GELFHandlerConfig{
+		Network:              "udp",
+		Address:              address,
+		Timeout:              5 * time.Second,
+		ChunkSize:            1420,
+		Compression:          GELFCompressionGzip,
+		CompressionThreshold: 1024,
+	}
+}
+
+// NewDefaultFluentHandlerConfig forwards batches of up to 1000 entries or
+// 1MB, at least every second, waiting for the acks.
+func NewDefaultFluentHandlerConfig(address string) *FluentHandlerConfig {
+	return &FluentHandlerConfig{
+		Network:    "tcp",
+		Address:    address,
+		RequireAck: true,
+		Timeout:    10 * time.Second,
+		Batch:      handler.NewBatchConfig(1000, 1<<20, time.Second).WithQueueSize(10000),
+		Retry:      handler.NewRetryConfig(8, 100*time.Millisecond, 30*time.Second),
+	}
+}
+
+// NewDefaultJournaldHandlerConfig writes to the systemd journal socket, with
+// the logger name as SYSLOG_IDENTIFIER.
+func NewDefaultJournaldHandlerConfig() *JournaldHandlerConfig {
+	return &JournaldHandlerConfig{
+		SocketPath: handler.DefaultJournalSocket,
+	}
+}
+
+// NewDefaultWebhookHandlerConfig posts Slack compatible alerts, grouping the
+// repeats of an alert for a minute and sending at most 10 alerts a minute.
+func NewDefaultWebhookHandlerConfig(url string) *WebhookHandlerConfig {
+	return &WebhookHandlerConfig{
+		URL:          url,
+		Template:     WebhookTemplateSlack,
+		GroupWindow:  time.Minute,
+		MaxPerMinute: 10,
+		Timeout:      10 * time.Second,
+		Retry:        handler.NewRetryConfig(5, 100*time.Millisecond, 10*time.Second),
+	}
+}
+
+// NewDefaultSMTPHandlerConfig mails digests of up to 500 entries or 1MB, at
+// least every 5 minutes, using STARTTLS when the relay offers it.
+func NewDefaultSMTPHandlerConfig(address, from string, to ...string) *SMTPHandlerConfig {
+	return &SMTPHandlerConfig{
+		Address: address,
+		From:    from,
+		To:      to,
+		Subject: handler.DefaultSMTPSubject,
+		Timeout: 30 * time.Second,
+		Batch:   handler.NewBatchConfig(500, 1<<20, 5*time.Minute).WithQueueSize(10000),
+		Retry:   handler.NewRetryConfig(5, time.Second, time.Minute),
+	}
+}
+
+func NewDefaultRingHandlerConfig() *RingHandlerConfig {
+	return &RingHandlerConfig{
+		MaxEntries:       5000,
+		MaxBytes:         4 << 20,
+		SubscriberBuffer: 256,
+	}
+}
+
+// NewRingHandler keeps the last entries in memory. Use it as the handler of
+// a worker or of a branch, and mount HTTPHandler to inspect the entries:
+//
+//	ring, _ := log.NewRingHandler(log.NewDefaultRingHandlerConfig())
+//	mux.Handle("/debug/logs", ring.HTTPHandler())
+func NewRingHandler(cfg *RingHandlerConfig) (*RingHandler, error) {
+	return handler.NewRingHandler(cfg, nil, nil)
+}
+
 func NewDefaultTextFormatterConfig() *TextFormatterConfig {
 	return &TextFormatterConfig{
 		BaseFormatterConfig: BaseFormatterConfig{
@@ -139,6 +329,19 @@ func NewDefaultJSONFormatterConfig() *JSONFormatterConfig {
 	}
 }
 
+func NewDefaultGELFFormatterConfig() *GELFFormatterConfig {
+	return &GELFFormatterConfig{}
+}
+
+// NewDefaultRFC5424FormatterConfig uses the user facility, the logger name as
+// APP-NAME and the bare message as MSG.
+func NewDefaultRFC5424FormatterConfig() *RFC5424FormatterConfig {
+	return &RFC5424FormatterConfig{
+		Facility: formatter.DefaultSyslogFacility,
+		SDID:     formatter.DefaultRFC5424SDID,
+	}
+}
+
 func NewDefaultBaseFormatterConfig() BaseFormatterConfig {
 	return BaseFormatterConfig{
 		TimeLayout:      DefaultDateTimeFormat,
@@ -151,7 +354,51 @@ func NewDefaultBaseFormatterConfig() BaseFormatterConfig {
 	}
 }
 
-func newHandler(workerCfg *WorkerConfig) (handler.IHandler, error) {
+func newHandler(workerCfg *WorkerConfig) (h handler.IHandler, err error) {
+	if len(workerCfg.Branches) > 0 {
+		h, err = newTeeHandler(workerCfg.Branches)
+	} else {
+		h, err = newOutputHandler(workerCfg)
+	}
+	if err != nil || workerCfg.FingersCrossed == nil {
+		return h, err
+	}
+	return handler.NewFingersCrossedHandler(workerCfg.FingersCrossed, h)
+}
+
+func newTeeHandler(branchCfgs []*WorkerConfig) (handler.IHandler, error) {
+	branches := make([]handler.TeeBranch, 0, len(branchCfgs))
+	for _, cfg := range branchCfgs {
+		// The filter routes the entries to the branch, the branch handler
+		// does not need to apply it again.
+		output := *cfg
+		output.CustomFilter = nil
+		h, err := newHandler(&output)
+		if err != nil {
+			for _, b := range branches {
+				_ = b.Handler.Close()
+			}
+			return nil, err
+		}
+		var rules []filter.IFilter
+		if cfg.Level > NoneLevel {
+			rules = append(rules, filter.LevelAtLeast(cfg.Level))
+		}
+		if cfg.CustomFilter != nil {
+			rules = append(rules, cfg.CustomFilter)
+		}
+		branch := handler.TeeBranch{Name: cfg.Name, Handler: h}
+		if len(rules) == 1 {
+			branch.Filter = rules[0]
+		} else if len(rules) > 1 {
+			branch.Filter = filter.All(rules...)
+		}
+		branches = append(branches, branch)
+	}
+	return handler.NewTeeHandler(branches...)
+}
+
+func newOutputHandler(workerCfg *WorkerConfig) (handler.IHandler, error) {
 	if workerCfg.CustomHandler != nil {
 		return workerCfg.CustomHandler, nil
 	}
@@ -166,9 +413,42 @@ func newHandler(workerCfg *WorkerConfig) (handler.IHandler, error) {
 	if handlerCfg.Stream != nil {
 		return handler.NewStreamHandler(handlerCfg.Stream, fm, workerCfg.CustomFilter)
 	}
+	if handlerCfg.Syslog != nil || handlerCfg.Journald != nil {
+		if workerCfg.CustomFormatter == nil && workerCfg.FormatterCfg.isEmpty() {
+			// The message is sent bare, the level, caller, fields, etc. apart.
+			fm = nil
+		}
+	}
 	if handlerCfg.Syslog != nil {
 		return handler.NewSyslogHandler(handlerCfg.Syslog, fm, workerCfg.CustomFilter)
 	}
+	if handlerCfg.HTTP != nil {
+		return handler.NewHTTPHandler(handlerCfg.HTTP, fm, workerCfg.CustomFilter)
+	}
+	if handlerCfg.Loki != nil {
+		return handler.NewLokiHandler(handlerCfg.Loki, fm, workerCfg.CustomFilter)
+	}
+	if handlerCfg.Elasticsearch != nil {
+		return handler.NewElasticsearchHandler(handlerCfg.Elasticsearch, fm, workerCfg.CustomFilter)
+	}
+	if handlerCfg.OTLP != nil {
+		return handler.NewOTLPHandler(handlerCfg.OTLP, workerCfg.CustomFilter)
+	}
+	if handlerCfg.GELF != nil {
+		return handler.NewGELFHandler(handlerCfg.GELF, fm, workerCfg.CustomFilter)
+	}
+	if handlerCfg.Fluent != nil {
+		return handler.NewFluentHandler(handlerCfg.Fluent, workerCfg.CustomFilter)
+	}
+	if handlerCfg.Journald != nil {
+		return handler.NewJournaldHandler(handlerCfg.Journald, fm, workerCfg.CustomFilter)
+	}
+	if handlerCfg.Webhook != nil {
+		return handler.NewWebhookHandler(handlerCfg.Webhook, workerCfg.CustomFilter)
+	}
+	if handlerCfg.SMTP != nil {
+		return handler.NewSMTPHandler(handlerCfg.SMTP, fm, workerCfg.CustomFilter)
+	}
 	return handler.NewStdoutHandler(fm, workerCfg.CustomFilter)
 }
 
@@ -182,6 +462,12 @@ func newFormatter(formatterCfg FormatterConfig, loggerName string) formatter.IFo
 	if formatterCfg.XML != nil {
 		return formatter.NewXMLFormatter(*formatterCfg.XML)
 	}
+	if formatterCfg.GELF != nil {
+		return formatter.NewGELFFormatter(*formatterCfg.GELF)
+	}
+	if formatterCfg.RFC5424 != nil {
+		return formatter.NewRFC5424Formatter(*formatterCfg.RFC5424)
+	}
 	return formatter.NewTextFormatter(TextFormatterConfig{
 		BaseFormatterConfig: BaseFormatterConfig{
 			LoggerName: loggerName,
@@ -1,8 +1,12 @@
 package log
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"sync/atomic"
 
 	"github.com/ml444/glog/filter"
@@ -16,6 +20,25 @@ type IEngine interface {
 	Send(entry *message.Entry)
 }
 
+// IEngineFlusher is implemented by engines that can flush and sync their handlers while running.
+type IEngineFlusher interface {
+	Flush(ctx context.Context) error
+	Sync(ctx context.Context) error
+}
+
+// IEngineReopener is implemented by engines whose handlers can reopen their files.
+type IEngineReopener interface {
+	Reopen() error
+}
+
+// ErrEngineUnsupported is returned by Logger.Flush, Sync and Reopen when the engine does not implement them.
+var ErrEngineUnsupported = errors.New("operation not supported by the engine")
+
+var (
+	_ IEngineFlusher  = (*ChannelEngine)(nil)
+	_ IEngineReopener = (*ChannelEngine)(nil)
+)
+
 type Worker struct {
 	handler        handler.IHandler
 	entryChan      chan *message.Entry
@@ -24,34 +47,115 @@ type Worker struct {
 	backpressure   BackpressureConfig
 	stats          BackpressureCounter
 	stopChan       chan struct{}
+	flushChan      chan workerFlushRequest
 	// runDone is closed when Run returns after stopChan is closed and entryChan is drained.
 	runDone chan struct{}
+	// spill holds the overflow of BackpressureStrategySpill, replay moves it
+	// back into entryChan and closes replayDone when it stops.
+	spill      *handler.SpillQueue
+	replayDone chan struct{}
+}
+
+// workerFlushRequest asks Run to drain entryChan and then flush (or sync) the handler.
+type workerFlushRequest struct {
+	ctx  context.Context
+	sync bool
+	done chan error
 }
 
 func (w *Worker) Run() {
 	defer close(w.runDone)
+	if w.spill != nil {
+		go w.replay()
+	}
 	for {
 		select {
 		case entry := <-w.entryChan:
 			w.emit(entry)
+		case req := <-w.flushChan:
+			w.drain()
+			req.done <- w.flushHandler(req.ctx, req.sync)
 		case <-w.stopChan:
 			w.drain()
+			if err := w.spill.Close(); err != nil {
+				w.onError(nil, err)
+			}
 			return
 		}
 	}
 }
 
+// drain emits everything queued in entryChan and the spill queue.
 func (w *Worker) drain() {
 	for {
 		select {
 		case entry := <-w.entryChan:
 			w.emit(entry)
+			continue
 		default:
+		}
+		if w.spill.Len() == 0 {
 			return
 		}
+		select {
+		case entry := <-w.entryChan:
+			w.emit(entry)
+		case <-w.replayDone:
+			// Stopping: emit the rest directly.
+			w.spill.Drain(func(rec []byte) {
+				w.stats.AddReplayed()
+				w.emitSpilled(rec)
+			}, w.spillError)
+		}
 	}
 }
 
+// replay moves the spilled entries back into entryChan in order.
+func (w *Worker) replay() {
+	defer close(w.replayDone)
+	w.spill.Replay(w.stopChan, func(rec []byte) bool {
+		entry, err := message.UnmarshalEntry(rec)
+		if err != nil {
+			w.stats.AddDiscarded()
+			w.spillError(err)
+			return true
+		}
+		select {
+		case w.entryChan <- entry:
+			w.stats.AddReplayed()
+			return true
+		case <-w.stopChan:
+			return false
+		}
+	}, w.spillError)
+}
+
+func (w *Worker) emitSpilled(rec []byte) {
+	entry, err := message.UnmarshalEntry(rec)
+	if err != nil {
+		w.stats.AddDiscarded()
+		w.spillError(err)
+		return
+	}
+	w.emit(entry)
+}
+
+func (w *Worker) spillError(err error) {
+	w.onError(nil, err)
+}
+
+func (w *Worker) flushHandler(ctx context.Context, sync bool) error {
+	if sync {
+		if s, ok := w.handler.(handler.ISyncer); ok {
+			return s.Sync()
+		}
+	}
+	if f, ok := w.handler.(handler.IFlusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
 func (w *Worker) emit(entry *message.Entry) {
 	if entry.Level < w.levelThreshold {
 		return
@@ -63,15 +167,22 @@ func (w *Worker) emit(entry *message.Entry) {
 }
 
 type ChannelEngine struct {
-	workers []*Worker
-	onError func(v interface{}, err error)
-	stop    uint32
+	workers        []*Worker
+	onError        func(v interface{}, err error)
+	stop           uint32
+	reopenOnSIGHUP bool
+	reopenSignals  chan os.Signal
+	reopenDone     chan struct{}
 }
 
 type WorkerStats struct {
 	Level               Level
 	QueueBackpressure   BackpressureStats
 	HandlerBackpressure BackpressureStats
+	HandlerSync         SyncStats
+	FingersCrossed      FingersCrossedStats
+	Branches            []TeeBranchStats
+	Webhook             WebhookStats
 }
 
 type LoggerStats struct {
@@ -85,35 +196,109 @@ func NewChannelEngine(cfg *Config) (*ChannelEngine, error) {
 		}
 	}
 	var workers []*Worker
-	for _, workerCfg := range cfg.WorkerConfigList {
+	for i, workerCfg := range cfg.WorkerConfigList {
 		h, err := newHandler(workerCfg)
 		if err != nil {
 			return nil, err
 		}
-		workers = append(workers, &Worker{
+		w := &Worker{
 			handler:        h,
 			entryChan:      make(chan *message.Entry, workerCfg.CacheSize),
 			onError:        cfg.OnError,
 			levelThreshold: workerCfg.Level,
 			backpressure:   workerCfg.Backpressure,
 			stopChan:       make(chan struct{}),
+			flushChan:      make(chan workerFlushRequest),
 			runDone:        make(chan struct{}),
-		})
+		}
+		if w.backpressure.Strategy == BackpressureStrategySpill {
+			dir := w.backpressure.SpillDir
+			if dir == "" {
+				dir = defaultSpillDir(cfg.LoggerName, i)
+			}
+			w.spill, err = handler.OpenSpillQueue(dir, w.backpressure.SpillMaxBytes, w.backpressure.SpillSegmentSize)
+			if err != nil {
+				// Release the directories of the other workers.
+				for _, prev := range workers {
+					_ = prev.spill.Close()
+				}
+				return nil, err
+			}
+			w.replayDone = make(chan struct{})
+		}
+		workers = append(workers, w)
 	}
 	if len(workers) == 0 {
 		return nil, errors.New("no Worker is configured")
 	}
 
 	return &ChannelEngine{
-		workers: workers,
-		onError: cfg.OnError,
+		workers:        workers,
+		onError:        cfg.OnError,
+		reopenOnSIGHUP: cfg.ReopenOnSIGHUP,
 	}, nil
 }
 
+// defaultSpillDir is stable across restarts so that a crashed process finds its
+// unreplayed entries again. The directory is locked while in use: a second
+// process with the same logger name fails with ErrSpillDirInUse and has to set SpillDir.
+func defaultSpillDir(loggerName string, worker int) string {
+	if loggerName == "" {
+		loggerName = "glog"
+	}
+	return filepath.Join(os.TempDir(), "glog-spill", fmt.Sprintf("%s-%d", loggerName, worker))
+}
+
 func (e *ChannelEngine) Start() error {
 	for _, worker := range e.workers {
 		go worker.Run()
 	}
+	if e.reopenOnSIGHUP {
+		e.watchReopenSignals()
+	}
+	return nil
+}
+
+// watchReopenSignals calls Reopen on SIGHUP, the signal logrotate's postrotate
+// scripts conventionally send after moving the files.
+func (e *ChannelEngine) watchReopenSignals() {
+	sigs := reopenNotifySignals()
+	if len(sigs) == 0 {
+		return
+	}
+	e.reopenSignals = make(chan os.Signal, 1)
+	e.reopenDone = make(chan struct{})
+	signal.Notify(e.reopenSignals, sigs...)
+	go func() {
+		for {
+			select {
+			case <-e.reopenSignals:
+				if err := e.Reopen(); err != nil {
+					e.onError(nil, err)
+				}
+			case <-e.reopenDone:
+				return
+			}
+		}
+	}()
+}
+
+// Reopen asks every handler that writes to files to reopen them, see handler.IReopener.
+func (e *ChannelEngine) Reopen() error {
+	if atomic.LoadUint32(&e.stop) == 1 {
+		return nil
+	}
+	var errs []error
+	for _, w := range e.workers {
+		if r, ok := w.handler.(handler.IReopener); ok {
+			if err := r.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("reopen: %d handler(s) failed, first error: %w", len(errs), errs[0])
+	}
 	return nil
 }
 
@@ -129,6 +314,19 @@ func (e *ChannelEngine) Send(entry *message.Entry) {
 	}
 }
 
+// Enabled reports whether at least one worker accepts entries of lvl.
+func (e *ChannelEngine) Enabled(lvl Level) bool {
+	if atomic.LoadUint32(&e.stop) == 1 {
+		return false
+	}
+	for _, worker := range e.workers {
+		if lvl >= worker.levelThreshold {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *Worker) Send(entry *message.Entry) {
 	switch w.backpressure.Strategy {
 	case BackpressureStrategyDrop:
@@ -184,6 +382,32 @@ func (w *Worker) Send(entry *message.Entry) {
 			w.stats.AddDropped()
 			w.onError(entry, handler.ErrBackpressureDropped)
 		}
+	case BackpressureStrategySpill:
+		select {
+		case <-w.stopChan:
+			w.stats.AddDropped()
+			return
+		default:
+		}
+		// Once something is spilled the new entries queue up behind it to keep the order.
+		if w.spill.Len() == 0 {
+			select {
+			case w.entryChan <- entry:
+				w.stats.AddEnqueued()
+				return
+			default:
+			}
+		}
+		rec, err := message.MarshalEntry(entry)
+		if err == nil {
+			err = w.spill.Push(rec)
+		}
+		if err != nil {
+			w.stats.AddDiscarded()
+			w.onError(entry, err)
+			return
+		}
+		w.stats.AddSpilled()
 	default:
 		select {
 		case w.entryChan <- entry:
@@ -194,10 +418,58 @@ func (w *Worker) Send(entry *message.Entry) {
 	}
 }
 
+// Flush waits until every worker has handed the entries sent before the call to
+// its handler, and the buffering handlers have written them. The engine keeps running.
+func (e *ChannelEngine) Flush(ctx context.Context) error {
+	return e.flush(ctx, false)
+}
+
+// Sync is Flush that also fsyncs the handlers which write to files.
+func (e *ChannelEngine) Sync(ctx context.Context) error {
+	return e.flush(ctx, true)
+}
+
+func (e *ChannelEngine) flush(ctx context.Context, sync bool) error {
+	if atomic.LoadUint32(&e.stop) == 1 {
+		return nil
+	}
+	reqs := make([]workerFlushRequest, len(e.workers))
+	for i, w := range e.workers {
+		reqs[i] = workerFlushRequest{ctx: ctx, sync: sync, done: make(chan error, 1)}
+		select {
+		case w.flushChan <- reqs[i]:
+		case <-w.runDone:
+			// Stopped meanwhile: Stop drains and closes the handler itself.
+			reqs[i].done <- nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var errs []error
+	for _, req := range reqs {
+		select {
+		case err := <-req.done:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("flush: %d worker(s) failed, first error: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
 func (e *ChannelEngine) Stop() (err error) {
 	if !atomic.CompareAndSwapUint32(&e.stop, 0, 1) {
 		return nil
 	}
+	if e.reopenSignals != nil {
+		signal.Stop(e.reopenSignals)
+		close(e.reopenDone)
+	}
 	for _, w := range e.workers {
 		close(w.stopChan)
 	}
@@ -223,6 +495,18 @@ func (e *ChannelEngine) Stats() LoggerStats {
 		if provider, ok := w.handler.(handler.BackpressureStatsProvider); ok {
 			workerStats.HandlerBackpressure = provider.BackpressureStats()
 		}
+		if provider, ok := w.handler.(handler.SyncStatsProvider); ok {
+			workerStats.HandlerSync = provider.SyncStats()
+		}
+		if provider, ok := w.handler.(handler.FingersCrossedStatsProvider); ok {
+			workerStats.FingersCrossed = provider.FingersCrossedStats()
+		}
+		if provider, ok := w.handler.(handler.TeeStatsProvider); ok {
+			workerStats.Branches = provider.TeeStats()
+		}
+		if provider, ok := w.handler.(handler.WebhookStatsProvider); ok {
+			workerStats.Webhook = provider.WebhookStats()
+		}
 		stats.Workers = append(stats.Workers, workerStats)
 	}
 	return stats
@@ -0,0 +1,29 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ml444/glog/message"
+)
+
+// sendOnlyEngine implements only IEngine, like a custom engine without flushing or reopening.
+type sendOnlyEngine struct{}
+
+func (sendOnlyEngine) Start() error        { return nil }
+func (sendOnlyEngine) Stop() error         { return nil }
+func (sendOnlyEngine) Send(*message.Entry) {}
+
+func TestLoggerUnsupportedEngine(t *testing.T) {
+	l := &Logger{engine: sendOnlyEngine{}}
+	if err := l.Flush(context.Background()); !errors.Is(err, ErrEngineUnsupported) {
+		t.Errorf("Flush = %v, want ErrEngineUnsupported", err)
+	}
+	if err := l.Sync(); !errors.Is(err, ErrEngineUnsupported) {
+		t.Errorf("Sync = %v, want ErrEngineUnsupported", err)
+	}
+	if err := l.Reopen(); !errors.Is(err, ErrEngineUnsupported) {
+		t.Errorf("Reopen = %v, want ErrEngineUnsupported", err)
+	}
+}
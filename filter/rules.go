@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// Func adapts a function to IFilter.
+type Func func(e *message.Entry) bool
+
+func (f Func) Filter(e *message.Entry) bool {
+	return f(e)
+}
+
+// LevelAtLeast keeps the entries at lvl or above.
+func LevelAtLeast(lvl level.LogLevel) IFilter {
+	return Func(func(e *message.Entry) bool {
+		return e.Level >= lvl
+	})
+}
+
+// LevelBelow keeps the entries below lvl.
+func LevelBelow(lvl level.LogLevel) IFilter {
+	return Func(func(e *message.Entry) bool {
+		return e.Level < lvl
+	})
+}
+
+// HasField keeps the entries with a field named key.
+func HasField(key string) IFilter {
+	return Func(func(e *message.Entry) bool {
+		_, ok := e.Fields.Get(key)
+		return ok
+	})
+}
+
+// FieldEquals keeps the entries whose field key renders as value, e.g.
+// FieldEquals("component", "db").
+func FieldEquals(key, value string) IFilter {
+	return Func(func(e *message.Entry) bool {
+		v, ok := e.Fields.Get(key)
+		return ok && message.Field{Key: key, Value: v}.String() == value
+	})
+}
+
+// All keeps the entries that all the filters keep.
+func All(filters ...IFilter) IFilter {
+	return Func(func(e *message.Entry) bool {
+		for _, f := range filters {
+			if !f.Filter(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Any keeps the entries that one of the filters keeps.
+func Any(filters ...IFilter) IFilter {
+	return Func(func(e *message.Entry) bool {
+		for _, f := range filters {
+			if f.Filter(e) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not keeps the entries that f drops.
+func Not(f IFilter) IFilter {
+	return Func(func(e *message.Entry) bool {
+		return !f.Filter(e)
+	})
+}
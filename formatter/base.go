@@ -122,6 +122,7 @@ func (b *BaseFormatter) ConvertToMessage(e *message.Entry) *message.Record {
 		Datetime:  b.FormatDateTime(e.Time),
 		TraceID:   e.TraceID,
 		Message:   e.Message,
+		Fields:    e.Fields,
 	}
 	if b.cfg.EnablePid {
 		m.Pid = pid
@@ -0,0 +1,152 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type GELFFormatterConfig struct {
+	BaseFormatterConfig
+	// Host is the "host" of the messages, the hostname by default.
+	Host string
+	// Extra fields added to every message, e.g. {"env": "prod"}; the "_" prefix
+	// is added to the keys.
+	Extra map[string]interface{}
+}
+
+func (c *GELFFormatterConfig) WithHost(host string) *GELFFormatterConfig {
+	c.Host = host
+	return c
+}
+func (c *GELFFormatterConfig) WithExtra(key string, value interface{}) *GELFFormatterConfig {
+	if c.Extra == nil {
+		c.Extra = make(map[string]interface{})
+	}
+	c.Extra[key] = value
+	return c
+}
+func (c *GELFFormatterConfig) WithBaseFormatterConfig(baseCfg BaseFormatterConfig) *GELFFormatterConfig {
+	c.BaseFormatterConfig = baseCfg
+	return c
+}
+
+// GELFFormatter renders the entries as GELF 1.1 messages: the first line of
+// the message is short_message and a multi-line message is also full_message,
+// the level uses the syslog numbering, and the record fields (_logger,
+// _caller, _function, _trace_id, ...) and the entry fields are additional
+// fields.
+type GELFFormatter struct {
+	*BaseFormatter
+	host  string
+	extra map[string]interface{}
+}
+
+func NewGELFFormatter(cfg GELFFormatterConfig) *GELFFormatter {
+	base := cfg.BaseFormatterConfig
+	base.EnableColor = false
+	f := &GELFFormatter{
+		BaseFormatter: NewBaseFormatter(base),
+		host:          cfg.Host,
+		extra:         make(map[string]interface{}, len(cfg.Extra)),
+	}
+	if f.host == "" {
+		f.host = localHostname
+	}
+	for k, v := range cfg.Extra {
+		f.extra[gelfFieldName(k)] = gelfValue(v)
+	}
+	return f
+}
+
+// GELFLevel is the syslog severity of lvl, see SyslogSeverity.
+func GELFLevel(lvl level.LogLevel) int {
+	return SyslogSeverity(lvl)
+}
+
+func (f *GELFFormatter) Format(entry *message.Entry) ([]byte, error) {
+	record := f.ConvertToMessage(entry)
+	m := make(map[string]interface{}, 12+len(f.extra)+len(record.Fields))
+	for k, v := range f.extra {
+		m[k] = v
+	}
+	for _, field := range record.Fields {
+		m[gelfFieldName(field.Key)] = gelfValue(field.Value)
+	}
+	m["version"] = "1.1"
+	m["host"] = f.host
+	short := record.Message
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = strings.TrimRight(short[:i], "\r")
+		m["full_message"] = record.Message
+	}
+	if short == "" {
+		short = "-"
+	}
+	m["short_message"] = short
+	m["timestamp"] = json.Number(strconv.FormatFloat(float64(entry.Time.UnixNano())/1e9, 'f', 3, 64))
+	m["level"] = GELFLevel(entry.Level)
+	m["_level_name"] = entry.Level.String()
+	if record.Module != "" {
+		m["_logger"] = record.Module
+	}
+	if record.CallerPath != "" {
+		m["_caller"] = record.CallerPath + ":" + strconv.Itoa(record.CallerLine)
+	}
+	if record.CallerName != "" {
+		m["_function"] = record.CallerName
+	}
+	if record.TraceID != "" {
+		m["_trace_id"] = record.TraceID
+	}
+	if record.RoutineID != 0 {
+		m["_routine_id"] = record.RoutineID
+	}
+	if record.Pid != 0 {
+		m["_pid"] = record.Pid
+	}
+	if record.IP != "" {
+		m["_ip"] = record.IP
+	}
+	b := &bytes.Buffer{}
+	if err := json.NewEncoder(b).Encode(m); err != nil {
+		return nil, fmt.Errorf("failed to encoding record to GELF: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+var gelfInvalidChars = regexp.MustCompile(`[^\w.\-]`)
+
+// gelfFieldName prefixes key with "_" and replaces the characters GELF does
+// not allow; "_id" is reserved and becomes "__id".
+func gelfFieldName(key string) string {
+	name := "_" + gelfInvalidChars.ReplaceAllString(key, "_")
+	if name == "_id" {
+		return "__id"
+	}
+	return name
+}
+
+// gelfValue keeps numbers and strings, GELF has no other value types.
+func gelfValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return x
+	case float32:
+		return gelfValue(float64(x))
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+		return x
+	default:
+		return message.Field{Value: v}.String()
+	}
+}
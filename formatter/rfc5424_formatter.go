@@ -0,0 +1,229 @@
+package formatter
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+const (
+	// DefaultSyslogFacility is the "user" facility.
+	DefaultSyslogFacility = 1
+	// DefaultRFC5424SDID is the SD-ID of the element holding the trace id and
+	// the fields; 32473 is the enterprise number reserved for documentation.
+	DefaultRFC5424SDID = "glog@32473"
+
+	rfc5424TimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type RFC5424FormatterConfig struct {
+	BaseFormatterConfig
+	// Facility code, e.g. 1 (user) or 16 (local0); DefaultSyslogFacility when 0.
+	Facility int
+	// Severities overrides the syslog severity of some levels (see SyslogSeverity).
+	Severities map[level.LogLevel]int
+	// AppName is the APP-NAME, the logger name by default.
+	AppName  string
+	Hostname string // the hostname by default
+	MsgID    string
+	SDID     string // DefaultRFC5424SDID by default
+	// Message renders the MSG part, the bare message when nil.
+	Message IFormatter
+}
+
+func (c *RFC5424FormatterConfig) WithFacility(facility int) *RFC5424FormatterConfig {
+	c.Facility = facility
+	return c
+}
+func (c *RFC5424FormatterConfig) WithSeverity(lvl level.LogLevel, severity int) *RFC5424FormatterConfig {
+	if c.Severities == nil {
+		c.Severities = make(map[level.LogLevel]int)
+	}
+	c.Severities[lvl] = severity
+	return c
+}
+func (c *RFC5424FormatterConfig) WithAppName(name string) *RFC5424FormatterConfig {
+	c.AppName = name
+	return c
+}
+func (c *RFC5424FormatterConfig) WithHostname(hostname string) *RFC5424FormatterConfig {
+	c.Hostname = hostname
+	return c
+}
+func (c *RFC5424FormatterConfig) WithMsgID(msgID string) *RFC5424FormatterConfig {
+	c.MsgID = msgID
+	return c
+}
+func (c *RFC5424FormatterConfig) WithSDID(sdID string) *RFC5424FormatterConfig {
+	c.SDID = sdID
+	return c
+}
+func (c *RFC5424FormatterConfig) WithMessageFormatter(fm IFormatter) *RFC5424FormatterConfig {
+	c.Message = fm
+	return c
+}
+func (c *RFC5424FormatterConfig) WithBaseFormatterConfig(baseCfg BaseFormatterConfig) *RFC5424FormatterConfig {
+	c.BaseFormatterConfig = baseCfg
+	return c
+}
+
+// SyslogSeverity is the default syslog severity of lvl: PrintLevel is
+// informational like InfoLevel, PanicLevel and FatalLevel are critical.
+func SyslogSeverity(lvl level.LogLevel) int {
+	switch lvl {
+	case level.PanicLevel, level.FatalLevel:
+		return 2
+	case level.ErrorLevel:
+		return 3
+	case level.WarnLevel:
+		return 4
+	case level.DebugLevel:
+		return 7
+	default:
+		return 6
+	}
+}
+
+// RFC5424Formatter renders the entries as RFC 5424 syslog messages, without
+// transport framing:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ID trace_id="..." key="value"] MSG
+//
+// The trace id and the fields are the parameters of one STRUCTURED-DATA element.
+type RFC5424Formatter struct {
+	facility   int
+	severities map[level.LogLevel]int
+	header     string // HOSTNAME APP-NAME PROCID MSGID
+	sdID       string
+	message    IFormatter
+}
+
+func NewRFC5424Formatter(cfg RFC5424FormatterConfig) *RFC5424Formatter {
+	f := &RFC5424Formatter{
+		facility:   cfg.Facility,
+		severities: cfg.Severities,
+		sdID:       rfc5424SDName(cfg.SDID),
+		message:    cfg.Message,
+	}
+	if f.facility <= 0 || f.facility > 23 {
+		f.facility = DefaultSyslogFacility
+	}
+	if f.sdID == "-" {
+		f.sdID = DefaultRFC5424SDID
+	}
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname = localHostname
+	}
+	appName := cfg.AppName
+	if appName == "" {
+		appName = cfg.LoggerName
+	}
+	if appName == "" {
+		appName, _ = defaultLoggerName.Load().(string)
+	}
+	f.header = rfc5424Name(hostname, 255) + " " + rfc5424Name(appName, 48) + " " + pidStr + " " + rfc5424Name(cfg.MsgID, 32)
+	return f
+}
+
+// Priority is the PRI value of lvl.
+func (f *RFC5424Formatter) Priority(lvl level.LogLevel) int {
+	severity, ok := f.severities[lvl]
+	if !ok {
+		severity = SyslogSeverity(lvl)
+	}
+	return f.facility*8 + severity&7
+}
+
+func (f *RFC5424Formatter) Format(entry *message.Entry) ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.Grow(defaultBufferGrow)
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(f.Priority(entry.Level)))
+	b.WriteString(">1 ")
+	if entry.Time.IsZero() {
+		b.WriteByte('-')
+	} else {
+		b.WriteString(entry.Time.Format(rfc5424TimeLayout))
+	}
+	b.WriteByte(' ')
+	b.WriteString(f.header)
+	b.WriteByte(' ')
+	f.writeStructuredData(b, entry)
+
+	msg := []byte(entry.Message)
+	if f.message != nil {
+		var err error
+		if msg, err = f.message.Format(entry); err != nil {
+			return nil, err
+		}
+		msg = bytes.TrimRight(msg, "\n")
+	}
+	if len(msg) > 0 {
+		b.WriteByte(' ')
+		b.Write(msg)
+	}
+	return b.Bytes(), nil
+}
+
+func (f *RFC5424Formatter) writeStructuredData(b *bytes.Buffer, entry *message.Entry) {
+	if entry.TraceID == "" && len(entry.Fields) == 0 {
+		b.WriteByte('-')
+		return
+	}
+	b.WriteByte('[')
+	b.WriteString(f.sdID)
+	if entry.TraceID != "" {
+		writeSDParam(b, "trace_id", entry.TraceID)
+	}
+	for _, field := range entry.Fields {
+		writeSDParam(b, field.Key, field.String())
+	}
+	b.WriteByte(']')
+}
+
+func writeSDParam(b *bytes.Buffer, name, value string) {
+	b.WriteByte(' ')
+	b.WriteString(rfc5424SDName(name))
+	b.WriteString(`="`)
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == '"' || c == '\\' || c == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	b.WriteByte('"')
+}
+
+// rfc5424Name makes s a valid header field: printable ASCII without spaces,
+// at most limit bytes, "-" when empty.
+func rfc5424Name(s string, limit int) string {
+	if s == "" {
+		return "-"
+	}
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > limit {
+		s = s[:limit]
+	}
+	return s
+}
+
+// rfc5424SDName makes s a valid PARAM-NAME: '=', ']' and '"' are not allowed
+// besides the characters rfc5424Name replaces.
+func rfc5424SDName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	return rfc5424Name(s, 32)
+}
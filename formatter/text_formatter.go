@@ -49,6 +49,9 @@ type TextFormatter struct {
 	sepListLen    int
 	sepList       []string
 	writeFuncList []writeFunc
+	// hasFieldsPattern is true when `PatternStyle` places the fields itself,
+	// otherwise they are appended after the pattern.
+	hasFieldsPattern bool
 }
 
 func NewTextFormatter(cfg TextFormatterConfig) *TextFormatter {
@@ -76,6 +79,10 @@ func (f *TextFormatter) Format(entry *message.Entry) ([]byte, error) {
 	} else {
 		f.ColorRender(b, m)
 	}
+	if !f.hasFieldsPattern && len(m.Fields) > 0 {
+		b.WriteByte(' ')
+		f.writeFields(b, m)
+	}
 
 	b.WriteByte('\n')
 	return b.Bytes(), nil
@@ -225,6 +232,40 @@ func (f *TextFormatter) writeMessage(b *bytes.Buffer, m *message.Record) {
 	}
 }
 
+// writeFields renders the fields as space separated key=value pairs.
+func (f *TextFormatter) writeFields(b *bytes.Buffer, m *message.Record) {
+	for i, field := range m.Fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if f.DisableColors {
+			b.WriteString(field.Key)
+		} else {
+			b.WriteString(cyan + field.Key + colorEnd)
+		}
+		b.WriteByte('=')
+		val := field.String()
+		if f.needsQuoting(val) || needsFieldQuoting(val) {
+			b.WriteString(strconv.Quote(val))
+		} else {
+			b.WriteString(val)
+		}
+	}
+}
+
+// needsFieldQuoting reports whether val would be ambiguous in a key=value list.
+func needsFieldQuoting(val string) bool {
+	if val == "" {
+		return true
+	}
+	for _, r := range val {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *TextFormatter) parseWriteFuncList(src string) {
 	if src == "" {
 		return
@@ -247,6 +288,7 @@ func (f *TextFormatter) parseWriteFuncList(src string) {
 		"DateTime": f.writeDateTime,
 		//"Msecs":      f.writeTimeMs,
 		"Message": f.writeMessage,
+		"Fields":  f.writeFields,
 	}
 	regexpPattern := regexp.MustCompile(`%\[(\w+)?\][sdfwvtq]`)
 	result := regexpPattern.FindAllStringSubmatchIndex(src, -1)
@@ -263,6 +305,9 @@ func (f *TextFormatter) parseWriteFuncList(src string) {
 		}
 
 		key := src[idxList[2]:idxList[3]]
+		if key == "Fields" {
+			f.hasFieldsPattern = true
+		}
 		fn, ok := writeFuncMap[key]
 		if ok {
 			list = append(list, fn)
@@ -14,6 +14,9 @@ const (
 	BackpressureStrategyDrop
 	BackpressureStrategyTimeout
 	BackpressureStrategySample
+	// BackpressureStrategySpill writes the overflow to a bounded on-disk queue
+	// and replays it in order once the queue has room again.
+	BackpressureStrategySpill
 )
 
 var (
@@ -25,6 +28,13 @@ type BackpressureConfig struct {
 	Strategy   BackpressureStrategy
 	Timeout    time.Duration
 	SampleRate uint64
+	// SpillDir holds the segments of BackpressureStrategySpill. Unreplayed
+	// segments found there at start-up are replayed first. A directory serves
+	// one queue at a time, opening a second one fails with ErrSpillDirInUse.
+	SpillDir string
+	// SpillMaxBytes bounds the spill queue on disk, further overflow is discarded.
+	SpillMaxBytes    int64
+	SpillSegmentSize int64
 }
 
 func NewBackpressureConfig(strategy BackpressureStrategy) BackpressureConfig {
@@ -41,6 +51,16 @@ func (c BackpressureConfig) WithSampleRate(rate uint64) BackpressureConfig {
 	return c
 }
 
+func (c BackpressureConfig) WithSpillDir(dir string) BackpressureConfig {
+	c.SpillDir = dir
+	return c
+}
+
+func (c BackpressureConfig) WithSpillMaxBytes(n int64) BackpressureConfig {
+	c.SpillMaxBytes = n
+	return c
+}
+
 func (c BackpressureConfig) Normalize(defaultStrategy BackpressureStrategy) BackpressureConfig {
 	if c.Strategy == BackpressureStrategyUnset {
 		c.Strategy = defaultStrategy
@@ -51,14 +71,25 @@ func (c BackpressureConfig) Normalize(defaultStrategy BackpressureStrategy) Back
 	if c.Strategy == BackpressureStrategySample && c.SampleRate == 0 {
 		c.SampleRate = 10
 	}
+	if c.Strategy == BackpressureStrategySpill {
+		if c.SpillMaxBytes <= 0 {
+			c.SpillMaxBytes = 64 << 20
+		}
+		if c.SpillSegmentSize <= 0 {
+			c.SpillSegmentSize = 4 << 20
+		}
+	}
 	return c
 }
 
 type BackpressureStats struct {
-	Enqueued uint64
-	Dropped  uint64
-	TimedOut uint64
-	Sampled  uint64
+	Enqueued  uint64
+	Dropped   uint64
+	TimedOut  uint64
+	Sampled   uint64
+	Spilled   uint64
+	Replayed  uint64
+	Discarded uint64
 }
 
 type BackpressureCounter struct {
@@ -67,6 +98,9 @@ type BackpressureCounter struct {
 	timedOut  uint64
 	sampled   uint64
 	sampleSeq uint64
+	spilled   uint64
+	replayed  uint64
+	discarded uint64
 }
 
 func (c *BackpressureCounter) AddEnqueued() {
@@ -81,6 +115,18 @@ func (c *BackpressureCounter) AddTimedOut() {
 	atomic.AddUint64(&c.timedOut, 1)
 }
 
+func (c *BackpressureCounter) AddSpilled() {
+	atomic.AddUint64(&c.spilled, 1)
+}
+
+func (c *BackpressureCounter) AddReplayed() {
+	atomic.AddUint64(&c.replayed, 1)
+}
+
+func (c *BackpressureCounter) AddDiscarded() {
+	atomic.AddUint64(&c.discarded, 1)
+}
+
 func (c *BackpressureCounter) AllowSample(rate uint64) bool {
 	if rate <= 1 {
 		atomic.AddUint64(&c.sampled, 1)
@@ -96,10 +142,13 @@ func (c *BackpressureCounter) AllowSample(rate uint64) bool {
 
 func (c *BackpressureCounter) Snapshot() BackpressureStats {
 	return BackpressureStats{
-		Enqueued: atomic.LoadUint64(&c.enqueued),
-		Dropped:  atomic.LoadUint64(&c.dropped),
-		TimedOut: atomic.LoadUint64(&c.timedOut),
-		Sampled:  atomic.LoadUint64(&c.sampled),
+		Enqueued:  atomic.LoadUint64(&c.enqueued),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+		TimedOut:  atomic.LoadUint64(&c.timedOut),
+		Sampled:   atomic.LoadUint64(&c.sampled),
+		Spilled:   atomic.LoadUint64(&c.spilled),
+		Replayed:  atomic.LoadUint64(&c.replayed),
+		Discarded: atomic.LoadUint64(&c.discarded),
 	}
 }
 
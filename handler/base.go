@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/ml444/glog/message"
 )
 
@@ -8,3 +10,15 @@ type IHandler interface {
 	Emit(entry *message.Entry) error
 	Close() error
 }
+
+// IFlusher is implemented by handlers that keep entries buffered after Emit returns.
+type IFlusher interface {
+	// Flush blocks until the entries emitted before the call have been written.
+	Flush(ctx context.Context) error
+}
+
+// ISyncer is implemented by handlers that can commit written data to stable storage.
+type ISyncer interface {
+	// Sync flushes like IFlusher and then fsyncs the underlying file.
+	Sync() error
+}
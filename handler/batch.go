@@ -0,0 +1,463 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ml444/glog/message"
+)
+
+// BatchConfig limits the batches of the network handlers. A batch is sent
+// when it holds MaxCount entries or MaxBytes formatted bytes, or when its
+// oldest entry is MaxAge old.
+type BatchConfig struct {
+	MaxCount int
+	MaxBytes int
+	MaxAge   time.Duration
+	// QueueSize is the number of entries waiting for the sender, BackpressureConfig
+	// applies when it is full.
+	QueueSize int
+	// CloseTimeout bounds the delivery of what is queued on Close; the
+	// retries are then cancelled and the entries left reported as failed.
+	CloseTimeout time.Duration
+}
+
+func NewBatchConfig(maxCount, maxBytes int, maxAge time.Duration) BatchConfig {
+	return BatchConfig{MaxCount: maxCount, MaxBytes: maxBytes, MaxAge: maxAge}
+}
+
+func (c BatchConfig) WithQueueSize(size int) BatchConfig {
+	c.QueueSize = size
+	return c
+}
+
+func (c BatchConfig) WithCloseTimeout(timeout time.Duration) BatchConfig {
+	c.CloseTimeout = timeout
+	return c
+}
+
+func (c BatchConfig) Normalize() BatchConfig {
+	if c.MaxCount <= 0 {
+		c.MaxCount = 100
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 1 << 20
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = 5 * time.Second
+	}
+	return c
+}
+
+// RetryConfig is the exponential backoff of the network handlers: attempt n
+// waits InitialBackoff*Multiplier^n, at most MaxBackoff, randomized by ±Jitter.
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+func NewRetryConfig(maxAttempts int, initial, max time.Duration) RetryConfig {
+	return RetryConfig{MaxAttempts: maxAttempts, InitialBackoff: initial, MaxBackoff: max}
+}
+
+func (c RetryConfig) WithMultiplier(m float64) RetryConfig {
+	c.Multiplier = m
+	return c
+}
+
+func (c RetryConfig) WithJitter(j float64) RetryConfig {
+	c.Jitter = j
+	return c
+}
+
+func (c RetryConfig) Normalize() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = 2
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		c.Jitter = 0.2
+	}
+	return c
+}
+
+// Backoff is the wait before the retry following attempt (0 based). An error
+// carrying a server hint (see HTTPStatusError.RetryAfter) overrides it.
+func (c RetryConfig) Backoff(attempt int, err error) time.Duration {
+	var hint interface{ RetryAfter() time.Duration }
+	if errors.As(err, &hint) {
+		if d := hint.RetryAfter(); d > 0 {
+			if d > c.MaxBackoff {
+				d = c.MaxBackoff
+			}
+			return d
+		}
+	}
+	d := float64(c.InitialBackoff) * math.Pow(c.Multiplier, float64(attempt))
+	if d > float64(c.MaxBackoff) {
+		d = float64(c.MaxBackoff)
+	}
+	if c.Jitter > 0 {
+		d += d * c.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// batchItem is one formatted entry waiting in a batch.
+type batchItem struct {
+	entry *message.Entry
+	data  []byte
+}
+
+// batchSendFunc makes one delivery attempt, giving up when ctx is done. It
+// returns the items worth retrying together with the error; no items means the
+// error is permanent. Items that failed for good while others are retried are
+// returned in a *batchPartialError.
+type batchSendFunc func(ctx context.Context, items []batchItem) ([]batchItem, error)
+
+// batchPartialError reports the items of a batch that failed for good, with
+// failedErr, while the others were delivered or are retried with err.
+type batchPartialError struct {
+	failed    []batchItem
+	failedErr error
+	err       error
+}
+
+func (e *batchPartialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *batchPartialError) Unwrap() error {
+	return e.err
+}
+
+// batchSender collects the entries of a network handler into batches and
+// delivers them from one goroutine, retrying with backoff. While it retries
+// the queue fills up and BackpressureConfig decides what Emit does.
+type batchSender struct {
+	batch        BatchConfig
+	retry        RetryConfig
+	backpressure BackpressureConfig
+	stats        BackpressureCounter
+	send         batchSendFunc
+	onError      func(buf interface{}, err error)
+
+	// ctx is cancelled when close has waited CloseTimeout.
+	ctx        context.Context
+	cancel     context.CancelFunc
+	queue      chan batchItem
+	flushChan  chan batchFlushRequest
+	doneChan   chan struct{}
+	workerDone chan struct{}
+	closeOnce  sync.Once
+}
+
+// batchFlushRequest asks run to deliver everything queued, ctx being the one
+// of the caller of flush.
+type batchFlushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+func newBatchSender(batch BatchConfig, retry RetryConfig, backpressure BackpressureConfig, send batchSendFunc, onError func(buf interface{}, err error)) *batchSender {
+	s := &batchSender{
+		batch:        batch.Normalize(),
+		retry:        retry.Normalize(),
+		backpressure: backpressure.Normalize(BackpressureStrategyBlock),
+		send:         send,
+		onError:      onError,
+		flushChan:    make(chan batchFlushRequest),
+		doneChan:     make(chan struct{}),
+		workerDone:   make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.queue = make(chan batchItem, s.batch.QueueSize)
+	go s.run()
+	return s
+}
+
+func (s *batchSender) run() {
+	defer close(s.workerDone)
+	var items []batchItem
+	var size int
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var timerC <-chan time.Time
+
+	add := func(it batchItem) {
+		if len(items) == 0 {
+			timer.Reset(s.batch.MaxAge)
+			timerC = timer.C
+		}
+		items = append(items, it)
+		size += len(it.data)
+	}
+	flush := func(ctx context.Context) error {
+		if timerC != nil && !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timerC = nil
+		if len(items) == 0 {
+			return nil
+		}
+		batch := items
+		items, size = nil, 0
+		left, err := s.deliver(ctx, batch)
+		if len(left) > 0 {
+			// A Flush caller gave up: the entries wait for the next batch.
+			for _, it := range left {
+				add(it)
+			}
+		}
+		return err
+	}
+	// drain batches everything queued, it returns the last delivery error.
+	drain := func(ctx context.Context) error {
+		var err error
+		for {
+			select {
+			case it := <-s.queue:
+				add(it)
+				if s.full(len(items), size) {
+					if ferr := flush(ctx); ferr != nil {
+						err = ferr
+					}
+				}
+			default:
+				if ferr := flush(ctx); ferr != nil {
+					err = ferr
+				}
+				return err
+			}
+			if ctx.Err() != nil && s.ctx.Err() == nil {
+				return ctx.Err()
+			}
+		}
+	}
+
+	for {
+		select {
+		case it := <-s.queue:
+			add(it)
+			if s.full(len(items), size) {
+				_ = flush(s.ctx)
+			}
+		case <-timerC:
+			timerC = nil
+			_ = flush(s.ctx)
+		case req := <-s.flushChan:
+			ctx, cancel := s.flushContext(req.ctx)
+			req.done <- drain(ctx)
+			cancel()
+		case <-s.doneChan:
+			_ = drain(s.ctx)
+			return
+		}
+	}
+}
+
+// flushContext is done when s.ctx or the context of a Flush caller is.
+func (s *batchSender) flushContext(caller context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-caller.Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+	return ctx, func() {
+		close(stop)
+		cancel()
+	}
+}
+
+func (s *batchSender) full(count, size int) bool {
+	return count >= s.batch.MaxCount || size >= s.batch.MaxBytes
+}
+
+// deliver sends items, retrying the retryable part. What still fails is
+// reported to onError with the entries concerned. When ctx is done the
+// retries stop; unless the sender is closing, the entries not delivered are
+// returned instead of reported.
+func (s *batchSender) deliver(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			return s.giveUp(items, err)
+		}
+		var retry []batchItem
+		retry, err = s.send(ctx, items)
+		if err == nil {
+			return nil, nil
+		}
+		var pe *batchPartialError
+		if errors.As(err, &pe) {
+			s.report(pe.failed, pe.failedErr)
+			if len(retry) == 0 {
+				return nil, err
+			}
+		}
+		if ctx.Err() != nil {
+			// Aborted rather than failed.
+			if len(retry) == 0 && pe == nil {
+				retry = items
+			}
+			return s.giveUp(retry, err)
+		}
+		if len(retry) == 0 {
+			break
+		}
+		items = retry
+		if attempt+1 >= s.retry.MaxAttempts {
+			break
+		}
+		t := time.NewTimer(s.retry.Backoff(attempt, err))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	s.report(items, err)
+	return nil, err
+}
+
+// giveUp reports items when the sender is closing, or returns them to be
+// delivered later.
+func (s *batchSender) giveUp(items []batchItem, err error) ([]batchItem, error) {
+	if s.ctx.Err() != nil {
+		s.report(items, err)
+		return nil, err
+	}
+	return items, err
+}
+
+func (s *batchSender) report(items []batchItem, err error) {
+	if s.onError == nil || len(items) == 0 {
+		return
+	}
+	entries := make([]*message.Entry, 0, len(items))
+	for _, it := range items {
+		entries = append(entries, it.entry)
+	}
+	s.onError(entries, err)
+}
+
+func (s *batchSender) enqueue(it batchItem) error {
+	switch s.backpressure.Strategy {
+	case BackpressureStrategyBlock:
+		select {
+		case s.queue <- it:
+			s.stats.AddEnqueued()
+			return nil
+		case <-s.doneChan:
+			s.stats.AddDropped()
+			return ErrBackpressureDropped
+		}
+	case BackpressureStrategyTimeout:
+		t := AcquireTimeoutTimer(s.backpressure.Timeout)
+		defer ReleaseTimeoutTimer(t)
+		select {
+		case s.queue <- it:
+			s.stats.AddEnqueued()
+			return nil
+		case <-t.C:
+			s.stats.AddTimedOut()
+			return ErrBackpressureTimeout
+		}
+	case BackpressureStrategySample:
+		select {
+		case s.queue <- it:
+			s.stats.AddEnqueued()
+			return nil
+		default:
+			if !s.stats.AllowSample(s.backpressure.SampleRate) {
+				s.stats.AddDropped()
+				return ErrBackpressureDropped
+			}
+			select {
+			case s.queue <- it:
+				s.stats.AddEnqueued()
+				return nil
+			case <-s.doneChan:
+				s.stats.AddDropped()
+				return ErrBackpressureDropped
+			}
+		}
+	default:
+		// Drop, also for Spill which the network handlers do not support.
+		select {
+		case s.queue <- it:
+			s.stats.AddEnqueued()
+			return nil
+		default:
+			s.stats.AddDropped()
+			return ErrBackpressureDropped
+		}
+	}
+}
+
+// flush waits until the entries enqueued before the call have been delivered
+// or given up, and returns the last delivery error.
+func (s *batchSender) flush(ctx context.Context) error {
+	req := batchFlushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case s.flushChan <- req:
+	case <-s.workerDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close delivers what is queued, retries included, and stops the sender.
+// After CloseTimeout the deliveries are cancelled and what is left reported.
+func (s *batchSender) close() {
+	s.closeOnce.Do(func() {
+		close(s.doneChan)
+		t := time.NewTimer(s.batch.CloseTimeout)
+		select {
+		case <-s.workerDone:
+			t.Stop()
+		case <-t.C:
+			s.cancel()
+			<-s.workerDone
+		}
+		s.cancel()
+	})
+}
@@ -1,5 +1,15 @@
 package handler
 
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+)
+
 /*
 ================== file ===================
 */
@@ -12,13 +22,39 @@ type FileHandlerConfig struct {
 	BulkWriteSize int
 	BufferSize    int
 	Backpressure  BackpressureConfig
+	Durability    DurabilityConfig
 
 	RotatorType       RotatorType
-	Interval          int64  // unit: second. used in TimeRotator and TimeAndSizeRotator.
-	TimeSuffixFmt     string // Time suffix format of file name:test.log.2024061104
+	Interval          int64     // unit: second. used in TimeRotator and TimeAndSizeRotator.
+	Schedule          ISchedule // replaces Interval, e.g. DailySchedule(0, 0, loc) or ParseCronSchedule("0 0 * * 1", nil).
+	Clock             IClock    // time source of the time based rotators, defaults to the system clock.
+	TimeSuffixFmt     string    // Time suffix format of file name:test.log.2024061104
 	ReMatch           string
 	FileSuffix        string
 	ConcurrentlyWrite bool
+	// Compression compresses each rotated backup in the background, e.g. NewGzipCompressor.
+	// Rejected with ConcurrentlyWrite, where other processes may still write to the old file.
+	Compression ICompressor
+	// MaxAge removes, in the background, the rotated backups last modified longer ago than this.
+	MaxAge time.Duration
+	// MaxTotalSize (bytes) removes, in the background, the oldest rotated backups until the rest fit in it.
+	MaxTotalSize int64
+	// DetectExternalRotation reopens the file before a write when another program
+	// moved it away or truncated it (logrotate create/copytruncate), checked at
+	// most once per ReopenCheckInterval (default 1s).
+	DetectExternalRotation bool
+	ReopenCheckInterval    time.Duration
+	// MultiProcess lets several processes share the file: they append with
+	// O_APPEND and coordinate through a flock on a hidden ".name.log.lock"
+	// file, so only one of them rotates and the others reopen the new file.
+	MultiProcess bool
+	// CurrentLink is a symlink kept pointing at the file being written, e.g.
+	// "app.log.current"; a relative name is placed in FileDir.
+	CurrentLink string
+	// FileMode and DirMode are the permissions of the created log files and
+	// directories, 0o666 and 0o777 when zero. The umask is not applied.
+	FileMode os.FileMode
+	DirMode  os.FileMode
 
 	ErrCallback func(buf interface{}, err error)
 }
@@ -39,6 +75,14 @@ func (c *FileHandlerConfig) WithBackupCount(n int) *FileHandlerConfig {
 	c.BackupCount = n
 	return c
 }
+func (c *FileHandlerConfig) WithMaxAge(age time.Duration) *FileHandlerConfig {
+	c.MaxAge = age
+	return c
+}
+func (c *FileHandlerConfig) WithMaxTotalSize(size int64) *FileHandlerConfig {
+	c.MaxTotalSize = size
+	return c
+}
 func (c *FileHandlerConfig) WithBulkSize(size int) *FileHandlerConfig {
 	c.BulkWriteSize = size
 	return c
@@ -55,6 +99,10 @@ func (c *FileHandlerConfig) WithBackpressureStrategy(strategy BackpressureStrate
 	c.Backpressure.Strategy = strategy
 	return c
 }
+func (c *FileHandlerConfig) WithDurability(config DurabilityConfig) *FileHandlerConfig {
+	c.Durability = config
+	return c
+}
 func (c *FileHandlerConfig) WithRotatorType(typ RotatorType) *FileHandlerConfig {
 	c.RotatorType = typ
 	return c
@@ -63,6 +111,14 @@ func (c *FileHandlerConfig) WithInterval(seconds int64) *FileHandlerConfig {
 	c.Interval = seconds
 	return c
 }
+func (c *FileHandlerConfig) WithSchedule(schedule ISchedule) *FileHandlerConfig {
+	c.Schedule = schedule
+	return c
+}
+func (c *FileHandlerConfig) WithClock(clock IClock) *FileHandlerConfig {
+	c.Clock = clock
+	return c
+}
 func (c *FileHandlerConfig) WithTimeSuffixFmt(timeFormat string) *FileHandlerConfig {
 	c.TimeSuffixFmt = timeFormat
 	return c
@@ -79,6 +135,35 @@ func (c *FileHandlerConfig) WithConcurrentlyWrite() *FileHandlerConfig {
 	c.ConcurrentlyWrite = true
 	return c
 }
+func (c *FileHandlerConfig) WithCompression(compressor ICompressor) *FileHandlerConfig {
+	c.Compression = compressor
+	return c
+}
+func (c *FileHandlerConfig) WithGzipCompression() *FileHandlerConfig {
+	c.Compression = NewGzipCompressor(0)
+	return c
+}
+func (c *FileHandlerConfig) WithDetectExternalRotation(checkInterval time.Duration) *FileHandlerConfig {
+	c.DetectExternalRotation = true
+	c.ReopenCheckInterval = checkInterval
+	return c
+}
+func (c *FileHandlerConfig) WithMultiProcess() *FileHandlerConfig {
+	c.MultiProcess = true
+	return c
+}
+func (c *FileHandlerConfig) WithCurrentLink(name string) *FileHandlerConfig {
+	c.CurrentLink = name
+	return c
+}
+func (c *FileHandlerConfig) WithFileMode(mode os.FileMode) *FileHandlerConfig {
+	c.FileMode = mode
+	return c
+}
+func (c *FileHandlerConfig) WithDirMode(mode os.FileMode) *FileHandlerConfig {
+	c.DirMode = mode
+	return c
+}
 func (c *FileHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *FileHandlerConfig {
 	c.ErrCallback = cb
 	return c
@@ -89,10 +174,36 @@ func (c *FileHandlerConfig) WithErrCallback(cb func(buf interface{}, err error))
 */
 
 type SyslogHandlerConfig struct {
-	Network  string
-	Address  string
-	Tag      string
+	Network string // "udp" (default), "tcp", "unix" or "unixgram"; TLS over "tcp" with TLSConfig
+	Address string
+	Tag     string // APP-NAME
+	// Priority is a log/syslog Priority; its facility is used when Facility is 0.
 	Priority int
+	// Facility code, e.g. 1 (user) or 16 (local0); formatter.DefaultSyslogFacility when 0.
+	Facility int
+	// Severities overrides the severity of some levels, see formatter.SyslogSeverity.
+	Severities map[level.LogLevel]int
+	Hostname   string
+	MsgID      string
+	Framing    SyslogFraming
+	TLSConfig  *tls.Config
+	Timeout    time.Duration // dial and write, default 5s
+}
+
+// formatterConfig is the RFC 5424 header of the handler, with fm for the MSG part.
+func (c *SyslogHandlerConfig) formatterConfig(fm formatter.IFormatter) formatter.RFC5424FormatterConfig {
+	facility := c.Facility
+	if facility == 0 {
+		facility = c.Priority >> 3
+	}
+	return formatter.RFC5424FormatterConfig{
+		Facility:   facility,
+		Severities: c.Severities,
+		AppName:    c.Tag,
+		Hostname:   c.Hostname,
+		MsgID:      c.MsgID,
+		Message:    fm,
+	}
 }
 
 func (c *SyslogHandlerConfig) WithNetwork(net string) *SyslogHandlerConfig {
@@ -111,3 +222,676 @@ func (c *SyslogHandlerConfig) WithPriority(priority int) *SyslogHandlerConfig {
 	c.Priority = priority
 	return c
 }
+func (c *SyslogHandlerConfig) WithFacility(facility int) *SyslogHandlerConfig {
+	c.Facility = facility
+	return c
+}
+func (c *SyslogHandlerConfig) WithSeverity(lvl level.LogLevel, severity int) *SyslogHandlerConfig {
+	if c.Severities == nil {
+		c.Severities = make(map[level.LogLevel]int)
+	}
+	c.Severities[lvl] = severity
+	return c
+}
+func (c *SyslogHandlerConfig) WithHostname(hostname string) *SyslogHandlerConfig {
+	c.Hostname = hostname
+	return c
+}
+func (c *SyslogHandlerConfig) WithMsgID(msgID string) *SyslogHandlerConfig {
+	c.MsgID = msgID
+	return c
+}
+func (c *SyslogHandlerConfig) WithFraming(framing SyslogFraming) *SyslogHandlerConfig {
+	c.Framing = framing
+	return c
+}
+func (c *SyslogHandlerConfig) WithTLSConfig(config *tls.Config) *SyslogHandlerConfig {
+	c.TLSConfig = config
+	return c
+}
+func (c *SyslogHandlerConfig) WithTimeout(timeout time.Duration) *SyslogHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+
+/*
+================== HTTP ===================
+*/
+
+type HTTPHandlerConfig struct {
+	URL      string
+	Method   string // default POST
+	Headers  map[string]string
+	Encoding HTTPEncoding
+	Gzip     bool
+	Timeout  time.Duration // per request, default 10s; ignored with Client
+	Client   *http.Client
+
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig // default Block
+
+	// ErrCallback receives the []*message.Entry of a batch that could not be delivered.
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *HTTPHandlerConfig) WithURL(url string) *HTTPHandlerConfig {
+	c.URL = url
+	return c
+}
+func (c *HTTPHandlerConfig) WithMethod(method string) *HTTPHandlerConfig {
+	c.Method = method
+	return c
+}
+func (c *HTTPHandlerConfig) WithHeader(key, value string) *HTTPHandlerConfig {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+	return c
+}
+func (c *HTTPHandlerConfig) WithEncoding(encoding HTTPEncoding) *HTTPHandlerConfig {
+	c.Encoding = encoding
+	return c
+}
+func (c *HTTPHandlerConfig) WithGzip() *HTTPHandlerConfig {
+	c.Gzip = true
+	return c
+}
+func (c *HTTPHandlerConfig) WithTimeout(timeout time.Duration) *HTTPHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *HTTPHandlerConfig) WithClient(client *http.Client) *HTTPHandlerConfig {
+	c.Client = client
+	return c
+}
+func (c *HTTPHandlerConfig) WithBatch(config BatchConfig) *HTTPHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *HTTPHandlerConfig) WithRetry(config RetryConfig) *HTTPHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *HTTPHandlerConfig) WithBackpressure(config BackpressureConfig) *HTTPHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *HTTPHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *HTTPHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+/*
+================== Loki ===================
+*/
+
+type LokiHandlerConfig struct {
+	URL         string // e.g. http://loki:3100, "/loki/api/v1/push" is appended when missing
+	Tenant      string // sent as X-Scope-OrgID
+	LoggerName  string // value of the "logger" label
+	Labels      map[string]string
+	LabelFields []string // entry fields that become labels; keep their cardinality low
+	Headers     map[string]string
+	Gzip        bool
+	Timeout     time.Duration
+	Client      *http.Client
+
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig
+
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *LokiHandlerConfig) WithURL(url string) *LokiHandlerConfig {
+	c.URL = url
+	return c
+}
+func (c *LokiHandlerConfig) WithTenant(tenant string) *LokiHandlerConfig {
+	c.Tenant = tenant
+	return c
+}
+func (c *LokiHandlerConfig) WithLabel(name, value string) *LokiHandlerConfig {
+	if c.Labels == nil {
+		c.Labels = make(map[string]string)
+	}
+	c.Labels[name] = value
+	return c
+}
+func (c *LokiHandlerConfig) WithLabelFields(keys ...string) *LokiHandlerConfig {
+	c.LabelFields = append(c.LabelFields, keys...)
+	return c
+}
+func (c *LokiHandlerConfig) WithHeader(key, value string) *LokiHandlerConfig {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+	return c
+}
+func (c *LokiHandlerConfig) WithGzip() *LokiHandlerConfig {
+	c.Gzip = true
+	return c
+}
+func (c *LokiHandlerConfig) WithTimeout(timeout time.Duration) *LokiHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *LokiHandlerConfig) WithClient(client *http.Client) *LokiHandlerConfig {
+	c.Client = client
+	return c
+}
+func (c *LokiHandlerConfig) WithBatch(config BatchConfig) *LokiHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *LokiHandlerConfig) WithRetry(config RetryConfig) *LokiHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *LokiHandlerConfig) WithBackpressure(config BackpressureConfig) *LokiHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *LokiHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *LokiHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+/*
+================== Elasticsearch ===================
+*/
+
+type ElasticsearchHandlerConfig struct {
+	URL string // e.g. https://es:9200, "/_bulk" is appended when missing
+	// Index is the target index; a time layout between braces is replaced with
+	// the UTC time of the entry, e.g. "glog-{2006.01.02}".
+	Index  string
+	OpType string // "index" (default) or "create", required by data streams
+	// TimestampField, when set, is added to the documents lacking it with the
+	// RFC3339 time of the entry.
+	TimestampField string
+	Username       string
+	Password       string
+	APIKey         string // sent as "Authorization: ApiKey <APIKey>", wins over Username
+	Headers        map[string]string
+	Gzip           bool
+	Timeout        time.Duration
+	Client         *http.Client
+
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig
+
+	// ErrCallback receives the []*message.Entry that could not be indexed,
+	// with an *ElasticsearchBulkError when the bulk response rejected them.
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *ElasticsearchHandlerConfig) WithURL(url string) *ElasticsearchHandlerConfig {
+	c.URL = url
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithIndex(index string) *ElasticsearchHandlerConfig {
+	c.Index = index
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithOpType(opType string) *ElasticsearchHandlerConfig {
+	c.OpType = opType
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithTimestampField(field string) *ElasticsearchHandlerConfig {
+	c.TimestampField = field
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithBasicAuth(username, password string) *ElasticsearchHandlerConfig {
+	c.Username = username
+	c.Password = password
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithAPIKey(key string) *ElasticsearchHandlerConfig {
+	c.APIKey = key
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithHeader(key, value string) *ElasticsearchHandlerConfig {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithGzip() *ElasticsearchHandlerConfig {
+	c.Gzip = true
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithTimeout(timeout time.Duration) *ElasticsearchHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithClient(client *http.Client) *ElasticsearchHandlerConfig {
+	c.Client = client
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithBatch(config BatchConfig) *ElasticsearchHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithRetry(config RetryConfig) *ElasticsearchHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithBackpressure(config BackpressureConfig) *ElasticsearchHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *ElasticsearchHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *ElasticsearchHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+/*
+================== OTLP ===================
+*/
+
+type OTLPHandlerConfig struct {
+	URL         string // e.g. http://collector:4318, "/v1/logs" is appended when missing
+	Encoding    OTLPEncoding
+	ServiceName string // resource attribute service.name
+	// ResourceAttributes are added to service.name, host.name and process.pid.
+	ResourceAttributes map[string]interface{}
+	Headers            map[string]string
+	Gzip               bool
+	Timeout            time.Duration
+	Client             *http.Client
+
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig
+
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *OTLPHandlerConfig) WithURL(url string) *OTLPHandlerConfig {
+	c.URL = url
+	return c
+}
+func (c *OTLPHandlerConfig) WithEncoding(encoding OTLPEncoding) *OTLPHandlerConfig {
+	c.Encoding = encoding
+	return c
+}
+func (c *OTLPHandlerConfig) WithServiceName(name string) *OTLPHandlerConfig {
+	c.ServiceName = name
+	return c
+}
+func (c *OTLPHandlerConfig) WithResourceAttribute(key string, value interface{}) *OTLPHandlerConfig {
+	if c.ResourceAttributes == nil {
+		c.ResourceAttributes = make(map[string]interface{})
+	}
+	c.ResourceAttributes[key] = value
+	return c
+}
+func (c *OTLPHandlerConfig) WithHeader(key, value string) *OTLPHandlerConfig {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+	return c
+}
+func (c *OTLPHandlerConfig) WithGzip() *OTLPHandlerConfig {
+	c.Gzip = true
+	return c
+}
+func (c *OTLPHandlerConfig) WithTimeout(timeout time.Duration) *OTLPHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *OTLPHandlerConfig) WithClient(client *http.Client) *OTLPHandlerConfig {
+	c.Client = client
+	return c
+}
+func (c *OTLPHandlerConfig) WithBatch(config BatchConfig) *OTLPHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *OTLPHandlerConfig) WithRetry(config RetryConfig) *OTLPHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *OTLPHandlerConfig) WithBackpressure(config BackpressureConfig) *OTLPHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *OTLPHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *OTLPHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+/*
+================== GELF ===================
+*/
+
+type GELFHandlerConfig struct {
+	Network string // "udp" (default) or "tcp"
+	Address string // e.g. graylog:12201
+	Timeout time.Duration
+	// ChunkSize is the largest UDP datagram, 1420 by default; use 8154 in a LAN.
+	ChunkSize int
+	// Compression applies to UDP messages of at least CompressionThreshold bytes.
+	Compression          GELFCompression
+	CompressionThreshold int
+}
+
+func (c *GELFHandlerConfig) WithNetwork(network string) *GELFHandlerConfig {
+	c.Network = network
+	return c
+}
+func (c *GELFHandlerConfig) WithAddress(address string) *GELFHandlerConfig {
+	c.Address = address
+	return c
+}
+func (c *GELFHandlerConfig) WithTimeout(timeout time.Duration) *GELFHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *GELFHandlerConfig) WithChunkSize(size int) *GELFHandlerConfig {
+	c.ChunkSize = size
+	return c
+}
+func (c *GELFHandlerConfig) WithCompression(compression GELFCompression, threshold int) *GELFHandlerConfig {
+	c.Compression = compression
+	c.CompressionThreshold = threshold
+	return c
+}
+
+/*
+================== Fluent ===================
+*/
+
+type FluentHandlerConfig struct {
+	Network string // "tcp" (default) or "unix"
+	Address string // e.g. 127.0.0.1:24224
+	// Tag of the messages, the logger name by default.
+	Tag string
+	// RequireAck sends a chunk id with every message and waits for the server
+	// to acknowledge it; unacknowledged messages are retried.
+	RequireAck bool
+	Timeout    time.Duration // dial, write and ack, default 10s
+	TLSConfig  *tls.Config
+
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig
+
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *FluentHandlerConfig) WithNetwork(network string) *FluentHandlerConfig {
+	c.Network = network
+	return c
+}
+func (c *FluentHandlerConfig) WithAddress(address string) *FluentHandlerConfig {
+	c.Address = address
+	return c
+}
+func (c *FluentHandlerConfig) WithTag(tag string) *FluentHandlerConfig {
+	c.Tag = tag
+	return c
+}
+func (c *FluentHandlerConfig) WithRequireAck() *FluentHandlerConfig {
+	c.RequireAck = true
+	return c
+}
+func (c *FluentHandlerConfig) WithTimeout(timeout time.Duration) *FluentHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *FluentHandlerConfig) WithTLSConfig(config *tls.Config) *FluentHandlerConfig {
+	c.TLSConfig = config
+	return c
+}
+func (c *FluentHandlerConfig) WithBatch(config BatchConfig) *FluentHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *FluentHandlerConfig) WithRetry(config RetryConfig) *FluentHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *FluentHandlerConfig) WithBackpressure(config BackpressureConfig) *FluentHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *FluentHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *FluentHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+type JournaldHandlerConfig struct {
+	// SocketPath is the journal socket, DefaultJournalSocket by default.
+	SocketPath string
+	// Identifier is the SYSLOG_IDENTIFIER, the logger name by default.
+	Identifier string
+	// Severities overrides the PRIORITY of some levels, see formatter.SyslogSeverity.
+	Severities map[level.LogLevel]int
+	// Fields are sent with every entry, e.g. {"DEPLOYMENT": "prod"}.
+	Fields map[string]string
+}
+
+func (c *JournaldHandlerConfig) WithSocketPath(path string) *JournaldHandlerConfig {
+	c.SocketPath = path
+	return c
+}
+func (c *JournaldHandlerConfig) WithIdentifier(identifier string) *JournaldHandlerConfig {
+	c.Identifier = identifier
+	return c
+}
+func (c *JournaldHandlerConfig) WithSeverity(lvl level.LogLevel, severity int) *JournaldHandlerConfig {
+	if c.Severities == nil {
+		c.Severities = make(map[level.LogLevel]int)
+	}
+	c.Severities[lvl] = severity
+	return c
+}
+func (c *JournaldHandlerConfig) WithField(key, value string) *JournaldHandlerConfig {
+	if c.Fields == nil {
+		c.Fields = make(map[string]string)
+	}
+	c.Fields[key] = value
+	return c
+}
+
+type RingHandlerConfig struct {
+	MaxEntries int // 5000 by default
+	// MaxBytes bounds the size of the held entries, formatted, when positive.
+	MaxBytes int
+	// SubscriberBuffer is the number of entries queued for a live stream, the
+	// stream missing entries beyond; 256 by default.
+	SubscriberBuffer int
+}
+
+func (c *RingHandlerConfig) WithMaxEntries(n int) *RingHandlerConfig {
+	c.MaxEntries = n
+	return c
+}
+func (c *RingHandlerConfig) WithMaxBytes(n int) *RingHandlerConfig {
+	c.MaxBytes = n
+	return c
+}
+func (c *RingHandlerConfig) WithSubscriberBuffer(n int) *RingHandlerConfig {
+	c.SubscriberBuffer = n
+	return c
+}
+
+/*
+================== webhook ===================
+*/
+
+type WebhookHandlerConfig struct {
+	URL     string
+	Headers map[string]string
+	// Template renders the JSON body of an alert from a WebhookAlert, with
+	// text/template and a "json" function quoting a value; WebhookTemplateSlack
+	// by default.
+	Template   string
+	LoggerName string
+	// GroupWindow is the time during which the repeats of an alert (same level
+	// and message) are counted instead of sent, 1 minute by default. A summary
+	// with their number is sent when it ends.
+	GroupWindow time.Duration
+	// MaxPerMinute caps the alerts and summaries sent in any minute, 10 by
+	// default; the number of alerts left out is reported in the next one.
+	MaxPerMinute int
+	Timeout      time.Duration // per request, default 10s; ignored with Client
+	Client       *http.Client
+	Clock        IClock // time source of the windows, defaults to the system clock.
+
+	Retry        RetryConfig
+	Backpressure BackpressureConfig // default Block
+
+	// ErrCallback receives the []*message.Entry of an alert that could not be delivered.
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *WebhookHandlerConfig) WithURL(url string) *WebhookHandlerConfig {
+	c.URL = url
+	return c
+}
+func (c *WebhookHandlerConfig) WithHeader(key, value string) *WebhookHandlerConfig {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+	return c
+}
+func (c *WebhookHandlerConfig) WithTemplate(template string) *WebhookHandlerConfig {
+	c.Template = template
+	return c
+}
+func (c *WebhookHandlerConfig) WithLoggerName(name string) *WebhookHandlerConfig {
+	c.LoggerName = name
+	return c
+}
+func (c *WebhookHandlerConfig) WithGroupWindow(window time.Duration) *WebhookHandlerConfig {
+	c.GroupWindow = window
+	return c
+}
+func (c *WebhookHandlerConfig) WithMaxPerMinute(n int) *WebhookHandlerConfig {
+	c.MaxPerMinute = n
+	return c
+}
+func (c *WebhookHandlerConfig) WithTimeout(timeout time.Duration) *WebhookHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *WebhookHandlerConfig) WithClient(client *http.Client) *WebhookHandlerConfig {
+	c.Client = client
+	return c
+}
+func (c *WebhookHandlerConfig) WithClock(clock IClock) *WebhookHandlerConfig {
+	c.Clock = clock
+	return c
+}
+func (c *WebhookHandlerConfig) WithRetry(config RetryConfig) *WebhookHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *WebhookHandlerConfig) WithBackpressure(config BackpressureConfig) *WebhookHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *WebhookHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *WebhookHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
+
+/*
+================== SMTP ===================
+*/
+
+type SMTPHandlerConfig struct {
+	Address  string // host:port of the mail relay
+	Username string // PLAIN authentication when set, which needs TLS or localhost
+	Password string
+	From     string
+	To       []string
+	// Subject renders the subject of a digest from an SMTPDigest with
+	// text/template, DefaultSMTPSubject by default.
+	Subject    string
+	LoggerName string
+	// ImplicitTLS connects with TLS (port 465), otherwise STARTTLS is used
+	// when the server offers it.
+	ImplicitTLS bool
+	// RequireTLS fails the delivery when the server does not offer STARTTLS.
+	RequireTLS bool
+	TLSConfig  *tls.Config
+	Timeout    time.Duration // of a delivery, default 30s
+
+	// Batch bounds a digest: it is sent when it holds MaxCount entries or
+	// MaxBytes formatted bytes, or when its oldest entry is MaxAge old.
+	Batch        BatchConfig
+	Retry        RetryConfig
+	Backpressure BackpressureConfig // default Block
+
+	// ErrCallback receives the []*message.Entry of a digest that could not be delivered.
+	ErrCallback func(buf interface{}, err error)
+}
+
+func (c *SMTPHandlerConfig) WithAddress(address string) *SMTPHandlerConfig {
+	c.Address = address
+	return c
+}
+func (c *SMTPHandlerConfig) WithAuth(username, password string) *SMTPHandlerConfig {
+	c.Username = username
+	c.Password = password
+	return c
+}
+func (c *SMTPHandlerConfig) WithFrom(from string) *SMTPHandlerConfig {
+	c.From = from
+	return c
+}
+func (c *SMTPHandlerConfig) WithTo(to ...string) *SMTPHandlerConfig {
+	c.To = append(c.To, to...)
+	return c
+}
+func (c *SMTPHandlerConfig) WithSubject(subject string) *SMTPHandlerConfig {
+	c.Subject = subject
+	return c
+}
+func (c *SMTPHandlerConfig) WithLoggerName(name string) *SMTPHandlerConfig {
+	c.LoggerName = name
+	return c
+}
+func (c *SMTPHandlerConfig) WithImplicitTLS() *SMTPHandlerConfig {
+	c.ImplicitTLS = true
+	return c
+}
+func (c *SMTPHandlerConfig) WithRequireTLS() *SMTPHandlerConfig {
+	c.RequireTLS = true
+	return c
+}
+func (c *SMTPHandlerConfig) WithTLSConfig(config *tls.Config) *SMTPHandlerConfig {
+	c.TLSConfig = config
+	return c
+}
+func (c *SMTPHandlerConfig) WithTimeout(timeout time.Duration) *SMTPHandlerConfig {
+	c.Timeout = timeout
+	return c
+}
+func (c *SMTPHandlerConfig) WithBatch(config BatchConfig) *SMTPHandlerConfig {
+	c.Batch = config
+	return c
+}
+func (c *SMTPHandlerConfig) WithRetry(config RetryConfig) *SMTPHandlerConfig {
+	c.Retry = config
+	return c
+}
+func (c *SMTPHandlerConfig) WithBackpressure(config BackpressureConfig) *SMTPHandlerConfig {
+	c.Backpressure = config
+	return c
+}
+func (c *SMTPHandlerConfig) WithErrCallback(cb func(buf interface{}, err error)) *SMTPHandlerConfig {
+	c.ErrCallback = cb
+	return c
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The files of ConcurrentlyWrite are never closed for good, other processes
+// may still write to them after the rotation.
+var errCompressConcurrentlyWrite = errors.New("file handler: Compression cannot be used with ConcurrentlyWrite")
+
+// ICompressor compresses rotated backup files. Implementations for formats
+// outside the standard library (zstd, xz, ...) can be plugged in through
+// FileHandlerConfig.Compression.
+type ICompressor interface {
+	// Extension is appended to the name of the compressed file, e.g. ".gz".
+	Extension() string
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+type GzipCompressor struct {
+	Level int
+}
+
+var _ ICompressor = &GzipCompressor{}
+
+// NewGzipCompressor returns a gzip compressor; level is one of the compress/gzip levels.
+func NewGzipCompressor(level int) *GzipCompressor {
+	return &GzipCompressor{Level: level}
+}
+
+func (c *GzipCompressor) Extension() string {
+	return ".gz"
+}
+
+func (c *GzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	lvl := c.Level
+	if lvl == 0 {
+		lvl = gzip.DefaultCompression
+	}
+	zw, err := gzip.NewWriterLevel(dst, lvl)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// backupCompressor compresses rotated files one by one in a background goroutine.
+// The rotators rename and remove the scheduled files through move and remove,
+// so that a compression still pending follows its file instead of being
+// waited for.
+type backupCompressor struct {
+	compressor  ICompressor
+	errCallback func(buf interface{}, err error)
+	queue       chan *compressJob
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	mu   sync.Mutex
+	jobs map[string]*compressJob // by the current path of their file
+}
+
+// compressJob is a file scheduled for compression.
+type compressJob struct {
+	path    string // "" once the file has been removed
+	running bool
+	done    chan struct{}
+}
+
+func newBackupCompressor(c ICompressor, errCallback func(buf interface{}, err error)) *backupCompressor {
+	bc := &backupCompressor{
+		compressor:  c,
+		errCallback: errCallback,
+		queue:       make(chan *compressJob, 64),
+		done:        make(chan struct{}),
+		jobs:        make(map[string]*compressJob),
+	}
+	go bc.run()
+	return bc
+}
+
+func (bc *backupCompressor) run() {
+	defer close(bc.done)
+	for job := range bc.queue {
+		if path, err := bc.compressFile(job); err != nil && bc.errCallback != nil {
+			bc.errCallback(path, err)
+		}
+		close(job.done)
+	}
+}
+
+// extension returns the extension of the compressed files, "" when bc is nil.
+func (bc *backupCompressor) extension() string {
+	if bc == nil {
+		return ""
+	}
+	return bc.compressor.Extension()
+}
+
+// add schedules path for compression.
+func (bc *backupCompressor) add(path string) {
+	if bc == nil {
+		return
+	}
+	job := &compressJob{path: path, done: make(chan struct{})}
+	bc.mu.Lock()
+	bc.jobs[path] = job
+	bc.mu.Unlock()
+	bc.queue <- job
+}
+
+// move renames src to dst, a compression pending on src then writes dst.
+func (bc *backupCompressor) move(src, dst string) error {
+	if bc == nil {
+		return os.Rename(src, dst)
+	}
+	bc.mu.Lock()
+	err := os.Rename(src, dst)
+	job, ok := bc.jobs[src]
+	if err == nil {
+		if ok {
+			delete(bc.jobs, src)
+			job.path = dst
+			bc.jobs[dst] = job
+		}
+		bc.mu.Unlock()
+		return nil
+	}
+	bc.mu.Unlock()
+	if ok && job.running {
+		return bc.waitRunning(job, src, err)
+	}
+	return bc.compressedMeanwhile(src, err)
+}
+
+// remove removes path, dropping a compression pending on it.
+func (bc *backupCompressor) remove(path string) error {
+	if bc == nil {
+		return os.Remove(path)
+	}
+	bc.mu.Lock()
+	err := os.Remove(path)
+	job, ok := bc.jobs[path]
+	if err == nil {
+		if ok {
+			delete(bc.jobs, path)
+			job.path = ""
+		}
+		bc.mu.Unlock()
+		return nil
+	}
+	bc.mu.Unlock()
+	if ok && job.running {
+		return bc.waitRunning(job, path, err)
+	}
+	return bc.compressedMeanwhile(path, err)
+}
+
+// compressedMeanwhile ignores the error of a path the compression replaced by
+// path+ext since the caller saw it, the caller handling path+ext next.
+func (bc *backupCompressor) compressedMeanwhile(path string, err error) error {
+	if os.IsNotExist(err) && IsFileExist(path+bc.compressor.Extension()) {
+		return nil
+	}
+	return err
+}
+
+// waitRunning handles the platforms that do not rename or remove open files:
+// it waits for the compression of path to end, path being replaced by
+// path+ext, which the caller handles next.
+func (bc *backupCompressor) waitRunning(job *compressJob, path string, err error) error {
+	<-job.done
+	if IsFileExist(path) {
+		return err
+	}
+	return nil
+}
+
+// close finishes the scheduled compressions and stops the goroutine.
+func (bc *backupCompressor) close() {
+	if bc == nil {
+		return
+	}
+	bc.closeOnce.Do(func() {
+		close(bc.queue)
+		<-bc.done
+	})
+}
+
+// compressFile writes the file of job to its path+ext through a temporary file
+// and removes it on success. The path is read again when done, the file may
+// have been moved or removed meanwhile.
+func (bc *backupCompressor) compressFile(job *compressJob) (string, error) {
+	bc.mu.Lock()
+	path := job.path
+	if path == "" {
+		bc.mu.Unlock()
+		return path, nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		delete(bc.jobs, path)
+		bc.mu.Unlock()
+		return path, err
+	}
+	job.running = true
+	bc.mu.Unlock()
+
+	tmp := path + bc.compressor.Extension() + ".tmp"
+	err = bc.compressTo(tmp, src)
+	_ = src.Close()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	path = job.path
+	if path != "" {
+		delete(bc.jobs, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return path, err
+	}
+	if path == "" {
+		// Removed by the rotation.
+		return path, os.Remove(tmp)
+	}
+	if err = os.Rename(tmp, path+bc.compressor.Extension()); err != nil {
+		_ = os.Remove(tmp)
+		return path, err
+	}
+	// The source may already be gone if the retention cleanup removed it.
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return path, err
+	}
+	return path, nil
+}
+
+func (bc *backupCompressor) compressTo(tmp string, src *os.File) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err = bc.compressor.Compress(out, src); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("compress %s: %w", src.Name(), err)
+	}
+	return out.Close()
+}
+
+// trimCompressedExt strips ext from name, ok reports whether it was present.
+func trimCompressedExt(name, ext string) (string, bool) {
+	if ext == "" || !strings.HasSuffix(name, ext) {
+		return name, false
+	}
+	return strings.TrimSuffix(name, ext), true
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSizeRotatorCompressesBackups(t *testing.T) {
+	dir := t.TempDir()
+	cfg := (&FileHandlerConfig{
+		FileDir:     dir,
+		FileName:    "gz",
+		FileSuffix:  "log",
+		MaxFileSize: 1 << 20,
+		BackupCount: 2,
+	}).WithGzipCompression()
+	r, err := NewSizeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"first\n", "second\n", "third\n"} {
+		f, _, err := r.NeedRollover(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = r.DoRollover(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(dir, "gz.log")
+	if got := readGzip(t, base+".1.gz"); got != "third\n" {
+		t.Fatalf(".1.gz = %q", got)
+	}
+	if got := readGzip(t, base+".2.gz"); got != "second\n" {
+		t.Fatalf(".2.gz = %q", got)
+	}
+	for _, name := range []string{base + ".1", base + ".3.gz"} {
+		if IsFileExist(name) {
+			t.Fatalf("%s must not exist", name)
+		}
+	}
+}
+
+func TestCollectRotatedBackupPathsCompressed(t *testing.T) {
+	dir := t.TempDir()
+	re := regexp.MustCompile(`^\d{10}$`)
+	for _, name := range []string{"app.log.2024061101", "app.log.2024061102.gz", "app.log.2024061103.gz.tmp"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := collectRotatedBackupPaths(dir, "app.log", re, ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("paths = %v, want the plain and the .gz backup", paths)
+	}
+}
+
+// blockingCompressor holds its first compression until release is closed.
+type blockingCompressor struct {
+	GzipCompressor
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (c *blockingCompressor) Compress(dst io.Writer, src io.Reader) error {
+	c.once.Do(func() {
+		close(c.started)
+		<-c.release
+	})
+	return c.GzipCompressor.Compress(dst, src)
+}
+
+// The rollovers shift the backups under a compression still running.
+func TestSizeRotatorRolloverDoesNotWaitForCompression(t *testing.T) {
+	dir := t.TempDir()
+	c := &blockingCompressor{started: make(chan struct{}), release: make(chan struct{})}
+	cfg := (&FileHandlerConfig{
+		FileDir:     dir,
+		FileName:    "gz",
+		FileSuffix:  "log",
+		MaxFileSize: 1 << 20,
+		BackupCount: 2,
+	}).WithCompression(c)
+	r, err := NewSizeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		f, _, err := r.NeedRollover(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = r.DoRollover(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			<-c.started
+		}
+	}
+	close(c.release)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(dir, "gz.log")
+	if got := readGzip(t, base+".1.gz"); got != "fourth\n" {
+		t.Fatalf(".1.gz = %q", got)
+	}
+	if got := readGzip(t, base+".2.gz"); got != "third\n" {
+		t.Fatalf(".2.gz = %q", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("files = %v, want gz.log and two backups", names)
+	}
+}
+
+func TestFileHandlerRejectsCompressionWithConcurrentlyWrite(t *testing.T) {
+	cfg := (&FileHandlerConfig{
+		FileDir:     t.TempDir(),
+		FileName:    "gz",
+		FileSuffix:  "log",
+		RotatorType: FileRotatorTypeTimeAndSize,
+		ReMatch:     `^\d{10}(\.\w+)?$`,
+	}).WithConcurrentlyWrite().WithGzipCompression()
+	if _, err := NewFileHandler(cfg, nil, nil); err != errCompressConcurrentlyWrite {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := NewTimeAndSizeRotator(cfg); err != errCompressConcurrentlyWrite {
+		t.Fatalf("rotator err = %v", err)
+	}
+}
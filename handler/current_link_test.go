@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCurrentLinkFollowsRollover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2024, 6, 12, 23, 59, 0, 0, time.UTC)}
+	cfg := &FileHandlerConfig{
+		FileDir:           dir,
+		FileName:          "cur",
+		FileSuffix:        "log",
+		TimeSuffixFmt:     "2006010215",
+		ReMatch:           `^\d{10}$`,
+		Schedule:          HourlySchedule(time.UTC),
+		Clock:             clock,
+		ConcurrentlyWrite: true,
+		CurrentLink:       "cur.log.current",
+	}
+	r, err := NewTimeAndSizeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	link := filepath.Join(dir, "cur.log.current")
+	if _, _, err = r.NeedRollover(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(link); err != nil || got != "cur.2024061223.log" {
+		t.Fatalf("link = %q, %v", got, err)
+	}
+
+	clock.Set(time.Date(2024, 6, 13, 0, 0, 1, 0, time.UTC))
+	if _, err = r.DoRollover(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(link); err != nil || got != "cur.2024061300.log" {
+		t.Fatalf("link after rollover = %q, %v", got, err)
+	}
+	if _, err = os.Stat(link); err != nil {
+		t.Fatalf("link does not resolve: %v", err)
+	}
+}
+
+func TestFileAndDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+	dir := filepath.Join(t.TempDir(), "sub")
+	cfg := &FileHandlerConfig{
+		FileDir:    dir,
+		FileName:   "perm",
+		FileSuffix: "log",
+		FileMode:   0o640,
+		DirMode:    0o750,
+	}
+	r, err := NewSizeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	if _, _, err = r.NeedRollover(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := st.Mode().Perm(); perm != 0o750 {
+		t.Fatalf("dir mode = %o", perm)
+	}
+	st, err = os.Stat(filepath.Join(dir, "perm.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := st.Mode().Perm(); perm != 0o640 {
+		t.Fatalf("file mode = %o", perm)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ml444/glog/level"
+)
+
+// SyncPolicy decides when FileHandler fsyncs the file besides rollover, Sync and Close.
+type SyncPolicy int8
+
+const (
+	SyncPolicyNever SyncPolicy = iota
+	// SyncPolicyBytes fsyncs once DurabilityConfig.Bytes were written since the last fsync.
+	SyncPolicyBytes
+	// SyncPolicyInterval fsyncs every DurabilityConfig.Interval when something was written.
+	SyncPolicyInterval
+	// SyncPolicyLevel fsyncs before Emit returns for entries at or above DurabilityConfig.Level.
+	SyncPolicyLevel
+)
+
+type DurabilityConfig struct {
+	Policy   SyncPolicy
+	Bytes    int64
+	Interval time.Duration
+	Level    level.LogLevel
+}
+
+func NewDurabilityConfig(policy SyncPolicy) DurabilityConfig {
+	return DurabilityConfig{Policy: policy}
+}
+
+func (c DurabilityConfig) WithBytes(n int64) DurabilityConfig {
+	c.Bytes = n
+	return c
+}
+
+func (c DurabilityConfig) WithInterval(interval time.Duration) DurabilityConfig {
+	c.Interval = interval
+	return c
+}
+
+func (c DurabilityConfig) WithLevel(lvl level.LogLevel) DurabilityConfig {
+	c.Level = lvl
+	return c
+}
+
+func (c DurabilityConfig) Normalize() DurabilityConfig {
+	if c.Policy == SyncPolicyBytes && c.Bytes <= 0 {
+		c.Bytes = 1 << 20
+	}
+	if c.Policy == SyncPolicyInterval && c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	return c
+}
+
+type SyncStats struct {
+	Syncs        uint64
+	Failures     uint64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	LastLatency  time.Duration
+}
+
+// AvgLatency is the mean latency of the fsyncs, failed ones included.
+func (s SyncStats) AvgLatency() time.Duration {
+	if s.Syncs == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Syncs)
+}
+
+type SyncCounter struct {
+	syncs    uint64
+	failures uint64
+	total    int64
+	max      int64
+	last     int64
+}
+
+func (c *SyncCounter) Observe(d time.Duration, err error) {
+	atomic.AddUint64(&c.syncs, 1)
+	if err != nil {
+		atomic.AddUint64(&c.failures, 1)
+	}
+	atomic.AddInt64(&c.total, int64(d))
+	atomic.StoreInt64(&c.last, int64(d))
+	for {
+		cur := atomic.LoadInt64(&c.max)
+		if int64(d) <= cur || atomic.CompareAndSwapInt64(&c.max, cur, int64(d)) {
+			return
+		}
+	}
+}
+
+func (c *SyncCounter) Snapshot() SyncStats {
+	return SyncStats{
+		Syncs:        atomic.LoadUint64(&c.syncs),
+		Failures:     atomic.LoadUint64(&c.failures),
+		TotalLatency: time.Duration(atomic.LoadInt64(&c.total)),
+		MaxLatency:   time.Duration(atomic.LoadInt64(&c.max)),
+		LastLatency:  time.Duration(atomic.LoadInt64(&c.last)),
+	}
+}
+
+type SyncStatsProvider interface {
+	SyncStats() SyncStats
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func newDurableFileHandler(t *testing.T, durability DurabilityConfig) (*FileHandler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := (&FileHandlerConfig{
+		FileDir:       dir,
+		FileName:      "d",
+		FileSuffix:    "log",
+		BufferSize:    64,
+		BulkWriteSize: 256,
+		RotatorType:   FileRotatorTypeSize,
+	}).WithDurability(durability).WithBackpressureStrategy(BackpressureStrategyBlock)
+	h, err := NewFileHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h, filepath.Join(dir, "d.log")
+}
+
+func messageFormatter() formatter.IFormatter {
+	return formatter.NewTextFormatter(formatter.TextFormatterConfig{
+		BaseFormatterConfig: formatter.BaseFormatterConfig{TimeLayout: "2006-01-02 15:04:05"},
+		PatternStyle:        "%[Message]v",
+	})
+}
+
+func emitLevel(t *testing.T, h *FileHandler, lvl level.LogLevel, msg string) {
+	t.Helper()
+	if err := h.Emit(&message.Entry{Message: msg, Level: lvl, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncPolicyBytes(t *testing.T) {
+	h, _ := newDurableFileHandler(t, NewDurabilityConfig(SyncPolicyBytes).WithBytes(16))
+	for i := 0; i < 10; i++ {
+		emitLevel(t, h, level.InfoLevel, "0123456789")
+		if err := h.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 11 bytes per line: every second line crosses the 16 bytes budget.
+	if got := h.SyncStats().Syncs; got != 5 {
+		t.Fatalf("syncs = %d, want 5", got)
+	}
+}
+
+func TestSyncPolicyLevel(t *testing.T) {
+	h, path := newDurableFileHandler(t, NewDurabilityConfig(SyncPolicyLevel).WithLevel(level.ErrorLevel))
+	emitLevel(t, h, level.InfoLevel, "info")
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.SyncStats().Syncs; got != 0 {
+		t.Fatalf("syncs after info = %d", got)
+	}
+
+	emitLevel(t, h, level.ErrorLevel, "error")
+	stats := h.SyncStats()
+	if stats.Syncs != 1 || stats.Failures != 0 {
+		t.Fatalf("stats after error = %+v", stats)
+	}
+	if stats.MaxLatency <= 0 || stats.AvgLatency() <= 0 {
+		t.Fatalf("latency not recorded: %+v", stats)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "info\nerror\n" {
+		t.Fatalf("file = %q", data)
+	}
+}
+
+func TestSyncPolicyInterval(t *testing.T) {
+	h, _ := newDurableFileHandler(t, NewDurabilityConfig(SyncPolicyInterval).WithInterval(5*time.Millisecond))
+	emitLevel(t, h, level.InfoLevel, "tick")
+	deadline := time.Now().Add(2 * time.Second)
+	for h.SyncStats().Syncs == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no interval sync")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Nothing new written: the ticker must not fsync again.
+	syncs := h.SyncStats().Syncs
+	time.Sleep(30 * time.Millisecond)
+	if got := h.SyncStats().Syncs; got != syncs {
+		t.Fatalf("idle syncs: %d -> %d", syncs, got)
+	}
+}
+
+type failingSyncRotator struct {
+	IRotator
+}
+
+func (r failingSyncRotator) Sync() error {
+	return errors.New("sync failed")
+}
+
+func TestSyncFailureGoesToErrCallback(t *testing.T) {
+	dir := t.TempDir()
+	rotator, err := NewSizeRotator(&FileHandlerConfig{FileDir: dir, FileName: "d", FileSuffix: "log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var errs []error
+	h := &FileHandler{
+		formatter:     messageFormatter(),
+		rotator:       failingSyncRotator{rotator},
+		bulkWriteSize: 256,
+		backpressure:  NewBackpressureConfig(BackpressureStrategyBlock),
+		durability:    NewDurabilityConfig(SyncPolicyBytes).WithBytes(1).Normalize(),
+		bufChan:       make(chan []byte, 8),
+		flushChan:     make(chan flushRequest),
+		doneChan:      make(chan struct{}),
+		workerDone:    make(chan struct{}),
+		ErrorCallback: func(_ interface{}, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	}
+	go h.flushWorker()
+	defer func() { _ = h.Close() }()
+
+	emitLevel(t, h, level.InfoLevel, "x")
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || errs[0].Error() != "sync failed" {
+		t.Fatalf("errs = %v", errs)
+	}
+	if stats := h.SyncStats(); stats.Syncs != 1 || stats.Failures != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/message"
+)
+
+const elasticsearchBulkPath = "/_bulk"
+
+// ElasticsearchItemError is the error of one item of a bulk response.
+type ElasticsearchItemError struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ElasticsearchItemError) Error() string {
+	return fmt.Sprintf("bulk item status %d: %s: %s", e.Status, e.Type, e.Reason)
+}
+
+// Temporary reports whether the item is worth retrying: 429 and 5xx.
+func (e *ElasticsearchItemError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// ElasticsearchBulkError sums up the failed items of a bulk request.
+type ElasticsearchBulkError struct {
+	Failed int
+	Total  int
+	First  *ElasticsearchItemError
+}
+
+func (e *ElasticsearchBulkError) Error() string {
+	return fmt.Sprintf("elasticsearch bulk: %d of %d items failed, first: %v", e.Failed, e.Total, e.First)
+}
+
+// ElasticsearchHandler indexes the entries into Elasticsearch or OpenSearch
+// with the _bulk API. The formatter should produce JSON objects (see
+// JSONFormatter); other output is indexed as {"message": "..."}.
+type ElasticsearchHandler struct {
+	cfg       ElasticsearchHandlerConfig
+	client    *http.Client
+	url       string
+	headers   map[string]string
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+	sender    *batchSender
+}
+
+func NewElasticsearchHandler(cfg *ElasticsearchHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*ElasticsearchHandler, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("elasticsearch handler: URL is required")
+	}
+	if cfg.Index == "" {
+		return nil, errors.New("elasticsearch handler: Index is required")
+	}
+	h := &ElasticsearchHandler{
+		cfg:       *cfg,
+		client:    httpClient(cfg.Client, cfg.Timeout),
+		url:       cfg.URL,
+		headers:   make(map[string]string, len(cfg.Headers)+1),
+		formatter: fm,
+		filter:    ft,
+	}
+	switch h.cfg.OpType {
+	case "":
+		h.cfg.OpType = "index"
+	case "index", "create":
+	default:
+		return nil, fmt.Errorf("elasticsearch handler: unsupported OpType %q", cfg.OpType)
+	}
+	if !strings.HasSuffix(h.url, elasticsearchBulkPath) {
+		h.url = strings.TrimSuffix(h.url, "/") + elasticsearchBulkPath
+	}
+	for k, v := range cfg.Headers {
+		h.headers[k] = v
+	}
+	switch {
+	case cfg.APIKey != "":
+		h.headers["Authorization"] = "ApiKey " + cfg.APIKey
+	case cfg.Username != "":
+		h.headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.Username+":"+cfg.Password))
+	}
+	h.sender = newBatchSender(cfg.Batch, cfg.Retry, cfg.Backpressure, h.send, cfg.ErrCallback)
+	return h, nil
+}
+
+func (h *ElasticsearchHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	if h.formatter == nil {
+		return errors.New("formatter is nil")
+	}
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: bytes.TrimRight(data, "\n")})
+}
+
+// index expands the time layout between braces in the Index pattern with the
+// UTC time of e, e.g. "glog-{2006.01.02}" becomes "glog-2024.05.17".
+func (h *ElasticsearchHandler) index(e *message.Entry) string {
+	pattern := h.cfg.Index
+	start := strings.IndexByte(pattern, '{')
+	if start < 0 {
+		return pattern
+	}
+	end := strings.IndexByte(pattern[start:], '}')
+	if end < 0 {
+		return pattern
+	}
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return pattern[:start] + t.UTC().Format(pattern[start+1:start+end]) + pattern[start+end+1:]
+}
+
+// encode renders the bulk request body: an action line and a document line
+// per item.
+func (h *ElasticsearchHandler) encode(items []batchItem) []byte {
+	var buf bytes.Buffer
+	for _, it := range items {
+		action, _ := json.Marshal(map[string]map[string]string{
+			h.cfg.OpType: {"_index": h.index(it.entry)},
+		})
+		buf.Write(action)
+		buf.WriteByte('\n')
+		h.writeDocument(&buf, it)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (h *ElasticsearchHandler) writeDocument(buf *bytes.Buffer, it batchItem) {
+	// Compacted, as pretty printed documents would break the NDJSON framing.
+	var doc bytes.Buffer
+	data := bytes.TrimSpace(it.data)
+	if len(data) == 0 || data[0] != '{' || json.Compact(&doc, data) != nil {
+		doc.Reset()
+		wrapped, _ := json.Marshal(map[string]string{"message": string(data)})
+		doc.Write(wrapped)
+	}
+	data = doc.Bytes()
+	field := h.cfg.TimestampField
+	if field == "" || bytes.Contains(data, []byte(`"`+field+`":`)) {
+		buf.Write(data)
+		return
+	}
+	key, _ := json.Marshal(field)
+	ts, _ := json.Marshal(it.entry.Time.UTC().Format(time.RFC3339Nano))
+	buf.WriteByte('{')
+	buf.Write(key)
+	buf.WriteByte(':')
+	buf.Write(ts)
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                                     `json:"errors"`
+	Items  []map[string]elasticsearchBulkItemResult `json:"items"`
+}
+
+type elasticsearchBulkItemResult struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (h *ElasticsearchHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	req := httpRequest{
+		url:         h.url,
+		contentType: "application/x-ndjson",
+		headers:     h.headers,
+		body:        h.encode(items),
+		gzip:        h.cfg.Gzip,
+	}
+	body, err := req.do(ctx, h.client)
+	if err != nil {
+		if retryable(err) {
+			return items, err
+		}
+		return nil, err
+	}
+	var resp elasticsearchBulkResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("elasticsearch bulk: decode response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(items) {
+		return items, fmt.Errorf("elasticsearch bulk: %d results for %d items", len(resp.Items), len(items))
+	}
+	var retry, failed []batchItem
+	var retryErr, failedErr *ElasticsearchBulkError
+	for i, result := range resp.Items {
+		for _, r := range result {
+			if r.Status >= 200 && r.Status <= 299 {
+				continue
+			}
+			itemErr := &ElasticsearchItemError{Status: r.Status}
+			if r.Error != nil {
+				itemErr.Type, itemErr.Reason = r.Error.Type, r.Error.Reason
+			}
+			if itemErr.Temporary() {
+				retry = append(retry, items[i])
+				retryErr = addElasticsearchItemError(retryErr, itemErr, len(items))
+			} else {
+				failed = append(failed, items[i])
+				failedErr = addElasticsearchItemError(failedErr, itemErr, len(items))
+			}
+		}
+	}
+	switch {
+	case len(failed) == 0 && len(retry) == 0:
+		return nil, nil
+	case len(failed) == 0:
+		return retry, retryErr
+	case len(retry) == 0:
+		return nil, &batchPartialError{failed: failed, failedErr: failedErr, err: failedErr}
+	default:
+		return retry, &batchPartialError{failed: failed, failedErr: failedErr, err: retryErr}
+	}
+}
+
+func addElasticsearchItemError(bulkErr *ElasticsearchBulkError, itemErr *ElasticsearchItemError, total int) *ElasticsearchBulkError {
+	if bulkErr == nil {
+		bulkErr = &ElasticsearchBulkError{Total: total, First: itemErr}
+	}
+	bulkErr.Failed++
+	return bulkErr
+}
+
+// Flush waits until the entries emitted before the call have been indexed or
+// given up on, and returns the last delivery error.
+func (h *ElasticsearchHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *ElasticsearchHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close indexes what is still queued, retries included.
+func (h *ElasticsearchHandler) Close() error {
+	h.sender.close()
+	return nil
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func TestElasticsearchHandlerBulkBody(t *testing.T) {
+	var mu sync.Mutex
+	var path, auth, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		path, auth, body = r.URL.Path, r.Header.Get("Authorization"), string(data)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}},{"create":{"status":201}}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := (&ElasticsearchHandlerConfig{URL: srv.URL}).
+		WithIndex("app-{2006.01.02}").
+		WithOpType("create").
+		WithTimestampField("@timestamp").
+		WithAPIKey("secret").
+		WithRetry(fastRetry())
+	fm := formatter.NewJSONFormatter(formatter.JSONFormatterConfig{PrettyPrint: true})
+	h, err := NewElasticsearchHandler(cfg, fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	day := time.Date(2024, 5, 17, 23, 30, 0, 0, time.FixedZone("x", -3600))
+	_ = h.Emit(&message.Entry{Message: "a", Level: level.InfoLevel, Time: day})
+	_ = h.Emit(&message.Entry{Message: "b", Level: level.WarnLevel, Time: day.Add(time.Hour)})
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/_bulk" || auth != "ApiKey secret" {
+		t.Fatalf("path = %q, auth = %q", path, auth)
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("body = %q", body)
+	}
+	if lines[0] != `{"create":{"_index":"app-2024.05.18"}}` || lines[2] != `{"create":{"_index":"app-2024.05.18"}}` {
+		t.Fatalf("actions = %q, %q", lines[0], lines[2])
+	}
+	var doc map[string]interface{}
+	if err = json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatalf("%v: %q", err, lines[1])
+	}
+	if doc["msg"] != "a" || doc["@timestamp"] != "2024-05-18T00:30:00Z" {
+		t.Fatalf("doc = %v", doc)
+	}
+}
+
+// The defaults are set on a copy of the config, which may be shared.
+func TestElasticsearchHandlerKeepsConfig(t *testing.T) {
+	cfg := (&ElasticsearchHandlerConfig{URL: "http://localhost:9200"}).WithIndex("app")
+	h, err := NewElasticsearchHandler(cfg, formatter.NewJSONFormatter(formatter.JSONFormatterConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	if h.cfg.OpType != "index" || cfg.OpType != "" {
+		t.Fatalf("OpType = %q, caller's = %q", h.cfg.OpType, cfg.OpType)
+	}
+}
+
+func TestElasticsearchHandlerRetriesFailedItems(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		n := len(bodies)
+		mu.Unlock()
+		if n == 1 {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[
+				{"index":{"status":201}},
+				{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad field"}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer srv.Close()
+
+	var reported []*message.Entry
+	var reportedErr error
+	cfg := (&ElasticsearchHandlerConfig{URL: srv.URL, Index: "logs"}).
+		WithRetry(fastRetry()).
+		WithErrCallback(func(buf interface{}, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, buf.([]*message.Entry)...)
+			reportedErr = err
+		})
+	h, err := NewElasticsearchHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	emitN(t, h, 3)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || !strings.Contains(bodies[1], `{"message":"m1"}`) || strings.Contains(bodies[1], "m0") || strings.Contains(bodies[1], "m2") {
+		t.Fatalf("bodies = %q", bodies)
+	}
+	var bulkErr *ElasticsearchBulkError
+	if len(reported) != 1 || reported[0].Message != "m2" || !errors.As(reportedErr, &bulkErr) || bulkErr.First.Type != "mapper_parsing_exception" {
+		t.Fatalf("reported = %v, err = %v", reported, reportedErr)
+	}
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/ml444/glog/filter"
 	"github.com/ml444/glog/formatter"
@@ -17,17 +20,27 @@ const (
 	FileRotatorTypeTime        RotatorType = 1
 	FileRotatorTypeSize        RotatorType = 2
 	FileRotatorTypeTimeAndSize RotatorType = 3
+	// FileRotatorTypeExternal leaves rotation to an external tool such as logrotate.
+	FileRotatorTypeExternal RotatorType = 4
 )
 
 type FileHandler struct {
 	formatter formatter.IFormatter
 	filter    filter.IFilter
 	rotator   IRotator
+	watcher   *externalRotationWatcher
+	procLock  *processLock
 
 	bulkWriteSize int
 	backpressure  BackpressureConfig
 	stats         BackpressureCounter
+	durability    DurabilityConfig
+	syncStats     SyncCounter
+	unsynced      int64 // bytes written since the last fsync, owned by flushWorker
+	spill         *SpillQueue
+	replayDone    chan struct{}
 	bufChan    chan []byte
+	flushChan  chan flushRequest
 	doneChan   chan struct{}
 	workerDone chan struct{}
 	closeOnce  sync.Once
@@ -40,35 +53,94 @@ func NewFileHandler(cfg *FileHandlerConfig, fm formatter.IFormatter, ft filter.I
 	// in order to preserve the panic information during panic.
 	// rewriteStderr(handlerCfg.File.FileDir, config.GlobalConfig.LoggerName)
 
+	if cfg.Compression != nil && cfg.ConcurrentlyWrite {
+		return nil, errCompressConcurrentlyWrite
+	}
+	backpressure := cfg.Backpressure.Normalize(BackpressureStrategyDrop)
+	var spill *SpillQueue
+	if backpressure.Strategy == BackpressureStrategySpill {
+		dir := backpressure.SpillDir
+		if dir == "" {
+			// One queue per log file of the directory.
+			dir = filepath.Join(cfg.FileDir, ".spill", cfg.FileName+"."+cfg.FileSuffix)
+		}
+		var err error
+		spill, err = OpenSpillQueue(dir, backpressure.SpillMaxBytes, backpressure.SpillSegmentSize)
+		if err != nil {
+			return nil, err
+		}
+	}
 	rotator, err := NewRotator(cfg)
 	if err != nil {
+		_ = spill.Close()
 		return nil, err
 	}
+	var procLock *processLock
+	if cfg.MultiProcess && cfg.RotatorType != FileRotatorTypeExternal {
+		rotator, procLock, err = newMultiProcessRotator(cfg, rotator)
+		if err != nil {
+			_ = spill.Close()
+			return nil, err
+		}
+	}
 	h := &FileHandler{
 		formatter:     fm,
 		filter:        ft,
 		rotator:       rotator,
+		procLock:      procLock,
+		watcher:       newExternalRotationWatcher(cfg),
 		bulkWriteSize: cfg.BulkWriteSize,
-		backpressure:  cfg.Backpressure.Normalize(BackpressureStrategyDrop),
+		backpressure:  backpressure,
+		spill:         spill,
+		durability:    cfg.Durability.Normalize(),
 		ErrorCallback: cfg.ErrCallback,
 		bufChan:    make(chan []byte, cfg.BufferSize),
+		flushChan:  make(chan flushRequest),
 		doneChan:   make(chan struct{}),
 		workerDone: make(chan struct{}),
 	}
+	if spill != nil {
+		h.replayDone = make(chan struct{})
+		go h.replaySpill()
+	}
 	go h.flushWorker()
 	return h, nil
 }
 
+// flushRequest asks flushWorker to write out bufChan, then to fsync when sync is
+// set or to reopen the file when reopen is set.
+type flushRequest struct {
+	sync   bool
+	reopen bool
+	done   chan error
+}
+
 func (h *FileHandler) flushWorker() {
 	defer close(h.workerDone)
+	var syncTick <-chan time.Time
+	if h.durability.Policy == SyncPolicyInterval {
+		ticker := time.NewTicker(h.durability.Interval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
 	for {
 		select {
+		case <-syncTick:
+			if h.unsynced > 0 {
+				h.policySync()
+			}
 		case b := <-h.bufChan:
 			buf := h.BulkFill(b)
 			err := h.realWrite(buf)
 			if err != nil && h.ErrorCallback != nil {
 				h.ErrorCallback(buf, err)
 			}
+		case req := <-h.flushChan:
+			err := h.drainBuffered(req.sync)
+			if err == nil && req.reopen {
+				_, err = h.rotator.Reopen()
+			}
+			req.done <- err
 		case <-h.doneChan:
 			for {
 				select {
@@ -79,6 +151,7 @@ func (h *FileHandler) flushWorker() {
 						h.ErrorCallback(buf, err)
 					}
 				default:
+					h.drainSpill()
 					return
 				}
 			}
@@ -87,7 +160,88 @@ func (h *FileHandler) flushWorker() {
 	}
 }
 
+// replaySpill moves the spilled messages back into bufChan in order.
+func (h *FileHandler) replaySpill() {
+	defer close(h.replayDone)
+	h.spill.Replay(h.doneChan, func(rec []byte) bool {
+		select {
+		case h.bufChan <- rec:
+			h.stats.AddReplayed()
+			return true
+		case <-h.doneChan:
+			return false
+		}
+	}, h.spillError)
+}
+
+// drainSpill writes what is left in the spill queue once replaySpill has
+// stopped, on Close.
+func (h *FileHandler) drainSpill() {
+	if h.spill == nil {
+		return
+	}
+	<-h.replayDone
+	h.spill.Drain(func(rec []byte) {
+		h.stats.AddReplayed()
+		if err := h.realWrite(rec); err != nil && h.ErrorCallback != nil {
+			h.ErrorCallback(rec, err)
+		}
+	}, h.spillError)
+	if err := h.spill.Close(); err != nil {
+		h.spillError(err)
+	}
+}
+
+func (h *FileHandler) spillError(err error) {
+	if h.ErrorCallback != nil {
+		h.ErrorCallback(nil, err)
+	}
+}
+
+// drainBuffered writes everything queued in bufChan and, with the spill
+// strategy, everything spilled. Write errors go to ErrorCallback as usual, only
+// the sync error is returned.
+func (h *FileHandler) drainBuffered(sync bool) error {
+	for {
+		select {
+		case b := <-h.bufChan:
+			h.writeBuffered(b)
+			continue
+		default:
+		}
+		if h.spill.Len() == 0 {
+			break
+		}
+		// replaySpill feeds bufChan until the spill queue is empty or Close stops it.
+		select {
+		case b := <-h.bufChan:
+			h.writeBuffered(b)
+			continue
+		case <-h.replayDone:
+		}
+		break
+	}
+	if sync {
+		return h.syncFile()
+	}
+	return nil
+}
+
+func (h *FileHandler) writeBuffered(b []byte) {
+	buf := h.BulkFill(b)
+	err := h.realWrite(buf)
+	if err != nil && h.ErrorCallback != nil {
+		h.ErrorCallback(buf, err)
+	}
+}
+
 func (h *FileHandler) realWrite(buf []byte) error {
+	if h.procLock != nil {
+		if err := h.procLock.lockShared(); err != nil {
+			return err
+		}
+		defer func() { _ = h.procLock.unlock() }()
+	}
 	var err error
 	var needRotate bool
 	var file *os.File
@@ -100,10 +254,23 @@ func (h *FileHandler) realWrite(buf []byte) error {
 		if err != nil {
 			return err
 		}
+		h.unsynced = 0
 	}
 	if file == nil {
 		return errors.New("file not open")
 	}
+	if h.watcher != nil {
+		changed, err := h.watcher.changed(file)
+		if err != nil {
+			return err
+		}
+		if changed {
+			file, err = h.rotator.Reopen()
+			if err != nil {
+				return err
+			}
+		}
+	}
 	n, err := file.Write(buf)
 	if err != nil {
 		if !errors.Is(err, io.ErrShortWrite) {
@@ -119,9 +286,35 @@ func (h *FileHandler) realWrite(buf []byte) error {
 		}
 	}
 	h.rotator.RecordBytesWritten(n)
+	if h.watcher != nil {
+		h.watcher.written(n)
+	}
+	h.unsynced += int64(n)
+	if h.durability.Policy == SyncPolicyBytes && h.unsynced >= h.durability.Bytes {
+		h.policySync()
+	}
 	return nil
 }
 
+// syncFile fsyncs the current file and records the latency.
+func (h *FileHandler) syncFile() error {
+	start := time.Now()
+	err := h.rotator.Sync()
+	h.syncStats.Observe(time.Since(start), err)
+	if err == nil {
+		h.unsynced = 0
+	}
+	return err
+}
+
+// policySync is an fsync required by the durability policy, its failure goes
+// to ErrorCallback.
+func (h *FileHandler) policySync() {
+	if err := h.syncFile(); err != nil && h.ErrorCallback != nil {
+		h.ErrorCallback(nil, err)
+	}
+}
+
 func (h *FileHandler) BulkFill(buf []byte) []byte {
 	total := len(buf)
 	for {
@@ -152,7 +345,15 @@ func (h *FileHandler) Emit(entry *message.Entry) error {
 		return err
 	}
 
-	return h.enqueue(msgByte)
+	if err = h.enqueue(msgByte); err != nil {
+		return err
+	}
+	if h.durability.Policy == SyncPolicyLevel && entry.Level >= h.durability.Level {
+		if err = h.Sync(); err != nil && h.ErrorCallback != nil {
+			h.ErrorCallback(msgByte, err)
+		}
+	}
+	return nil
 }
 
 func (h *FileHandler) enqueue(msg []byte) error {
@@ -186,6 +387,22 @@ func (h *FileHandler) enqueue(msg []byte) error {
 			h.stats.AddDropped()
 			return ErrBackpressureDropped
 		}
+	case BackpressureStrategySpill:
+		// Once something is spilled the new messages queue up behind it to keep the order.
+		if h.spill.Len() == 0 {
+			select {
+			case h.bufChan <- msg:
+				h.stats.AddEnqueued()
+				return nil
+			default:
+			}
+		}
+		if err := h.spill.Push(msg); err != nil {
+			h.stats.AddDiscarded()
+			return err
+		}
+		h.stats.AddSpilled()
+		return nil
 	default:
 		select {
 		case h.bufChan <- msg:
@@ -198,10 +415,52 @@ func (h *FileHandler) enqueue(msg []byte) error {
 	}
 }
 
+// Flush waits until the messages enqueued before the call have been written to
+// the file. The handler keeps running.
+func (h *FileHandler) Flush(ctx context.Context) error {
+	return h.flush(ctx, false)
+}
+
+// Sync is Flush followed by an fsync of the current file.
+func (h *FileHandler) Sync() error {
+	return h.flush(context.Background(), true)
+}
+
+// Reopen writes out the buffered messages, then closes the file and opens its
+// path again. Call it after an external tool has moved the file away.
+func (h *FileHandler) Reopen() error {
+	return h.request(context.Background(), flushRequest{reopen: true, done: make(chan error, 1)})
+}
+
+func (h *FileHandler) flush(ctx context.Context, sync bool) error {
+	return h.request(ctx, flushRequest{sync: sync, done: make(chan error, 1)})
+}
+
+func (h *FileHandler) request(ctx context.Context, req flushRequest) error {
+	select {
+	case h.flushChan <- req:
+	case <-h.workerDone:
+		// Closed: Close has already written everything out.
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (h *FileHandler) BackpressureStats() BackpressureStats {
 	return h.stats.Snapshot()
 }
 
+func (h *FileHandler) SyncStats() SyncStats {
+	return h.syncStats.Snapshot()
+}
+
 func (h *FileHandler) Close() error {
 	var err error
 	h.closeOnce.Do(func() {
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func TestFileHandlerFlushKeepsHandlerRunning(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &FileHandlerConfig{
+		FileDir:       dir,
+		FileName:      "f",
+		FileSuffix:    "log",
+		MaxFileSize:   1 << 20,
+		BufferSize:    64,
+		BulkWriteSize: 256,
+		RotatorType:   FileRotatorTypeSize,
+	}
+	fm := formatter.NewTextFormatter(formatter.TextFormatterConfig{
+		BaseFormatterConfig: formatter.BaseFormatterConfig{TimeLayout: "2006-01-02 15:04:05"},
+		PatternStyle:        "%[Message]v",
+	})
+	h, err := NewFileHandler(cfg, fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emit := func(msg string) {
+		t.Helper()
+		if err := h.Emit(&message.Entry{Message: msg, Level: level.InfoLevel, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() []byte {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, "f.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for i := 0; i < 20; i++ {
+		emit("first")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n := bytes.Count(read(), []byte("first")); n != 20 {
+		t.Fatalf("after Flush found %d lines, want 20", n)
+	}
+
+	emit("second")
+	if err := h.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if !bytes.Contains(read(), []byte("second")) {
+		t.Fatal("handler must keep writing after Flush")
+	}
+}
@@ -17,6 +17,10 @@ type IRotator interface {
 	NeedRollover(msg []byte) (*os.File, bool, error)
 	DoRollover() (*os.File, error)
 	Close() error
+	// Sync commits the current file to stable storage; it is a no-op before the first write.
+	Sync() error
+	// Reopen closes the current file and opens the same path again.
+	Reopen() (*os.File, error)
 	// RecordBytesWritten updates size accounting after a successful Write (avoids per-write Seek).
 	RecordBytesWritten(n int)
 }
@@ -29,17 +33,21 @@ func NewRotator(cfg *FileHandlerConfig) (IRotator, error) {
 		return NewTimeRotator(cfg)
 	case FileRotatorTypeTimeAndSize:
 		return NewTimeAndSizeRotator(cfg)
+	case FileRotatorTypeExternal:
+		return NewExternalRotator(cfg)
 	default:
 		return NewTimeAndSizeRotator(cfg)
 	}
 }
 
 type SizeRotator struct {
-	file     *os.File
-	cfg      *FileHandlerConfig
-	filePath string
-	maxSize  int64
-	curSize  int64
+	file       *os.File
+	cfg        *FileHandlerConfig
+	filePath   string
+	maxSize    int64
+	curSize    int64
+	compressor *backupCompressor
+	cleaner    *backupCleaner
 }
 
 func NewSizeRotator(cfg *FileHandlerConfig) (*SizeRotator, error) {
@@ -55,14 +63,26 @@ func NewSizeRotator(cfg *FileHandlerConfig) (*SizeRotator, error) {
 }
 
 func (r *SizeRotator) init() error {
-	err := mkdir(r.cfg.FileDir)
+	err := mkdir(r.cfg.FileDir, r.cfg.dirMode())
 	if err != nil {
 		return err
 	}
 	r.filePath = r.getFilepath()
+	if r.cfg.Compression != nil {
+		r.compressor = newBackupCompressor(r.cfg.Compression, r.cfg.ErrCallback)
+	}
+	r.cleaner = newBackupCleaner(r.cfg, r.listBackups, r.compressor.remove)
+	r.cleaner.trigger(r.filePath)
 	return nil
 }
 
+var sizeBackupReMatch = regexp.MustCompile(`^\d+$`)
+
+func (r *SizeRotator) listBackups() ([]string, error) {
+	dir, filename := filepath.Split(r.filePath)
+	return collectRotatedBackupPaths(dir, filename, sizeBackupReMatch, r.compressor.extension())
+}
+
 func (r *SizeRotator) getFilepath() string {
 	var parties []string
 	if r.cfg.FileName != "" {
@@ -74,7 +94,7 @@ func (r *SizeRotator) getFilepath() string {
 
 func (r *SizeRotator) NeedRollover(msg []byte) (*os.File, bool, error) {
 	if r.file == nil {
-		file, err := open(r.filePath)
+		file, err := openLogFile(r.cfg, r.filePath)
 		if err != nil {
 			return nil, false, err
 		}
@@ -103,28 +123,39 @@ func (r *SizeRotator) DoRollover() (*os.File, error) {
 		_ = r.file.Sync()
 		_ = r.file.Close()
 	}
+	r.cleaner.lock()
+	defer r.cleaner.unlock()
 	if r.cfg.BackupCount > 0 {
+		// The pending compressions follow their files through the shift below.
+		exts := []string{""}
+		if ext := r.compressor.extension(); ext != "" {
+			exts = append(exts, ext)
+		}
 		for i := r.cfg.BackupCount; i > 0; i-- {
-			sfn := fmt.Sprintf("%s.%d", r.filePath, i-1)
-			dfn := fmt.Sprintf("%s.%d", r.filePath, i)
-			if IsFileExist(sfn) {
-				if IsFileExist(dfn) {
-					err := os.Remove(dfn)
+			for _, ext := range exts {
+				sfn := fmt.Sprintf("%s.%d%s", r.filePath, i-1, ext)
+				dfn := fmt.Sprintf("%s.%d%s", r.filePath, i, ext)
+				if IsFileExist(sfn) {
+					if IsFileExist(dfn) {
+						err := r.compressor.remove(dfn)
+						if err != nil {
+							return nil, err
+						}
+					}
+					err := r.compressor.move(sfn, dfn)
 					if err != nil {
 						return nil, err
 					}
 				}
-				err := os.Rename(sfn, dfn)
-				if err != nil {
-					return nil, err
-				}
 			}
 		}
 		dfn := fmt.Sprintf("%s.1", r.filePath)
-		if IsFileExist(dfn) {
-			err := os.Remove(dfn)
-			if err != nil {
-				return nil, err
+		for _, ext := range exts {
+			if IsFileExist(dfn + ext) {
+				err := r.compressor.remove(dfn + ext)
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
 		if IsFileExist(r.filePath) {
@@ -132,10 +163,13 @@ func (r *SizeRotator) DoRollover() (*os.File, error) {
 			if err != nil {
 				return nil, err
 			}
+			r.compressor.add(dfn)
 		}
 	}
 
-	f, err := open(r.filePath)
+	r.cleaner.trigger(r.filePath)
+
+	f, err := openLogFile(r.cfg, r.filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +182,42 @@ func (r *SizeRotator) DoRollover() (*os.File, error) {
 	return f, nil
 }
 
+func (r *SizeRotator) Reopen() (*os.File, error) {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+	f, err := openLogFile(r.cfg, r.filePath)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r.curSize = st.Size()
+	return f, nil
+}
+
+func (r *SizeRotator) adopt() (*os.File, error) {
+	return r.Reopen()
+}
+
+func (r *SizeRotator) setSize(size int64) {
+	r.curSize = size
+}
+
+func (r *SizeRotator) Sync() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
 func (r *SizeRotator) Close() error {
+	r.compressor.close()
+	r.cleaner.close()
 	if r.file == nil {
 		return errors.New("file not open")
 	}
@@ -161,7 +230,10 @@ type TimeRotator struct {
 	filePath   string
 	interval   int64
 	rolloverAt int64
+	clock      rolloverClock
 	reCompile  *regexp.Regexp
+	compressor *backupCompressor
+	cleaner    *backupCleaner
 }
 
 func NewTimeRotator(cfg *FileHandlerConfig) (*TimeRotator, error) {
@@ -180,18 +252,29 @@ func (r *TimeRotator) init() error {
 	if r.interval <= 0 {
 		r.interval = 60 * 60 // default 1 hour
 	}
-	r.rolloverAt = getRolloverSecond(r.interval)
+	r.clock = newRolloverClock(r.cfg, r.interval)
+	r.rolloverAt = r.clock.first(r.clock.now())
 	r.reCompile = regexp.MustCompile(r.cfg.ReMatch)
 
-	err := mkdir(r.cfg.FileDir)
+	err := mkdir(r.cfg.FileDir, r.cfg.dirMode())
 	if err != nil {
 		panic(err)
 	}
 
 	r.filePath = r.getFilepath()
+	if r.cfg.Compression != nil {
+		r.compressor = newBackupCompressor(r.cfg.Compression, r.cfg.ErrCallback)
+	}
+	r.cleaner = newBackupCleaner(r.cfg, r.listBackups, r.compressor.remove)
+	r.cleaner.trigger(r.filePath)
 	return nil
 }
 
+func (r *TimeRotator) listBackups() ([]string, error) {
+	dir, filename := filepath.Split(r.filePath)
+	return collectRotatedBackupPaths(dir, filename, r.reCompile, r.compressor.extension())
+}
+
 func (r *TimeRotator) getFilepath() string {
 	var parties []string
 	if r.cfg.FileName != "" {
@@ -204,12 +287,12 @@ func (r *TimeRotator) getFilepath() string {
 func (r *TimeRotator) NeedRollover(_ []byte) (*os.File, bool, error) {
 	if r.file == nil {
 		var err error
-		r.file, err = open(r.filePath)
+		r.file, err = openLogFile(r.cfg, r.filePath)
 		if err != nil {
 			return r.file, false, err
 		}
 	}
-	t := time.Now().Unix()
+	t := r.clock.now().Unix()
 	if t >= r.rolloverAt {
 		return r.file, true, nil
 	}
@@ -223,11 +306,13 @@ func (r *TimeRotator) DoRollover() (*os.File, error) {
 		_ = r.file.Sync()
 		_ = r.file.Close()
 	}
-	curTime := time.Now()
-	suffixTime := curTime.Format(r.cfg.TimeSuffixFmt)
+	r.cleaner.lock()
+	defer r.cleaner.unlock()
+	curTime := r.clock.now()
+	suffixTime := r.clock.suffixTime(curTime).Format(r.cfg.TimeSuffixFmt)
 	dfn := fmt.Sprintf("%s.%s", r.filePath, suffixTime)
 	if IsFileExist(dfn) {
-		err := os.Remove(dfn)
+		err := r.compressor.remove(dfn)
 		if err != nil {
 			return nil, err
 		}
@@ -237,10 +322,10 @@ func (r *TimeRotator) DoRollover() (*os.File, error) {
 		if err != nil {
 			return nil, err
 		}
+		r.compressor.add(dfn)
 	}
 	if backupCount := r.cfg.BackupCount; backupCount > 0 {
-		dir, filename := filepath.Split(r.filePath)
-		delFileList, err := collectRotatedBackupPaths(dir, filename, r.reCompile)
+		delFileList, err := r.listBackups()
 		if err != nil {
 			return nil, err
 		}
@@ -249,17 +334,19 @@ func (r *TimeRotator) DoRollover() (*os.File, error) {
 			delFileList = delFileList[:delLen-backupCount]
 		}
 		for _, filePath := range delFileList {
-			err := os.Remove(filePath)
+			err := r.compressor.remove(filePath)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
 
+	r.cleaner.trigger(r.filePath)
+
 	// next rolloverAt
-	r.rolloverAt = curTime.Unix() + r.interval
+	r.rolloverAt = r.clock.next(curTime)
 
-	f, err := open(r.filePath)
+	f, err := openLogFile(r.cfg, r.filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -267,7 +354,38 @@ func (r *TimeRotator) DoRollover() (*os.File, error) {
 	return f, nil
 }
 
+func (r *TimeRotator) Reopen() (*os.File, error) {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+	f, err := openLogFile(r.cfg, r.filePath)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	return f, nil
+}
+
+func (r *TimeRotator) adopt() (*os.File, error) {
+	if now := r.clock.now(); now.Unix() >= r.rolloverAt {
+		r.rolloverAt = r.clock.next(now)
+	}
+	return r.Reopen()
+}
+
+func (r *TimeRotator) setSize(_ int64) {}
+
+func (r *TimeRotator) Sync() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
 func (r *TimeRotator) Close() error {
+	r.compressor.close()
+	r.cleaner.close()
 	if r.file == nil {
 		return errors.New("file not open")
 	}
@@ -285,8 +403,11 @@ type TimeAndSizeRotator struct {
 	interval           int64
 	suffixFmt          string
 	rolloverAt         int64
+	clock              rolloverClock
 	rolloverTimeSuffix string
 	reCompile          *regexp.Regexp
+	compressor         *backupCompressor
+	cleaner            *backupCleaner
 }
 
 func NewTimeAndSizeRotator(cfg *FileHandlerConfig) (*TimeAndSizeRotator, error) {
@@ -312,25 +433,38 @@ func (r *TimeAndSizeRotator) init() error {
 		return errors.New("config is nil")
 	}
 
+	if r.cfg.Compression != nil && r.cfg.ConcurrentlyWrite {
+		return errCompressConcurrentlyWrite
+	}
 	if r.interval <= 0 {
 		r.interval = 60 * 60 // default 1 hour
 	}
-	r.rolloverAt = getRolloverSecond(r.interval)
+	r.clock = newRolloverClock(r.cfg, r.interval)
+	r.rolloverAt = r.clock.first(r.clock.now())
 	r.reCompile = regexp.MustCompile(r.cfg.ReMatch)
 
-	err := mkdir(r.cfg.FileDir)
+	err := mkdir(r.cfg.FileDir, r.cfg.dirMode())
 	if err != nil {
 		panic(err)
 	}
 
 	r.filePath = r.getNewFilepath()
+	if r.cfg.Compression != nil {
+		r.compressor = newBackupCompressor(r.cfg.Compression, r.cfg.ErrCallback)
+	}
+	r.cleaner = newBackupCleaner(r.cfg, r.listBackups, r.compressor.remove)
+	r.cleaner.trigger(r.filePath)
 	return nil
 }
 
+func (r *TimeAndSizeRotator) listBackups() ([]string, error) {
+	return collectRotatedBackupPaths(r.cfg.FileDir, r.filename, r.reCompile, r.compressor.extension())
+}
+
 func (r *TimeAndSizeRotator) NeedRollover(msg []byte) (*os.File, bool, error) {
 	if r.file == nil {
 		var err error
-		r.file, err = open(r.filePath)
+		r.file, err = openLogFile(r.cfg, r.filePath)
 		if err != nil {
 			return r.file, false, err
 		}
@@ -338,7 +472,7 @@ func (r *TimeAndSizeRotator) NeedRollover(msg []byte) (*os.File, bool, error) {
 		if err != nil {
 			return r.file, false, err
 		}
-		if modTime.Unix()+r.interval < r.rolloverAt {
+		if r.clock.stale(modTime, r.rolloverAt) {
 			return r.file, true, nil
 		}
 		st, err := r.file.Stat()
@@ -347,7 +481,7 @@ func (r *TimeAndSizeRotator) NeedRollover(msg []byte) (*os.File, bool, error) {
 		}
 		r.curSize = st.Size()
 	}
-	t := time.Now().Unix()
+	t := r.clock.now().Unix()
 	if t >= r.rolloverAt {
 		return r.file, true, nil
 	}
@@ -379,6 +513,8 @@ func (r *TimeAndSizeRotator) DoRollover() (*os.File, error) {
 			return nil, err
 		}
 	}
+	r.cleaner.lock()
+	defer r.cleaner.unlock()
 	if !r.cfg.ConcurrentlyWrite {
 		var parties []string
 		if r.filename != "" {
@@ -388,7 +524,7 @@ func (r *TimeAndSizeRotator) DoRollover() (*os.File, error) {
 		dfn := filepath.Join(r.cfg.FileDir, strings.Join(parties, "."))
 
 		if IsFileExist(dfn) {
-			err = os.Remove(dfn)
+			err = r.compressor.remove(dfn)
 			if err != nil {
 				return nil, err
 			}
@@ -398,13 +534,12 @@ func (r *TimeAndSizeRotator) DoRollover() (*os.File, error) {
 			if err != nil {
 				return nil, err
 			}
+			r.compressor.add(dfn)
 		}
 	}
 	if r.backupCount > 0 {
-		dir := r.cfg.FileDir
-		filename := r.filename
 		var delFileList []string
-		delFileList, err = collectRotatedBackupPaths(dir, filename, r.reCompile)
+		delFileList, err = r.listBackups()
 		if err != nil {
 			return nil, err
 		}
@@ -412,7 +547,7 @@ func (r *TimeAndSizeRotator) DoRollover() (*os.File, error) {
 			sort.Strings(delFileList)
 			delFileList = delFileList[:delFileLen-r.backupCount]
 			for _, filePath := range delFileList {
-				err = os.Remove(filePath)
+				err = r.compressor.remove(filePath)
 				if err != nil {
 					return nil, err
 				}
@@ -420,10 +555,11 @@ func (r *TimeAndSizeRotator) DoRollover() (*os.File, error) {
 		}
 	}
 	// next rolloverAt
-	r.rolloverAt = time.Now().Unix() + r.interval
+	r.rolloverAt = r.clock.next(r.clock.now())
 
 	r.filePath = r.getNewFilepath()
-	r.file, err = open(r.filePath)
+	r.cleaner.trigger(r.filePath)
+	r.file, err = openLogFile(r.cfg, r.filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -440,7 +576,7 @@ func (r *TimeAndSizeRotator) getNewFilepath() string {
 	if r.filename != "" {
 		parties = append(parties, r.filename)
 	}
-	r.rolloverTimeSuffix = time.Now().Format(r.suffixFmt)
+	r.rolloverTimeSuffix = r.clock.suffixTime(r.clock.now()).Format(r.suffixFmt)
 	if r.cfg.ConcurrentlyWrite {
 		parties = append(parties, r.rolloverTimeSuffix)
 	}
@@ -448,7 +584,46 @@ func (r *TimeAndSizeRotator) getNewFilepath() string {
 	return filepath.Join(r.cfg.FileDir, strings.Join(parties, "."))
 }
 
+func (r *TimeAndSizeRotator) Reopen() (*os.File, error) {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+	f, err := openLogFile(r.cfg, r.filePath)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r.curSize = st.Size()
+	return f, nil
+}
+
+func (r *TimeAndSizeRotator) adopt() (*os.File, error) {
+	if now := r.clock.now(); now.Unix() >= r.rolloverAt {
+		r.rolloverAt = r.clock.next(now)
+		r.filePath = r.getNewFilepath()
+	}
+	return r.Reopen()
+}
+
+func (r *TimeAndSizeRotator) setSize(size int64) {
+	r.curSize = size
+}
+
+func (r *TimeAndSizeRotator) Sync() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
 func (r *TimeAndSizeRotator) Close() error {
+	r.compressor.close()
+	r.cleaner.close()
 	if r.file == nil {
 		return errors.New("file not open")
 	}
@@ -463,20 +638,77 @@ func IsFileExist(name string) bool {
 	return err == nil || os.IsExist(err)
 }
 
-func open(filepath string) (*os.File, error) {
+// openLogFile opens the file being written and points CurrentLink at it.
+// A failing link is reported to ErrCallback and does not stop the logging.
+func openLogFile(cfg *FileHandlerConfig, path string) (*os.File, error) {
+	f, err := open(path, cfg.fileMode())
+	if err != nil {
+		return nil, err
+	}
+	if err = updateCurrentLink(cfg, path); err != nil && cfg.ErrCallback != nil {
+		cfg.ErrCallback(path, err)
+	}
+	return f, nil
+}
+
+func open(filepath string, perm os.FileMode) (*os.File, error) {
 	old := util.UMask(0)
 	defer util.UMask(old)
-	return os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o666)
+	return os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm)
+}
+
+func (c *FileHandlerConfig) fileMode() os.FileMode {
+	if c.FileMode == 0 {
+		return 0o666
+	}
+	return c.FileMode
+}
+
+func (c *FileHandlerConfig) dirMode() os.FileMode {
+	if c.DirMode == 0 {
+		return 0o777
+	}
+	return c.DirMode
 }
 
-func mkdir(dir string) error {
+// updateCurrentLink atomically re-points the CurrentLink symlink at target by
+// renaming a freshly created link over it. It does nothing when the link
+// already points there.
+func updateCurrentLink(cfg *FileHandlerConfig, target string) error {
+	if cfg.CurrentLink == "" {
+		return nil
+	}
+	link := cfg.CurrentLink
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(cfg.FileDir, link)
+	}
+	dest := target
+	if rel, err := filepath.Rel(filepath.Dir(link), target); err == nil {
+		dest = rel
+	}
+	if cur, err := os.Readlink(link); err == nil && cur == dest {
+		return nil
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", link, os.Getpid())
+	_ = os.Remove(tmp)
+	if err := os.Symlink(dest, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func mkdir(dir string, perm os.FileMode) error {
 	if dir == "" {
 		dir = "."
 	}
 	if !strings.HasPrefix(dir, ".") {
 		old := util.UMask(0)
 		defer util.UMask(old)
-		err := os.MkdirAll(dir, 0o777)
+		err := os.MkdirAll(dir, perm)
 		if err != nil {
 			println(fmt.Sprintf("make dir fail, dir %s, err %s\n", dir, err))
 			return err
@@ -494,7 +726,8 @@ func getFileModTime(file *os.File) (time.Time, error) {
 }
 
 // collectRotatedBackupPaths lists files in dir whose names start with namePrefix+"." and suffix matches re.
-func collectRotatedBackupPaths(dir, namePrefix string, re *regexp.Regexp) ([]string, error) {
+// A suffix ending with one of compressedExts is matched without that extension.
+func collectRotatedBackupPaths(dir, namePrefix string, re *regexp.Regexp, compressedExts ...string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
@@ -511,6 +744,12 @@ func collectRotatedBackupPaths(dir, namePrefix string, re *regexp.Regexp) ([]str
 			continue
 		}
 		suf := fn[plen:]
+		for _, ext := range compressedExts {
+			if trimmed, ok := trimCompressedExt(suf, ext); ok {
+				suf = trimmed
+				break
+			}
+		}
 		if re.MatchString(suf) {
 			out = append(out, filepath.Join(dir, fn))
 		}
@@ -518,17 +757,17 @@ func collectRotatedBackupPaths(dir, namePrefix string, re *regexp.Regexp) ([]str
 	return out, nil
 }
 
-func getRolloverSecond(interval int64) (rolloverAt int64) {
+func getRolloverSecond(now time.Time, interval int64) (rolloverAt int64) {
 	if interval >= 60*60*24*7 || interval >= 60*60*24 {
-		year, month, day := time.Now().Date()
-		t := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+		year, month, day := now.Date()
+		t := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
 		rolloverAt = t.Unix() + interval
 	} else if interval >= 60*60 {
-		rolloverAt = time.Now().Truncate(time.Hour).Unix() + interval
+		rolloverAt = now.Truncate(time.Hour).Unix() + interval
 	} else if interval >= 60 {
-		rolloverAt = time.Now().Truncate(time.Minute).Unix() + interval
+		rolloverAt = now.Truncate(time.Minute).Unix() + interval
 	} else {
-		rolloverAt = time.Now().Unix() + interval
+		rolloverAt = now.Unix() + interval
 	}
 	return
 }
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type FingersCrossedGroup int8
+
+const (
+	// FingersCrossedByRoutine keeps one buffer per goroutine (Entry.RoutineID).
+	FingersCrossedByRoutine FingersCrossedGroup = iota
+	// FingersCrossedByTrace keeps one buffer per trace (Entry.TraceID), the
+	// entries without trace id being grouped by goroutine.
+	FingersCrossedByTrace
+)
+
+type FingersCrossedConfig struct {
+	// TriggerLevel flushes the buffer of the entry's group, ErrorLevel by default.
+	TriggerLevel level.LogLevel
+	// PassLevel and above go straight to the wrapped handler, InfoLevel by
+	// default; the entries below are buffered.
+	PassLevel level.LogLevel
+	GroupBy   FingersCrossedGroup
+	// BufferSize bounds the entries of a group, the oldest being dropped first.
+	BufferSize int
+	// MaxAge drops the buffered entries older than that, 1 minute by default.
+	MaxAge time.Duration
+	// MaxGroups bounds the number of buffers, the least recently used one
+	// being dropped first.
+	MaxGroups int
+}
+
+func NewFingersCrossedConfig(trigger level.LogLevel) *FingersCrossedConfig {
+	return &FingersCrossedConfig{TriggerLevel: trigger}
+}
+
+func (c *FingersCrossedConfig) WithPassLevel(lvl level.LogLevel) *FingersCrossedConfig {
+	c.PassLevel = lvl
+	return c
+}
+func (c *FingersCrossedConfig) WithGroupBy(group FingersCrossedGroup) *FingersCrossedConfig {
+	c.GroupBy = group
+	return c
+}
+func (c *FingersCrossedConfig) WithBufferSize(n int) *FingersCrossedConfig {
+	c.BufferSize = n
+	return c
+}
+func (c *FingersCrossedConfig) WithMaxAge(age time.Duration) *FingersCrossedConfig {
+	c.MaxAge = age
+	return c
+}
+func (c *FingersCrossedConfig) WithMaxGroups(n int) *FingersCrossedConfig {
+	c.MaxGroups = n
+	return c
+}
+
+func (c *FingersCrossedConfig) normalize() {
+	if c.TriggerLevel == level.NoneLevel {
+		c.TriggerLevel = level.ErrorLevel
+	}
+	if c.PassLevel == level.NoneLevel {
+		c.PassLevel = level.InfoLevel
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 100
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = time.Minute
+	}
+	if c.MaxGroups <= 0 {
+		c.MaxGroups = 1024
+	}
+}
+
+type FingersCrossedStats struct {
+	Passed    uint64 // entries emitted as they came, the triggers included
+	Buffered  uint64
+	Triggers  uint64
+	Flushed   uint64 // buffered entries emitted on a trigger
+	Discarded uint64 // buffered entries dropped for size, age or group count
+}
+
+type FingersCrossedStatsProvider interface {
+	FingersCrossedStats() FingersCrossedStats
+}
+
+// FingersCrossedHandler wraps a handler and holds back the entries below
+// PassLevel in a bounded buffer per goroutine or per trace. An entry at or
+// above TriggerLevel first emits the buffer of its group, so that the debug
+// context of an error is logged, and only that. The worker and logger levels
+// have to let the low level entries through for them to be buffered.
+type FingersCrossedHandler struct {
+	// First for their 64-bit alignment on 32-bit platforms.
+	passed    uint64
+	buffered  uint64
+	triggers  uint64
+	flushed   uint64
+	discarded uint64
+
+	cfg   FingersCrossedConfig
+	inner IHandler
+
+	mu     sync.Mutex
+	groups map[string]*list.Element // of *fingersCrossedBuffer
+	lru    *list.List               // least recently used at the front
+}
+
+type fingersCrossedBuffer struct {
+	key     string
+	entries []fingersCrossedItem // ring of cfg.BufferSize
+	start   int
+	count   int
+}
+
+type fingersCrossedItem struct {
+	entry *message.Entry
+	added time.Time
+}
+
+func NewFingersCrossedHandler(cfg *FingersCrossedConfig, inner IHandler) (*FingersCrossedHandler, error) {
+	if inner == nil {
+		return nil, errors.New("fingers crossed handler: wrapped handler is nil")
+	}
+	if cfg == nil {
+		cfg = &FingersCrossedConfig{}
+	}
+	h := &FingersCrossedHandler{
+		cfg:    *cfg,
+		inner:  inner,
+		groups: make(map[string]*list.Element),
+		lru:    list.New(),
+	}
+	h.cfg.normalize()
+	return h, nil
+}
+
+func (h *FingersCrossedHandler) Emit(e *message.Entry) error {
+	if e.Level < h.cfg.TriggerLevel {
+		if e.Level < h.cfg.PassLevel {
+			h.buffer(e)
+			return nil
+		}
+		atomic.AddUint64(&h.passed, 1)
+		return h.inner.Emit(e)
+	}
+	atomic.AddUint64(&h.passed, 1)
+	atomic.AddUint64(&h.triggers, 1)
+	var errs []error
+	for _, buffered := range h.take(h.key(e)) {
+		atomic.AddUint64(&h.flushed, 1)
+		if err := h.inner.Emit(buffered); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := h.inner.Emit(e); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+func (h *FingersCrossedHandler) key(e *message.Entry) string {
+	if h.cfg.GroupBy == FingersCrossedByTrace && e.TraceID != "" {
+		return "t:" + e.TraceID
+	}
+	return "g:" + strconv.FormatInt(e.RoutineID, 10)
+}
+
+func (h *FingersCrossedHandler) buffer(e *message.Entry) {
+	now := time.Now()
+	key := h.key(e)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	atomic.AddUint64(&h.buffered, 1)
+
+	var b *fingersCrossedBuffer
+	if el, ok := h.groups[key]; ok {
+		h.lru.MoveToBack(el)
+		b = el.Value.(*fingersCrossedBuffer)
+	} else {
+		h.evict(now)
+		b = &fingersCrossedBuffer{key: key, entries: make([]fingersCrossedItem, h.cfg.BufferSize)}
+		h.groups[key] = h.lru.PushBack(b)
+	}
+	h.expire(b, now)
+	if b.count == len(b.entries) {
+		b.entries[b.start] = fingersCrossedItem{}
+		b.start = (b.start + 1) % len(b.entries)
+		b.count--
+		atomic.AddUint64(&h.discarded, 1)
+	}
+	b.entries[(b.start+b.count)%len(b.entries)] = fingersCrossedItem{entry: e, added: now}
+	b.count++
+}
+
+// evict makes room for a new group: the groups whose entries all expired go
+// first, then the least recently used one.
+func (h *FingersCrossedHandler) evict(now time.Time) {
+	for el := h.lru.Front(); el != nil && len(h.groups) >= h.cfg.MaxGroups; {
+		next := el.Next()
+		b := el.Value.(*fingersCrossedBuffer)
+		if h.expire(b, now); b.count == 0 {
+			h.remove(el)
+		}
+		el = next
+	}
+	if len(h.groups) >= h.cfg.MaxGroups {
+		el := h.lru.Front()
+		atomic.AddUint64(&h.discarded, uint64(el.Value.(*fingersCrossedBuffer).count))
+		h.remove(el)
+	}
+}
+
+// expire drops the entries of b older than MaxAge.
+func (h *FingersCrossedHandler) expire(b *fingersCrossedBuffer, now time.Time) {
+	for b.count > 0 && now.Sub(b.entries[b.start].added) > h.cfg.MaxAge {
+		b.entries[b.start] = fingersCrossedItem{}
+		b.start = (b.start + 1) % len(b.entries)
+		b.count--
+		atomic.AddUint64(&h.discarded, 1)
+	}
+}
+
+func (h *FingersCrossedHandler) remove(el *list.Element) {
+	delete(h.groups, el.Value.(*fingersCrossedBuffer).key)
+	h.lru.Remove(el)
+}
+
+// take removes the buffer of key and returns its entries that did not expire.
+func (h *FingersCrossedHandler) take(key string) []*message.Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	el, ok := h.groups[key]
+	if !ok {
+		return nil
+	}
+	h.remove(el)
+	b := el.Value.(*fingersCrossedBuffer)
+	h.expire(b, time.Now())
+	entries := make([]*message.Entry, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		entries = append(entries, b.entries[(b.start+i)%len(b.entries)].entry)
+	}
+	return entries
+}
+
+func (h *FingersCrossedHandler) FingersCrossedStats() FingersCrossedStats {
+	return FingersCrossedStats{
+		Passed:    atomic.LoadUint64(&h.passed),
+		Buffered:  atomic.LoadUint64(&h.buffered),
+		Triggers:  atomic.LoadUint64(&h.triggers),
+		Flushed:   atomic.LoadUint64(&h.flushed),
+		Discarded: atomic.LoadUint64(&h.discarded),
+	}
+}
+
+// Flush flushes the wrapped handler; the buffers are kept, as they are only
+// written on a trigger.
+func (h *FingersCrossedHandler) Flush(ctx context.Context) error {
+	if f, ok := h.inner.(IFlusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+func (h *FingersCrossedHandler) Sync() error {
+	if s, ok := h.inner.(ISyncer); ok {
+		return s.Sync()
+	}
+	return h.Flush(context.Background())
+}
+
+func (h *FingersCrossedHandler) Reopen() error {
+	if r, ok := h.inner.(IReopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+func (h *FingersCrossedHandler) BackpressureStats() BackpressureStats {
+	if p, ok := h.inner.(BackpressureStatsProvider); ok {
+		return p.BackpressureStats()
+	}
+	return BackpressureStats{}
+}
+
+func (h *FingersCrossedHandler) SyncStats() SyncStats {
+	if p, ok := h.inner.(SyncStatsProvider); ok {
+		return p.SyncStats()
+	}
+	return SyncStats{}
+}
+
+// Close discards the buffered entries and closes the wrapped handler.
+func (h *FingersCrossedHandler) Close() error {
+	h.mu.Lock()
+	for el := h.lru.Front(); el != nil; el = el.Next() {
+		atomic.AddUint64(&h.discarded, uint64(el.Value.(*fingersCrossedBuffer).count))
+	}
+	h.groups = make(map[string]*list.Element)
+	h.lru.Init()
+	h.mu.Unlock()
+	return h.inner.Close()
+}
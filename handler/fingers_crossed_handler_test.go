@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// collectingHandler records the messages it is given.
+type collectingHandler struct {
+	mu       sync.Mutex
+	messages []string
+	closed   bool
+}
+
+func (h *collectingHandler) Emit(e *message.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, e.Message)
+	return nil
+}
+
+func (h *collectingHandler) Close() error {
+	h.closed = true
+	return nil
+}
+
+func (h *collectingHandler) take() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.messages
+	h.messages = nil
+	return m
+}
+
+func routineEntry(routine int64, lvl level.LogLevel, msg string) *message.Entry {
+	return &message.Entry{Message: msg, Level: lvl, RoutineID: routine}
+}
+
+func emitAll(t *testing.T, h IHandler, entries ...*message.Entry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := h.Emit(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFingersCrossedHandlerByRoutine(t *testing.T) {
+	inner := &collectingHandler{}
+	h, err := NewFingersCrossedHandler(NewFingersCrossedConfig(level.ErrorLevel), inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h,
+		routineEntry(1, level.DebugLevel, "open 1"),
+		routineEntry(2, level.DebugLevel, "open 2"),
+		routineEntry(1, level.InfoLevel, "request 1"),
+		routineEntry(1, level.PrintLevel, "read 1"),
+	)
+	if got := inner.take(); !reflect.DeepEqual(got, []string{"request 1"}) {
+		t.Fatalf("before the trigger: %q", got)
+	}
+
+	emitAll(t, h, routineEntry(1, level.ErrorLevel, "failed 1"))
+	want := []string{"open 1", "read 1", "failed 1"}
+	if got := inner.take(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// The buffer is emptied by the trigger.
+	emitAll(t, h, routineEntry(1, level.ErrorLevel, "failed again 1"))
+	if got := inner.take(); !reflect.DeepEqual(got, []string{"failed again 1"}) {
+		t.Fatalf("second trigger: %q", got)
+	}
+
+	stats := h.FingersCrossedStats()
+	want2 := FingersCrossedStats{Passed: 3, Buffered: 3, Triggers: 2, Flushed: 2}
+	if stats != want2 {
+		t.Fatalf("stats = %+v, want %+v", stats, want2)
+	}
+	if err = h.Close(); err != nil || !inner.closed {
+		t.Fatalf("Close: %v, closed %v", err, inner.closed)
+	}
+	if stats = h.FingersCrossedStats(); stats.Discarded != 1 {
+		t.Fatalf("the entry of routine 2 is not discarded on Close: %+v", stats)
+	}
+}
+
+func TestFingersCrossedHandlerByTrace(t *testing.T) {
+	inner := &collectingHandler{}
+	cfg := NewFingersCrossedConfig(level.WarnLevel).
+		WithPassLevel(level.ErrorLevel).
+		WithGroupBy(FingersCrossedByTrace)
+	h, _ := NewFingersCrossedHandler(cfg, inner)
+	traced := func(routine int64, trace string, lvl level.LogLevel, msg string) *message.Entry {
+		e := routineEntry(routine, lvl, msg)
+		e.TraceID = trace
+		return e
+	}
+	emitAll(t, h,
+		traced(1, "a", level.DebugLevel, "a on 1"),
+		traced(2, "a", level.InfoLevel, "a on 2"),
+		traced(3, "b", level.InfoLevel, "b on 3"),
+		traced(2, "a", level.WarnLevel, "warned a"),
+	)
+	want := []string{"a on 1", "a on 2", "warned a"}
+	if got := inner.take(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFingersCrossedHandlerBounds(t *testing.T) {
+	inner := &collectingHandler{}
+	cfg := NewFingersCrossedConfig(level.ErrorLevel).
+		WithBufferSize(2).
+		WithMaxGroups(2).
+		WithMaxAge(time.Hour)
+	h, _ := NewFingersCrossedHandler(cfg, inner)
+
+	// Size: the oldest entry of a full buffer goes.
+	emitAll(t, h,
+		routineEntry(1, level.DebugLevel, "d1"),
+		routineEntry(1, level.DebugLevel, "d2"),
+		routineEntry(1, level.DebugLevel, "d3"),
+		routineEntry(1, level.ErrorLevel, "e"),
+	)
+	if got := inner.take(); !reflect.DeepEqual(got, []string{"d2", "d3", "e"}) {
+		t.Fatalf("size bound: %q", got)
+	}
+
+	// Groups: a third one evicts the least recently used.
+	emitAll(t, h,
+		routineEntry(1, level.DebugLevel, "r1"),
+		routineEntry(2, level.DebugLevel, "r2"),
+		routineEntry(1, level.DebugLevel, "r1 again"),
+		routineEntry(3, level.DebugLevel, "r3"),
+		routineEntry(2, level.ErrorLevel, "e2"),
+		routineEntry(1, level.ErrorLevel, "e1"),
+	)
+	if got := inner.take(); !reflect.DeepEqual(got, []string{"e2", "r1", "r1 again", "e1"}) {
+		t.Fatalf("group bound: %q", got)
+	}
+	if stats := h.FingersCrossedStats(); stats.Discarded != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Age: the entries older than MaxAge are not emitted.
+	h.cfg.MaxAge = 20 * time.Millisecond
+	emitAll(t, h, routineEntry(4, level.DebugLevel, "old"))
+	time.Sleep(50 * time.Millisecond)
+	emitAll(t, h,
+		routineEntry(4, level.DebugLevel, "recent"),
+		routineEntry(4, level.ErrorLevel, "e4"),
+	)
+	if got := inner.take(); !reflect.DeepEqual(got, []string{"recent", "e4"}) {
+		t.Fatalf("age bound: %q", got)
+	}
+}
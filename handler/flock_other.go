@@ -0,0 +1,48 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+type processLock struct{}
+
+func newProcessLock(_ string, _ os.FileMode) (*processLock, error) {
+	return nil, errors.New("multi-process mode is not supported on " + runtime.GOOS)
+}
+
+func (l *processLock) lockShared() error    { return nil }
+func (l *processLock) lockExclusive() error { return nil }
+func (l *processLock) unlock() error        { return nil }
+func (l *processLock) close() error         { return nil }
+
+var (
+	lockedDirsMu sync.Mutex
+	lockedDirs   = make(map[string]bool)
+)
+
+// lockDir reserves dir for one owner at a time, within this process only.
+func lockDir(dir string) (release func() error, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	lockedDirsMu.Lock()
+	defer lockedDirsMu.Unlock()
+	if lockedDirs[dir] {
+		return nil, fmt.Errorf("%s: %w", dir, ErrSpillDirInUse)
+	}
+	lockedDirs[dir] = true
+	return func() error {
+		lockedDirsMu.Lock()
+		defer lockedDirsMu.Unlock()
+		delete(lockedDirs, dir)
+		return nil
+	}, nil
+}
@@ -0,0 +1,76 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package handler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ml444/glog/util"
+)
+
+// processLock is an advisory flock shared by all processes writing one log file.
+type processLock struct {
+	file *os.File
+}
+
+func newProcessLock(path string, perm os.FileMode) (*processLock, error) {
+	old := util.UMask(0)
+	defer util.UMask(old)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &processLock{file: f}, nil
+}
+
+func (l *processLock) lockShared() error {
+	return l.flock(syscall.LOCK_SH)
+}
+
+func (l *processLock) lockExclusive() error {
+	return l.flock(syscall.LOCK_EX)
+}
+
+func (l *processLock) unlock() error {
+	return l.flock(syscall.LOCK_UN)
+}
+
+func (l *processLock) flock(how int) error {
+	for {
+		err := syscall.Flock(int(l.file.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func (l *processLock) close() error {
+	return l.file.Close()
+}
+
+// lockDir takes an exclusive flock on a file in dir without waiting, so that
+// a directory is used by one owner at a time, across processes too.
+func lockDir(dir string) (release func() error, err error) {
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("%s: %w", dir, ErrSpillDirInUse)
+		}
+		return nil, err
+	}
+	return f.Close, nil
+}
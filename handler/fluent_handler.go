@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/message"
+)
+
+// FluentHandler sends the entries to Fluentd or Fluent Bit with the Forward
+// protocol, in PackedForward mode: one [tag, entries, option] message per
+// batch, the entries being msgpack [time, record] pairs with EventTime
+// timestamps. With RequireAck each message carries a chunk id that the server
+// has to acknowledge. A broken connection is dialed again on the next attempt,
+// with the backoff of RetryConfig.
+type FluentHandler struct {
+	cfg    FluentHandlerConfig
+	filter filter.IFilter
+	sender *batchSender
+
+	// Used by the sender goroutine only.
+	conn   net.Conn
+	reader *bufio.Reader
+	// The chunk id of the batch that failed last, reused by its retries.
+	retryChunk string
+	retryFirst *message.Entry
+	retryCount int
+}
+
+func NewFluentHandler(cfg *FluentHandlerConfig, ft filter.IFilter) (*FluentHandler, error) {
+	if cfg == nil || cfg.Address == "" {
+		return nil, errors.New("fluent handler: Address is required")
+	}
+	h := &FluentHandler{cfg: *cfg, filter: ft}
+	if h.cfg.Network == "" {
+		h.cfg.Network = "tcp"
+	}
+	if h.cfg.Tag == "" {
+		h.cfg.Tag = "glog"
+	}
+	h.sender = newBatchSender(h.cfg.Batch, h.cfg.Retry, h.cfg.Backpressure, h.send, h.cfg.ErrCallback)
+	return h, nil
+}
+
+// Emit encodes the [time, record] entry right away.
+func (h *FluentHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: fluentEntry(e)})
+}
+
+// fluentEntry encodes [time, record]; the fields come first in the record so
+// that message, level, trace_id, caller and func cannot be overridden.
+func fluentEntry(e *message.Entry) []byte {
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	var w msgpackWriter
+	w.arrayHeader(2)
+	w.eventTime(t)
+
+	n := 2 + len(e.Fields)
+	if e.TraceID != "" {
+		n++
+	}
+	if e.Caller != nil {
+		n += 2
+	}
+	w.mapHeader(n)
+	for _, f := range e.Fields {
+		w.string(f.Key)
+		w.value(f.Value)
+	}
+	w.string("message")
+	w.string(e.Message)
+	w.string("level")
+	w.string(e.Level.String())
+	if e.TraceID != "" {
+		w.string("trace_id")
+		w.string(e.TraceID)
+	}
+	if e.Caller != nil {
+		w.string("caller")
+		w.string(fmt.Sprintf("%s:%d", e.Caller.File, e.Caller.Line))
+		w.string("func")
+		w.string(e.Caller.Function)
+	}
+	return w.b
+}
+
+func (h *FluentHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	size := 0
+	for _, it := range items {
+		size += len(it.data)
+	}
+	entries := make([]byte, 0, size)
+	for _, it := range items {
+		entries = append(entries, it.data...)
+	}
+	chunk, err := h.chunk(items)
+	if err != nil {
+		return items, err
+	}
+
+	var w msgpackWriter
+	w.arrayHeader(3)
+	w.string(h.cfg.Tag)
+	w.bin(entries)
+	if chunk != "" {
+		w.mapHeader(2)
+		w.string("chunk")
+		w.string(chunk)
+	} else {
+		w.mapHeader(1)
+	}
+	w.string("size")
+	w.uint(uint64(len(items)))
+
+	if err = h.write(ctx, w.b, chunk); err != nil {
+		h.closeConn()
+		h.retryChunk, h.retryFirst, h.retryCount = chunk, items[0].entry, len(items)
+		return items, err
+	}
+	h.retryChunk, h.retryFirst, h.retryCount = "", nil, 0
+	return nil, nil
+}
+
+// chunk returns the chunk id of items with RequireAck: the one of the last
+// failed attempt when items are its retry, a new random one otherwise.
+func (h *FluentHandler) chunk(items []batchItem) (string, error) {
+	if !h.cfg.RequireAck {
+		return "", nil
+	}
+	if h.retryChunk != "" && h.retryFirst == items[0].entry && h.retryCount == len(items) {
+		return h.retryChunk, nil
+	}
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(id[:]), nil
+}
+
+func (h *FluentHandler) timeout() time.Duration {
+	if h.cfg.Timeout > 0 {
+		return h.cfg.Timeout
+	}
+	return 10 * time.Second
+}
+
+func (h *FluentHandler) write(ctx context.Context, msg []byte, chunk string) error {
+	if h.conn == nil {
+		if err := h.dial(ctx); err != nil {
+			return err
+		}
+	}
+	defer interruptOnDone(ctx, h.conn)()
+	_ = h.conn.SetWriteDeadline(time.Now().Add(h.timeout()))
+	if _, err := h.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	_ = h.conn.SetReadDeadline(time.Now().Add(h.timeout()))
+	resp, err := msgpackRead(h.reader)
+	if err != nil {
+		return fmt.Errorf("fluent handler: reading ack: %w", err)
+	}
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("fluent handler: unexpected ack %v for chunk %s", resp, chunk)
+	}
+	return nil
+}
+
+func (h *FluentHandler) dial(ctx context.Context) error {
+	conn, err := dialContext(ctx, &net.Dialer{Timeout: h.timeout()}, h.cfg.Network, h.cfg.Address, h.cfg.TLSConfig)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	h.reader = bufio.NewReader(conn)
+	return nil
+}
+
+func (h *FluentHandler) closeConn() {
+	if h.conn != nil {
+		_ = h.conn.Close()
+		h.conn, h.reader = nil, nil
+	}
+}
+
+// Flush waits until the entries emitted before the call have been forwarded
+// or given up on, and returns the last delivery error.
+func (h *FluentHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *FluentHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close forwards what is still queued, retries included, and closes the
+// connection.
+func (h *FluentHandler) Close() error {
+	h.sender.close()
+	h.closeConn()
+	return nil
+}
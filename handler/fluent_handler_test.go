@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type forwardMessage struct {
+	conn    int
+	dropped bool
+	tag     string
+	entries [][]interface{}
+	option  map[string]interface{}
+}
+
+// forwardServer decodes the PackedForward messages and acks the chunks,
+// except on the connections listed in dropConns, which are closed on the
+// first message instead, the message being recorded as dropped.
+func forwardServer(t *testing.T, dropConns ...int) (string, func() []forwardMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	var mu sync.Mutex
+	var msgs []forwardMessage
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(n int, conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					v, err := msgpackRead(r)
+					if err != nil {
+						return
+					}
+					msg := v.([]interface{})
+					fm := forwardMessage{conn: n, tag: msg[0].(string), option: msg[2].(map[string]interface{})}
+					for _, d := range dropConns {
+						fm.dropped = fm.dropped || d == n
+					}
+					br := bytes.NewReader(msg[1].([]byte))
+					for br.Len() > 0 {
+						e, err := msgpackRead(br)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						fm.entries = append(fm.entries, e.([]interface{}))
+					}
+					mu.Lock()
+					msgs = append(msgs, fm)
+					mu.Unlock()
+					if fm.dropped {
+						return
+					}
+					if chunk, ok := fm.option["chunk"]; ok {
+						var w msgpackWriter
+						w.mapHeader(1)
+						w.string("ack")
+						w.string(chunk.(string))
+						if _, err = conn.Write(w.b); err != nil {
+							return
+						}
+					}
+				}
+			}(n, conn)
+		}
+	}()
+	return ln.Addr().String(), func() []forwardMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]forwardMessage(nil), msgs...)
+	}
+}
+
+func TestFluentHandlerPackedForward(t *testing.T) {
+	addr, messages := forwardServer(t)
+	cfg := (&FluentHandlerConfig{Address: addr}).
+		WithTag("app.api").
+		WithRequireAck().
+		WithRetry(fastRetry())
+	h, err := NewFluentHandler(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	ts := time.Unix(1700000000, 123456789)
+	err = h.Emit(&message.Entry{
+		Message: "hello",
+		TraceID: "t-1",
+		Time:    ts,
+		Level:   level.WarnLevel,
+		Caller:  &runtime.Frame{Function: "main.run", File: "/src/main.go", Line: 9},
+		Fields:  message.FieldsFromKV("n", -3, "ok", true, "ratio", 0.25),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitN(t, h, 2)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := messages()
+	if len(msgs) != 1 || msgs[0].tag != "app.api" || len(msgs[0].entries) != 3 || msgs[0].option["size"] != int64(3) {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	first := msgs[0].entries[0]
+	ext, ok := first[0].(msgpackExt)
+	if !ok || ext.Type != 0 || binary.BigEndian.Uint32(ext.Data[:4]) != 1700000000 || binary.BigEndian.Uint32(ext.Data[4:]) != 123456789 {
+		t.Fatalf("time = %#v", first[0])
+	}
+	record := first[1].(map[string]interface{})
+	want := map[string]interface{}{
+		"message":  "hello",
+		"level":    "WARN",
+		"trace_id": "t-1",
+		"caller":   "/src/main.go:9",
+		"func":     "main.run",
+		"n":        int64(-3),
+		"ok":       true,
+		"ratio":    0.25,
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Fatalf("%s = %#v, want %#v", k, record[k], v)
+		}
+	}
+}
+
+func TestFluentHandlerReconnectsUntilAcked(t *testing.T) {
+	addr, messages := forwardServer(t, 0)
+	h, err := NewFluentHandler((&FluentHandlerConfig{Address: addr}).WithRequireAck().WithRetry(fastRetry()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	emitN(t, h, 3)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := messages()
+	if len(msgs) != 2 || !msgs[0].dropped || msgs[1].conn != 1 || msgs[1].tag != "glog" || len(msgs[1].entries) != 3 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	// The retry keeps the chunk id, for the server to tell a duplicate.
+	if chunk := msgs[0].option["chunk"]; chunk == nil || msgs[1].option["chunk"] != chunk {
+		t.Fatalf("chunks = %v, %v", chunk, msgs[1].option["chunk"])
+	}
+}
+
+// The defaults are set on a copy of the config, which may be shared.
+func TestFluentHandlerKeepsConfig(t *testing.T) {
+	cfg := &FluentHandlerConfig{Address: "127.0.0.1:24224"}
+	h, err := NewFluentHandler(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	if h.cfg.Network != "tcp" || h.cfg.Tag != "glog" || cfg.Network != "" || cfg.Tag != "" {
+		t.Fatalf("config = %+v, caller's = %+v", h.cfg, *cfg)
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	var w msgpackWriter
+	values := []interface{}{int64(0), int64(-1), int64(-33), int64(-200), int64(-40000), int64(-3e9), uint64(1 << 40),
+		uint64(200), uint64(70000), uint64(1 << 33), "", string(make([]byte, 40)), string(make([]byte, 300)), 1.5, nil, false}
+	w.arrayHeader(len(values))
+	for _, v := range values {
+		w.value(v)
+	}
+	got, err := msgpackRead(bytes.NewReader(w.b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got.([]interface{}) {
+		want := values[i]
+		if u, ok := want.(uint64); ok {
+			if u <= 0x7f {
+				want = int64(u)
+			}
+		}
+		if v != want {
+			t.Fatalf("value %d = %#v, want %#v", i, v, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/message"
+)
+
+type GELFCompression int8
+
+const (
+	GELFCompressionNone GELFCompression = iota
+	GELFCompressionGzip
+	GELFCompressionZlib
+)
+
+const (
+	gelfChunkHeaderSize = 12 // magic, message id, sequence number and count
+	gelfMaxChunks       = 128
+)
+
+var gelfChunkMagic = [2]byte{0x1e, 0x0f}
+
+// GELFHandler sends the formatted entries to Graylog (see GELFFormatter). Over
+// UDP a message larger than ChunkSize is split into GELF chunks, and may be
+// compressed first; over TCP messages are null-byte framed. The connection is
+// dialed on the first message and again after a write error.
+type GELFHandler struct {
+	cfg       GELFHandlerConfig
+	conn      *netConn
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+}
+
+func NewGELFHandler(cfg *GELFHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*GELFHandler, error) {
+	if cfg == nil || cfg.Address == "" {
+		return nil, errors.New("gelf handler: Address is required")
+	}
+	h := &GELFHandler{
+		cfg:       *cfg,
+		formatter: fm,
+		filter:    ft,
+	}
+	switch h.cfg.Network {
+	case "":
+		h.cfg.Network = "udp"
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("gelf handler: unsupported network %q", cfg.Network)
+	}
+	if h.cfg.ChunkSize <= gelfChunkHeaderSize {
+		h.cfg.ChunkSize = 1420
+	}
+	h.conn = newNetConn(h.cfg.Network, h.cfg.Address, nil, h.cfg.Timeout)
+	return h, nil
+}
+
+func (h *GELFHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	if h.formatter == nil {
+		return errors.New("formatter is nil")
+	}
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if h.conn.isStream() {
+		return h.conn.Write(append(data, 0))
+	}
+	if h.cfg.Compression != GELFCompressionNone && len(data) >= h.cfg.CompressionThreshold {
+		if data, err = gelfCompress(h.cfg.Compression, data); err != nil {
+			return err
+		}
+	}
+	if len(data) <= h.cfg.ChunkSize {
+		return h.conn.Write(data)
+	}
+	chunks, err := h.chunks(data)
+	if err != nil {
+		return err
+	}
+	return h.conn.Write(chunks...)
+}
+
+func (h *GELFHandler) chunks(data []byte) ([][]byte, error) {
+	size := h.cfg.ChunkSize - gelfChunkHeaderSize
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("gelf handler: message of %d bytes needs %d chunks, at most %d are allowed", len(data), count, gelfMaxChunks)
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*size)
+		chunk = append(chunk, gelfChunkMagic[:]...)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data[i*size:end]...))
+	}
+	return chunks, nil
+}
+
+func gelfCompress(c GELFCompression, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if c == GELFCompressionZlib {
+		w = zlib.NewWriter(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *GELFHandler) Close() error {
+	return h.conn.Close()
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func gelfFormatter() formatter.IFormatter {
+	return formatter.NewGELFFormatter(formatter.GELFFormatterConfig{
+		BaseFormatterConfig: formatter.BaseFormatterConfig{LoggerName: "api"},
+		Host:                "web-1",
+	})
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) []byte {
+	t.Helper()
+	buf := make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestGELFHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	h, err := NewGELFHandler((&GELFHandlerConfig{}).WithAddress(pc.LocalAddr().String()), gelfFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	err = h.Emit(&message.Entry{
+		Message: "request failed\nstack trace",
+		TraceID: "t-1",
+		Time:    time.Unix(1700000000, 250e6),
+		Level:   level.ErrorLevel,
+		Caller:  &runtime.Frame{Function: "main.handle", File: "/src/main.go", Line: 7},
+		Fields:  message.FieldsFromKV("user id", "u1", "id", 3, "ok", true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err = json.Unmarshal(readDatagram(t, pc), &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "web-1",
+		"short_message": "request failed",
+		"full_message":  "request failed\nstack trace",
+		"timestamp":     1700000000.25,
+		"level":         float64(3),
+		"_logger":       "api",
+		"_caller":       "/src/main.go:7",
+		"_function":     "main.handle",
+		"_trace_id":     "t-1",
+		"_user_id":      "u1",
+		"__id":          float64(3),
+		"_ok":           "true",
+	}
+	for k, v := range want {
+		if msg[k] != v {
+			t.Fatalf("%s = %#v, want %#v (%v)", k, msg[k], v, msg)
+		}
+	}
+}
+
+// The defaults are set on a copy of the config, which may be shared.
+func TestGELFHandlerKeepsConfig(t *testing.T) {
+	cfg := &GELFHandlerConfig{Address: "127.0.0.1:12201"}
+	h, err := NewGELFHandler(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	if h.cfg.Network != "udp" || h.cfg.ChunkSize != 1420 || cfg.Network != "" || cfg.ChunkSize != 0 {
+		t.Fatalf("config = %+v, caller's = %+v", h.cfg, *cfg)
+	}
+}
+
+func TestGELFHandlerUDPChunksCompressed(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	cfg := (&GELFHandlerConfig{Address: pc.LocalAddr().String()}).
+		WithChunkSize(64).
+		WithCompression(GELFCompressionGzip, 10)
+	h, err := NewGELFHandler(cfg, gelfFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	// Varied content, so that it stays above one chunk once compressed.
+	var long strings.Builder
+	for i := 0; long.Len() < 2000; i++ {
+		long.WriteString(time.Duration(i * 7919).String())
+	}
+	if err = h.Emit(&message.Entry{Message: long.String(), Level: level.InfoLevel, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var id []byte
+	var chunks [][]byte
+	for count := 1; len(chunks) < count; {
+		d := readDatagram(t, pc)
+		if len(d) > 64 || d[0] != 0x1e || d[1] != 0x0f {
+			t.Fatalf("bad chunk %x", d[:12])
+		}
+		if id == nil {
+			id = d[2:10]
+			count = int(d[11])
+			chunks = make([][]byte, 0, count)
+		}
+		if !bytes.Equal(d[2:10], id) || int(d[10]) != len(chunks) || int(d[11]) != count {
+			t.Fatalf("chunk header %x", d[:12])
+		}
+		chunks = append(chunks, d[12:])
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("chunks = %d", len(chunks))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err = json.Unmarshal(data, &msg); err != nil || msg["short_message"] != long.String() {
+		t.Fatalf("%v: %s", err, data)
+	}
+}
+
+func TestGELFHandlerTCPReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	frames := make(chan string, 10)
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					frame, err := r.ReadString(0)
+					if err != nil {
+						return
+					}
+					frames <- strings.TrimSuffix(frame, "\x00")
+				}
+			}()
+		}
+	}()
+
+	h, err := NewGELFHandler(&GELFHandlerConfig{Network: "tcp", Address: ln.Addr().String()}, gelfFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	next := func() map[string]interface{} {
+		t.Helper()
+		select {
+		case f := <-frames:
+			var msg map[string]interface{}
+			if err := json.Unmarshal([]byte(f), &msg); err != nil {
+				t.Fatalf("%v: %q", err, f)
+			}
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("no frame")
+			return nil
+		}
+	}
+
+	emitN(t, h, 2)
+	if m := next(); m["short_message"] != "m0" {
+		t.Fatalf("frame = %v", m)
+	}
+	if m := next(); m["short_message"] != "m1" {
+		t.Fatalf("frame = %v", m)
+	}
+
+	// The server drops the connection: the writes fail at some point and
+	// the handler dials again.
+	(<-accepted).Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_ = h.Emit(&message.Entry{Message: "after", Level: level.InfoLevel, Time: time.Now()})
+		select {
+		case f := <-frames:
+			if strings.Contains(f, `"after"`) {
+				return
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no frame after the reconnect")
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/message"
+)
+
+type HTTPEncoding int8
+
+const (
+	// HTTPEncodingNDJSON sends one formatted entry per line.
+	HTTPEncodingNDJSON HTTPEncoding = iota
+	// HTTPEncodingJSONArray sends the entries as a JSON array; entries that are
+	// not JSON (e.g. from the text formatter) become JSON strings.
+	HTTPEncodingJSONArray
+)
+
+// HTTPStatusError is returned for a response outside 2xx.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("http status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request is worth retrying: 408, 429 and 5xx.
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryAfter is the delay asked for by the Retry-After header, in seconds form.
+func (e *HTTPStatusError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// retryable reports whether err is a transport error or a temporary status.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *HTTPStatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	return true
+}
+
+// httpRequest is one POST of the network handlers.
+type httpRequest struct {
+	method      string
+	url         string
+	contentType string
+	headers     map[string]string
+	body        []byte
+	gzip        bool
+}
+
+// do sends the request and returns the body of a 2xx response.
+func (r httpRequest) do(ctx context.Context, client *http.Client) ([]byte, error) {
+	body := r.body
+	if r.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	method := r.method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", r.contentType)
+	if r.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		se := &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(respBody))}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			se.retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, se
+	}
+	return respBody, nil
+}
+
+func httpClient(client *http.Client, timeout time.Duration) *http.Client {
+	if client != nil {
+		return client
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// HTTPHandler ships the formatted entries in batches to an HTTP endpoint.
+type HTTPHandler struct {
+	cfg       *HTTPHandlerConfig
+	client    *http.Client
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+	sender    *batchSender
+}
+
+func NewHTTPHandler(cfg *HTTPHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*HTTPHandler, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("http handler: URL is required")
+	}
+	h := &HTTPHandler{
+		cfg:       cfg,
+		client:    httpClient(cfg.Client, cfg.Timeout),
+		formatter: fm,
+		filter:    ft,
+	}
+	h.sender = newBatchSender(cfg.Batch, cfg.Retry, cfg.Backpressure, h.send, cfg.ErrCallback)
+	return h, nil
+}
+
+func (h *HTTPHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	if h.formatter == nil {
+		return errors.New("formatter is nil")
+	}
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: bytes.TrimRight(data, "\n")})
+}
+
+func (h *HTTPHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	req := httpRequest{
+		method:      h.cfg.Method,
+		url:         h.cfg.URL,
+		contentType: "application/x-ndjson",
+		headers:     h.cfg.Headers,
+		body:        h.encode(items),
+		gzip:        h.cfg.Gzip,
+	}
+	if h.cfg.Encoding == HTTPEncodingJSONArray {
+		req.contentType = "application/json"
+	}
+	if _, err := req.do(ctx, h.client); err != nil {
+		if retryable(err) {
+			return items, err
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (h *HTTPHandler) encode(items []batchItem) []byte {
+	var buf bytes.Buffer
+	if h.cfg.Encoding == HTTPEncodingJSONArray {
+		buf.WriteByte('[')
+		for i, it := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if json.Valid(it.data) {
+				buf.Write(it.data)
+			} else {
+				s, _ := json.Marshal(string(it.data))
+				buf.Write(s)
+			}
+		}
+		buf.WriteByte(']')
+		return buf.Bytes()
+	}
+	for _, it := range items {
+		buf.Write(it.data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// Flush waits until the entries emitted before the call have been sent or
+// given up on, and returns the last delivery error.
+func (h *HTTPHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *HTTPHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close sends what is still queued, retries included.
+func (h *HTTPHandler) Close() error {
+	h.sender.close()
+	return nil
+}
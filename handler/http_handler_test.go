@@ -0,0 +1,362 @@
+package handler
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type recordedRequest struct {
+	header http.Header
+	body   string
+}
+
+// recordingServer answers with the statuses in order, then 200.
+func recordingServer(t *testing.T, statuses ...int) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+		mu.Lock()
+		n := len(reqs)
+		reqs = append(reqs, recordedRequest{header: r.Header.Clone(), body: string(data)})
+		mu.Unlock()
+		if n < len(statuses) {
+			w.WriteHeader(statuses[n])
+			_, _ = w.Write([]byte("nope"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), reqs...)
+	}
+}
+
+func fastRetry() RetryConfig {
+	return NewRetryConfig(3, time.Millisecond, 5*time.Millisecond).WithJitter(0)
+}
+
+func emitN(t *testing.T, h IHandler, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := h.Emit(&message.Entry{Message: fmt.Sprintf("m%d", i), Level: level.InfoLevel, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHTTPHandlerNDJSONBatches(t *testing.T) {
+	srv, requests := recordingServer(t)
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithHeader("Authorization", "Bearer x").
+		WithBatch(NewBatchConfig(3, 0, time.Hour)).
+		WithRetry(fastRetry())
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emitN(t, h, 7)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	reqs := requests()
+	var bodies []string
+	for _, r := range reqs {
+		bodies = append(bodies, r.body)
+		if ct := r.header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Fatalf("content type = %q", ct)
+		}
+		if auth := r.header.Get("Authorization"); auth != "Bearer x" {
+			t.Fatalf("authorization = %q", auth)
+		}
+	}
+	want := []string{"m0\nm1\nm2\n", "m3\nm4\nm5\n", "m6\n"}
+	if strings.Join(bodies, "|") != strings.Join(want, "|") {
+		t.Fatalf("bodies = %q", bodies)
+	}
+}
+
+func TestHTTPHandlerBatchMaxAge(t *testing.T) {
+	srv, requests := recordingServer(t)
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).WithBatch(NewBatchConfig(100, 0, 10*time.Millisecond))
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emitN(t, h, 2)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(requests()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("batch was not sent after MaxAge")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if body := requests()[0].body; body != "m0\nm1\n" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestHTTPHandlerGzipJSONArray(t *testing.T) {
+	srv, requests := recordingServer(t)
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).WithEncoding(HTTPEncodingJSONArray).WithGzip()
+	fm := formatter.NewJSONFormatter(formatter.JSONFormatterConfig{
+		BaseFormatterConfig: formatter.BaseFormatterConfig{TimeLayout: "2006-01-02 15:04:05"},
+	})
+	h, err := NewHTTPHandler(cfg, fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emitN(t, h, 2)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	reqs := requests()
+	if len(reqs) != 1 {
+		t.Fatalf("requests = %d", len(reqs))
+	}
+	if ce := reqs[0].header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("content encoding = %q", ce)
+	}
+	var records []map[string]interface{}
+	if err = json.Unmarshal([]byte(reqs[0].body), &records); err != nil {
+		t.Fatalf("%v: %s", err, reqs[0].body)
+	}
+	if len(records) != 2 || records[1]["msg"] != "m1" {
+		t.Fatalf("records = %v", records)
+	}
+}
+
+func TestHTTPHandlerRetriesTemporaryErrors(t *testing.T) {
+	srv, requests := recordingServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).WithRetry(fastRetry())
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emitN(t, h, 1)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	reqs := requests()
+	if len(reqs) != 3 || reqs[2].body != "m0\n" {
+		t.Fatalf("requests = %+v", reqs)
+	}
+}
+
+func TestHTTPHandlerReportsPermanentFailure(t *testing.T) {
+	srv, requests := recordingServer(t, http.StatusBadRequest)
+	var lost []*message.Entry
+	var cbErr error
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithRetry(fastRetry()).
+		WithErrCallback(func(buf interface{}, err error) {
+			lost, _ = buf.([]*message.Entry)
+			cbErr = err
+		})
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	emitN(t, h, 2)
+	err = h.Flush(context.Background())
+	var se *HTTPStatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || se.Body != "nope" {
+		t.Fatalf("flush err = %v", err)
+	}
+	if len(requests()) != 1 {
+		t.Fatalf("a 400 must not be retried, requests = %d", len(requests()))
+	}
+	if len(lost) != 2 || lost[0].Message != "m0" || cbErr != err {
+		t.Fatalf("ErrCallback got %v, %v", lost, cbErr)
+	}
+}
+
+func TestHTTPHandlerBackpressureWhenEndpointIsSlow(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer srv.Close()
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithBatch(NewBatchConfig(1, 0, time.Hour).WithQueueSize(1)).
+		WithBackpressure(NewBackpressureConfig(BackpressureStrategyDrop))
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitN(t, h, 1)
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var dropped int
+	for i := 0; i < 10; i++ {
+		if err := h.Emit(&message.Entry{Message: "x", Level: level.InfoLevel}); errors.Is(err, ErrBackpressureDropped) {
+			dropped++
+		}
+	}
+	close(release)
+	_ = h.Close()
+	stats := h.BackpressureStats()
+	if dropped == 0 || stats.Dropped != uint64(dropped) {
+		t.Fatalf("dropped = %d, stats = %+v", dropped, stats)
+	}
+}
+
+// The sampled entries that wait for room in the queue give up once closed.
+func TestHTTPHandlerSampleAfterClose(t *testing.T) {
+	srv, _ := recordingServer(t)
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithBatch(NewBatchConfig(1, 0, time.Hour).WithQueueSize(1)).
+		WithBackpressure(NewBackpressureConfig(BackpressureStrategySample).WithSampleRate(1))
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = h.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		// The first one fills the queue, nothing reads it anymore.
+		_ = h.Emit(&message.Entry{Message: "a", Level: level.InfoLevel})
+		done <- h.Emit(&message.Entry{Message: "b", Level: level.InfoLevel})
+	}()
+	select {
+	case err = <-done:
+		if !errors.Is(err, ErrBackpressureDropped) {
+			t.Fatalf("Emit = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Emit blocked after Close")
+	}
+}
+
+// A dead endpoint does not hold Close up for the retries of every batch.
+func TestHTTPHandlerCloseCancelsRetries(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	var mu sync.Mutex
+	var lost int
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithTimeout(time.Minute).
+		WithBatch(NewBatchConfig(1, 0, time.Hour).WithCloseTimeout(50 * time.Millisecond)).
+		WithRetry(NewRetryConfig(10, time.Second, time.Minute)).
+		WithErrCallback(func(buf interface{}, err error) {
+			mu.Lock()
+			lost += len(buf.([]*message.Entry))
+			mu.Unlock()
+		})
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitN(t, h, 3)
+
+	start := time.Now()
+	_ = h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if lost != 3 {
+		t.Fatalf("lost = %d, want the 3 entries reported", lost)
+	}
+}
+
+// A Flush that gives up stops waiting on the retries, the entries are kept.
+func TestHTTPHandlerFlushCancelsRetries(t *testing.T) {
+	var failing int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	var reported int32
+	cfg := (&HTTPHandlerConfig{URL: srv.URL}).
+		WithRetry(NewRetryConfig(10, time.Minute, time.Minute)).
+		WithErrCallback(func(interface{}, error) { atomic.AddInt32(&reported, 1) })
+	h, err := NewHTTPHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	emitN(t, h, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = h.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Flush: %v", err)
+	}
+	atomic.StoreInt32(&failing, 0)
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if n := atomic.LoadInt32(&reported); n != 0 {
+		t.Fatalf("reported %d batches", n)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	c := NewRetryConfig(5, 100*time.Millisecond, time.Second).WithJitter(0).Normalize()
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second} {
+		if got := c.Backoff(attempt, errors.New("x")); got != want {
+			t.Fatalf("attempt %d: backoff = %v, want %v", attempt, got, want)
+		}
+	}
+	if got := c.Backoff(0, &HTTPStatusError{StatusCode: 429, retryAfter: 30 * time.Second}); got != time.Second {
+		t.Fatalf("Retry-After must be capped by MaxBackoff, got %v", got)
+	}
+	j := c.WithJitter(0.5)
+	for i := 0; i < 100; i++ {
+		if got := j.Backoff(1, nil); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("jittered backoff = %v", got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalReserved are the fields the handler sets itself; entry fields of the
+// same name get a "FIELD_" prefix.
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"TRACE_ID":          true,
+}
+
+// JournaldHandler writes the entries to systemd-journald with its native
+// protocol, one datagram per entry: MESSAGE, PRIORITY, SYSLOG_IDENTIFIER,
+// CODE_FILE, CODE_LINE, CODE_FUNC, TRACE_ID and the entry fields, each as its
+// own journal field. An entry too large for a datagram is passed in a sealed
+// memfd instead. The formatter, if any, renders MESSAGE; the bare message is
+// used otherwise.
+type JournaldHandler struct {
+	addr       *net.UnixAddr
+	identifier string
+	severities map[level.LogLevel]int
+	fields     []byte // the encoded JournaldHandlerConfig.Fields
+	formatter  formatter.IFormatter
+	filter     filter.IFilter
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+func NewJournaldHandler(cfg *JournaldHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*JournaldHandler, error) {
+	if cfg == nil {
+		cfg = &JournaldHandlerConfig{}
+	}
+	path := cfg.SocketPath
+	if path == "" {
+		path = DefaultJournalSocket
+	}
+	h := &JournaldHandler{
+		addr:       &net.UnixAddr{Name: path, Net: "unixgram"},
+		identifier: cfg.Identifier,
+		severities: cfg.Severities,
+		formatter:  fm,
+		filter:     ft,
+	}
+	keys := make([]string, 0, len(cfg.Fields))
+	for k := range cfg.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		writeJournalField(&b, journalFieldName(k), cfg.Fields[k])
+	}
+	h.fields = b.Bytes()
+	return h, nil
+}
+
+func (h *JournaldHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	msg := e.Message
+	if h.formatter != nil {
+		data, err := h.formatter.Format(e)
+		if err != nil {
+			return err
+		}
+		msg = string(bytes.TrimRight(data, "\n"))
+	}
+	if err := h.send(h.encode(e, msg)); err != nil {
+		return fmt.Errorf("journald handler: %w", err)
+	}
+	return nil
+}
+
+func (h *JournaldHandler) encode(e *message.Entry, msg string) []byte {
+	var b bytes.Buffer
+	b.Grow(256 + len(msg))
+	writeJournalField(&b, "MESSAGE", msg)
+	severity, ok := h.severities[e.Level]
+	if !ok {
+		severity = formatter.SyslogSeverity(e.Level)
+	}
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(severity&7))
+	if h.identifier != "" {
+		writeJournalField(&b, "SYSLOG_IDENTIFIER", h.identifier)
+	}
+	if e.Caller != nil {
+		writeJournalField(&b, "CODE_FILE", e.Caller.File)
+		writeJournalField(&b, "CODE_LINE", strconv.Itoa(e.Caller.Line))
+		writeJournalField(&b, "CODE_FUNC", e.Caller.Function)
+	}
+	if e.TraceID != "" {
+		writeJournalField(&b, "TRACE_ID", e.TraceID)
+	}
+	b.Write(h.fields)
+	for _, f := range e.Fields {
+		writeJournalField(&b, journalFieldName(f.Key), f.String())
+	}
+	return b.Bytes()
+}
+
+// writeJournalField writes KEY=value, or KEY, the little endian length and the
+// value when it holds a newline.
+func writeJournalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if strings.IndexByte(value, '\n') < 0 {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.WriteByte('\n')
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName makes key a valid journal field name: uppercase letters,
+// digits and underscores, neither starting with an underscore (the trusted
+// fields) nor with a digit, at most 64 bytes.
+func journalFieldName(key string) string {
+	name := strings.TrimLeft(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key), "_")
+	if name == "" || name[0] <= '9' || journalReserved[name] {
+		name = "FIELD_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// send writes data to the socket, which is not connected so that a restart
+// of journald goes unnoticed.
+func (h *JournaldHandler) send(data []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+	}
+	_, _, err := h.conn.WriteMsgUnix(data, nil, h.addr)
+	if err != nil && journalTooLarge(err) {
+		err = sendJournalFile(h.conn, h.addr, data)
+	}
+	return err
+}
+
+func (h *JournaldHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
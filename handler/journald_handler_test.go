@@ -0,0 +1,164 @@
+//go:build linux
+// +build linux
+
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func listenJournal(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, path
+}
+
+// readJournal reads one entry, from the datagram or from the file descriptor
+// it carries, and decodes its fields.
+func readJournal(t *testing.T, conn *net.UnixConn) (map[string][]string, bool) {
+	t.Helper()
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	passed := oobn > 0
+	if passed {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "journal")
+		defer f.Close()
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if data, err = io.ReadAll(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := map[string][]string{}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("truncated entry %q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data, '\n')
+			fields[key] = append(fields[key], string(data[i+1:end]))
+			data = data[end+1:]
+			continue
+		}
+		size := int(binary.LittleEndian.Uint64(data[i+1:]))
+		start := i + 9
+		fields[key] = append(fields[key], string(data[start:start+size]))
+		data = data[start+size+1:]
+	}
+	return fields, passed
+}
+
+func TestJournaldHandlerFields(t *testing.T) {
+	conn, path := listenJournal(t)
+	cfg := (&JournaldHandlerConfig{}).
+		WithSocketPath(path).
+		WithIdentifier("api").
+		WithSeverity(level.PrintLevel, 5).
+		WithField("deployment", "prod")
+	h, err := NewJournaldHandler(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	err = h.Emit(&message.Entry{
+		Message: "request failed\nstack trace",
+		TraceID: "t-1",
+		Level:   level.ErrorLevel,
+		Caller:  &runtime.Frame{Function: "main.handle", File: "/src/main.go", Line: 7},
+		Fields:  message.FieldsFromKV("user.id", "u1", "_hidden", 1, "2fa", true, "message", "dup"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, passed := readJournal(t, conn)
+	if passed {
+		t.Fatal("small entry sent as a file descriptor")
+	}
+	want := map[string]string{
+		"MESSAGE":           "request failed\nstack trace",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "api",
+		"CODE_FILE":         "/src/main.go",
+		"CODE_LINE":         "7",
+		"CODE_FUNC":         "main.handle",
+		"TRACE_ID":          "t-1",
+		"DEPLOYMENT":        "prod",
+		"USER_ID":           "u1",
+		"HIDDEN":            "1",
+		"FIELD_2FA":         "true",
+		"FIELD_MESSAGE":     "dup",
+	}
+	for k, v := range want {
+		if got := fields[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	if err = h.Emit(&message.Entry{Message: "printed", Level: level.PrintLevel}); err != nil {
+		t.Fatal(err)
+	}
+	if fields, _ = readJournal(t, conn); fields["PRIORITY"][0] != "5" {
+		t.Errorf("PRIORITY = %v, want 5", fields["PRIORITY"])
+	}
+}
+
+func TestJournaldHandlerLargeEntry(t *testing.T) {
+	conn, path := listenJournal(t)
+	h, err := NewJournaldHandler((&JournaldHandlerConfig{}).WithSocketPath(path), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	// Above the default datagram limit of the unix sockets.
+	long := strings.Repeat("x", 512<<10)
+	if err = h.Emit(&message.Entry{Message: long, Level: level.InfoLevel}); err != nil {
+		t.Fatal(err)
+	}
+	fields, passed := readJournal(t, conn)
+	if !passed {
+		t.Fatal("large entry not sent as a file descriptor")
+	}
+	if got := fields["MESSAGE"]; len(got) != 1 || got[0] != long {
+		t.Fatalf("MESSAGE of %d bytes not received", len(long))
+	}
+}
@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+package handler
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	// F_SEAL_SEAL, F_SEAL_SHRINK, F_SEAL_GROW and F_SEAL_WRITE.
+	fSealAll = 0x1 | 0x2 | 0x4 | 0x8
+)
+
+// memfdCreateTrap is the memfd_create syscall number, which the syscall
+// package does not define on every architecture.
+var memfdCreateTrap = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// journalTooLarge reports whether the datagram was refused for its size.
+func journalTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFile passes data to journald as a file descriptor, in an empty
+// datagram.
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, data []byte) error {
+	f, err := journalFile(data)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), addr)
+	return err
+}
+
+// journalFile writes data to a sealed memfd, or to an unlinked file on /dev/shm
+// on the kernels without memfd_create; journald accepts both.
+func journalFile(data []byte) (*os.File, error) {
+	if trap, ok := memfdCreateTrap[runtime.GOARCH]; ok {
+		name := []byte("glog-journal\x00")
+		fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+		if errno == 0 {
+			f := os.NewFile(fd, "memfd:glog-journal")
+			if _, err := f.Write(data); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+			if _, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealAll); errno != 0 {
+				_ = f.Close()
+				return nil, errno
+			}
+			return f, nil
+		}
+		if errno != syscall.ENOSYS {
+			return nil, errno
+		}
+	}
+	f, err := os.CreateTemp("/dev/shm", "glog-journal-")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/message"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiHandler pushes the entries to Grafana Loki, one stream per label set:
+// logger, level and host, overridden by the static Labels, and the LabelFields
+// found in the entry.
+type LokiHandler struct {
+	cfg       *LokiHandlerConfig
+	client    *http.Client
+	url       string
+	host      string
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+	sender    *batchSender
+}
+
+func NewLokiHandler(cfg *LokiHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*LokiHandler, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("loki handler: URL is required")
+	}
+	host, _ := os.Hostname()
+	h := &LokiHandler{
+		cfg:       cfg,
+		client:    httpClient(cfg.Client, cfg.Timeout),
+		url:       cfg.URL,
+		host:      host,
+		formatter: fm,
+		filter:    ft,
+	}
+	if !strings.HasSuffix(h.url, lokiPushPath) {
+		h.url = strings.TrimSuffix(h.url, "/") + lokiPushPath
+	}
+	h.sender = newBatchSender(cfg.Batch, cfg.Retry, cfg.Backpressure, h.send, cfg.ErrCallback)
+	return h, nil
+}
+
+func (h *LokiHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	if h.formatter == nil {
+		return errors.New("formatter is nil")
+	}
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: bytes.TrimRight(data, "\n")})
+}
+
+// labels is the label set of e, e.g. {host="a", level="info", logger="api"}.
+func (h *LokiHandler) labels(e *message.Entry) map[string]string {
+	labels := make(map[string]string, len(h.cfg.Labels)+3+len(h.cfg.LabelFields))
+	if h.cfg.LoggerName != "" {
+		labels["logger"] = h.cfg.LoggerName
+	}
+	labels["level"] = strings.ToLower(e.Level.String())
+	if h.host != "" {
+		labels["host"] = h.host
+	}
+	for k, v := range h.cfg.Labels {
+		labels[lokiLabelName(k)] = v
+	}
+	for _, key := range h.cfg.LabelFields {
+		for _, f := range e.Fields {
+			if f.Key == key {
+				labels[lokiLabelName(key)] = f.String()
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// lokiLabelName replaces the characters Loki does not allow in label names.
+func lokiLabelName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// encode groups the items into streams, keeping their order within a stream.
+func (h *LokiHandler) encode(items []batchItem) ([]byte, error) {
+	var push lokiPushRequest
+	streams := make(map[string]*lokiStream)
+	for _, it := range items {
+		labels := h.labels(it.entry)
+		key := lokiStreamKey(labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: labels}
+			streams[key] = s
+			push.Streams = append(push.Streams, s)
+		}
+		ts := strconv.FormatInt(it.entry.Time.UnixNano(), 10)
+		s.Values = append(s.Values, [2]string{ts, string(it.data)})
+	}
+	return json.Marshal(push)
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func (h *LokiHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	body, err := h.encode(items)
+	if err != nil {
+		return nil, err
+	}
+	req := httpRequest{
+		url:         h.url,
+		contentType: "application/json",
+		headers:     h.cfg.Headers,
+		body:        body,
+		gzip:        h.cfg.Gzip,
+	}
+	if h.cfg.Tenant != "" {
+		req.headers = make(map[string]string, len(h.cfg.Headers)+1)
+		for k, v := range h.cfg.Headers {
+			req.headers[k] = v
+		}
+		req.headers["X-Scope-OrgID"] = h.cfg.Tenant
+	}
+	if _, err = req.do(ctx, h.client); err != nil {
+		if retryable(err) {
+			return items, err
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Flush waits until the entries emitted before the call have been pushed or
+// given up on, and returns the last delivery error.
+func (h *LokiHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *LokiHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close pushes what is still queued, retries included.
+func (h *LokiHandler) Close() error {
+	h.sender.close()
+	return nil
+}
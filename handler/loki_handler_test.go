@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func TestLokiHandlerPushesStreams(t *testing.T) {
+	var mu sync.Mutex
+	var pushes []lokiPushRequest
+	var paths, tenants []string
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		var push lokiPushRequest
+		if err := json.Unmarshal(data, &push); err != nil {
+			t.Errorf("%v: %s", err, data)
+		}
+		pushes = append(pushes, push)
+		paths = append(paths, r.URL.Path)
+		tenants = append(tenants, r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := (&LokiHandlerConfig{URL: srv.URL + "/", LoggerName: "api"}).
+		WithTenant("team-a").
+		WithLabel("env", "prod").
+		WithLabelFields("tenant.id").
+		WithRetry(fastRetry())
+	h, err := NewLokiHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	ts := time.Unix(1700000000, 5)
+	entries := []*message.Entry{
+		{Message: "a", Level: level.InfoLevel, Time: ts, Fields: message.FieldsFromKV("tenant.id", "t1")},
+		{Message: "b", Level: level.ErrorLevel, Time: ts, Fields: message.FieldsFromKV("tenant.id", "t1")},
+		{Message: "c", Level: level.InfoLevel, Time: ts.Add(time.Second), Fields: message.FieldsFromKV("tenant.id", "t1", "other", 1)},
+		{Message: "d", Level: level.InfoLevel, Time: ts, Fields: message.FieldsFromKV("tenant.id", "t2")},
+	}
+	for _, e := range entries {
+		if err = h.Emit(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushes) != 1 || paths[0] != "/loki/api/v1/push" || tenants[0] != "team-a" {
+		t.Fatalf("pushes = %d, paths = %v, tenants = %v", len(pushes), paths, tenants)
+	}
+	streams := pushes[0].Streams
+	if len(streams) != 3 {
+		t.Fatalf("streams = %+v", streams)
+	}
+	host, _ := os.Hostname()
+	first := streams[0]
+	want := map[string]string{"logger": "api", "level": "info", "host": host, "env": "prod", "tenant_id": "t1"}
+	for k, v := range want {
+		if first.Stream[k] != v {
+			t.Fatalf("label %s = %q, want %q (%v)", k, first.Stream[k], v, first.Stream)
+		}
+	}
+	if len(first.Values) != 2 || first.Values[0][0] != "1700000000000000005" ||
+		!strings.HasPrefix(first.Values[0][1], "a") || !strings.HasPrefix(first.Values[1][1], "c") {
+		t.Fatalf("values = %v", first.Values)
+	}
+	if streams[1].Stream["level"] != "error" || streams[2].Stream["tenant_id"] != "t2" {
+		t.Fatalf("streams = %+v", streams)
+	}
+}
+
+func TestLokiLabelName(t *testing.T) {
+	for in, want := range map[string]string{"app": "app", "k8s.pod-name": "k8s_pod_name", "1abc": "_abc"} {
+		if got := lokiLabelName(in); got != want {
+			t.Fatalf("lokiLabelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/ml444/glog/message"
+)
+
+// msgpackWriter appends the MessagePack encoding of the values the Fluent
+// forward protocol needs.
+type msgpackWriter struct {
+	b []byte
+}
+
+func (w *msgpackWriter) nil() {
+	w.b = append(w.b, 0xc0)
+}
+
+func (w *msgpackWriter) bool(v bool) {
+	if v {
+		w.b = append(w.b, 0xc3)
+	} else {
+		w.b = append(w.b, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) int(v int64) {
+	switch {
+	case v >= 0:
+		w.uint(uint64(v))
+	case v >= -32:
+		w.b = append(w.b, byte(v))
+	case v >= math.MinInt8:
+		w.b = append(w.b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		w.b = append(w.b, 0xd1)
+		w.b = appendUint16(w.b, uint16(v))
+	case v >= math.MinInt32:
+		w.b = append(w.b, 0xd2)
+		w.b = appendUint32(w.b, uint32(v))
+	default:
+		w.b = append(w.b, 0xd3)
+		w.b = appendUint64(w.b, uint64(v))
+	}
+}
+
+func (w *msgpackWriter) uint(v uint64) {
+	switch {
+	case v <= 0x7f:
+		w.b = append(w.b, byte(v))
+	case v <= math.MaxUint8:
+		w.b = append(w.b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		w.b = append(w.b, 0xcd)
+		w.b = appendUint16(w.b, uint16(v))
+	case v <= math.MaxUint32:
+		w.b = append(w.b, 0xce)
+		w.b = appendUint32(w.b, uint32(v))
+	default:
+		w.b = append(w.b, 0xcf)
+		w.b = appendUint64(w.b, v)
+	}
+}
+
+func (w *msgpackWriter) float(v float64) {
+	w.b = append(w.b, 0xcb)
+	w.b = appendUint64(w.b, math.Float64bits(v))
+}
+
+func (w *msgpackWriter) string(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		w.b = append(w.b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		w.b = append(w.b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		w.b = append(w.b, 0xda)
+		w.b = appendUint16(w.b, uint16(n))
+	default:
+		w.b = append(w.b, 0xdb)
+		w.b = appendUint32(w.b, uint32(n))
+	}
+	w.b = append(w.b, s...)
+}
+
+func (w *msgpackWriter) bin(v []byte) {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		w.b = append(w.b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		w.b = append(w.b, 0xc5)
+		w.b = appendUint16(w.b, uint16(n))
+	default:
+		w.b = append(w.b, 0xc6)
+		w.b = appendUint32(w.b, uint32(n))
+	}
+	w.b = append(w.b, v...)
+}
+
+func (w *msgpackWriter) arrayHeader(n int) {
+	switch {
+	case n <= 15:
+		w.b = append(w.b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		w.b = append(w.b, 0xdc)
+		w.b = appendUint16(w.b, uint16(n))
+	default:
+		w.b = append(w.b, 0xdd)
+		w.b = appendUint32(w.b, uint32(n))
+	}
+}
+
+func (w *msgpackWriter) mapHeader(n int) {
+	switch {
+	case n <= 15:
+		w.b = append(w.b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		w.b = append(w.b, 0xde)
+		w.b = appendUint16(w.b, uint16(n))
+	default:
+		w.b = append(w.b, 0xdf)
+		w.b = appendUint32(w.b, uint32(n))
+	}
+}
+
+// eventTime writes the Fluent EventTime extension (type 0): seconds and
+// nanoseconds as big endian uint32.
+func (w *msgpackWriter) eventTime(t time.Time) {
+	w.b = append(w.b, 0xd7, 0x00)
+	w.b = appendUint32(w.b, uint32(t.Unix()))
+	w.b = appendUint32(w.b, uint32(t.Nanosecond()))
+}
+
+// value writes the scalar kinds as they are and anything else as its string.
+func (w *msgpackWriter) value(v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		w.nil()
+	case string:
+		w.string(x)
+	case bool:
+		w.bool(x)
+	case int:
+		w.int(int64(x))
+	case int8:
+		w.int(int64(x))
+	case int16:
+		w.int(int64(x))
+	case int32:
+		w.int(int64(x))
+	case int64:
+		w.int(x)
+	case uint:
+		w.uint(uint64(x))
+	case uint8:
+		w.uint(uint64(x))
+	case uint16:
+		w.uint(uint64(x))
+	case uint32:
+		w.uint(uint64(x))
+	case uint64:
+		w.uint(x)
+	case float32:
+		w.float(float64(x))
+	case float64:
+		w.float(x)
+	case []byte:
+		w.bin(x)
+	default:
+		w.string(message.Field{Value: v}.String())
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// msgpackExt is an extension value read by msgpackRead.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackRead decodes one value: maps become map[string]interface{} (other
+// key types are an error), arrays []interface{}, integers int64 or uint64,
+// str string and bin []byte.
+func msgpackRead(r io.Reader) (interface{}, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return msgpackReadString(r, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return msgpackReadArray(r, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return msgpackReadMap(r, int(c&0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := msgpackReadLen(r, 1<<(c-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadBytes(r, n)
+	case 0xca:
+		v, err := msgpackReadUint(r, 4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := msgpackReadUint(r, 8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return msgpackReadUint(r, 1<<(c-0xcc))
+	case 0xd0:
+		v, err := msgpackReadUint(r, 1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := msgpackReadUint(r, 2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := msgpackReadUint(r, 4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := msgpackReadUint(r, 8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return msgpackReadExt(r, 1<<(c-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := msgpackReadLen(r, 1<<(c-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadExt(r, n)
+	case 0xd9, 0xda, 0xdb:
+		n, err := msgpackReadLen(r, 1<<(c-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadString(r, n)
+	case 0xdc, 0xdd:
+		n, err := msgpackReadLen(r, 2<<(c-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadArray(r, n)
+	case 0xde, 0xdf:
+		n, err := msgpackReadLen(r, 2<<(c-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadMap(r, n)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+func msgpackReadUint(r io.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func msgpackReadLen(r io.Reader, size int) (int, error) {
+	n, err := msgpackReadUint(r, size)
+	if err != nil {
+		return 0, err
+	}
+	if n > 64<<20 {
+		return 0, errors.New("msgpack: value too large")
+	}
+	return int(n), nil
+}
+
+func msgpackReadBytes(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func msgpackReadString(r io.Reader, n int) (string, error) {
+	b, err := msgpackReadBytes(r, n)
+	return string(b), err
+}
+
+func msgpackReadExt(r io.Reader, n int) (msgpackExt, error) {
+	typ, err := msgpackReadUint(r, 1)
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	data, err := msgpackReadBytes(r, n)
+	return msgpackExt{Type: int8(typ), Data: data}, err
+}
+
+func msgpackReadArray(r io.Reader, n int) ([]interface{}, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := msgpackRead(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func msgpackReadMap(r io.Reader, n int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := msgpackRead(r)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key of type %T", k)
+		}
+		if m[key], err = msgpackRead(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
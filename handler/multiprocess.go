@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// multiProcessRotator lets several processes append to the same file. Writes
+// hold a shared flock on a lock file next to the log (see FileHandler.realWrite),
+// DoRollover upgrades it to an exclusive one, so exactly one process renames the
+// file while the others pick up the new one.
+type multiProcessRotator struct {
+	inner multiProcessAware
+	lock  *processLock
+	file  *os.File
+}
+
+// multiProcessAware is implemented by the rotators usable with MultiProcess.
+type multiProcessAware interface {
+	IRotator
+	// adopt opens the file another process has rotated to, treating the
+	// rollover that is due as done.
+	adopt() (*os.File, error)
+	// setSize replaces the size accounting with the size of the shared file.
+	setSize(size int64)
+}
+
+func newMultiProcessRotator(cfg *FileHandlerConfig, rotator IRotator) (*multiProcessRotator, *processLock, error) {
+	inner, ok := rotator.(multiProcessAware)
+	if !ok {
+		return nil, nil, errors.New("rotator does not support multi-process mode")
+	}
+	lock, err := newProcessLock(lockFilePath(cfg), cfg.fileMode())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &multiProcessRotator{inner: inner, lock: lock}, lock, nil
+}
+
+// lockFilePath is a hidden file next to the log, e.g. ".app.log.lock", so that
+// it never matches the backup patterns.
+func lockFilePath(cfg *FileHandlerConfig) string {
+	var parties []string
+	if cfg.FileName != "" {
+		parties = append(parties, cfg.FileName)
+	}
+	parties = append(parties, cfg.FileSuffix, "lock")
+	return filepath.Join(cfg.FileDir, "."+strings.Join(parties, "."))
+}
+
+// NeedRollover is called with the shared lock held.
+func (r *multiProcessRotator) NeedRollover(msg []byte) (*os.File, bool, error) {
+	file, _, err := r.inner.NeedRollover(msg)
+	if err != nil || file == nil {
+		return file, false, err
+	}
+	r.file = file
+	moved, err := r.moved()
+	if err != nil {
+		return nil, false, err
+	}
+	if moved {
+		if r.file, err = r.inner.adopt(); err != nil {
+			return nil, false, err
+		}
+	}
+	st, err := r.file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	r.inner.setSize(st.Size())
+	file, need, err := r.inner.NeedRollover(msg)
+	r.file = file
+	return file, need, err
+}
+
+// moved reports whether another process has rotated the file away.
+func (r *multiProcessRotator) moved() (bool, error) {
+	if r.file == nil {
+		return false, nil
+	}
+	pathInfo, err := os.Stat(r.file.Name())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	fileInfo, err := r.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(pathInfo, fileInfo), nil
+}
+
+// DoRollover is called with the shared lock held. It is upgraded to an
+// exclusive lock for the rollover and downgraded again afterwards.
+func (r *multiProcessRotator) DoRollover() (*os.File, error) {
+	if err := r.lock.lockExclusive(); err != nil {
+		return nil, err
+	}
+	file, err := r.rollover()
+	if lockErr := r.lock.lockShared(); lockErr != nil && err == nil {
+		err = lockErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	return file, nil
+}
+
+func (r *multiProcessRotator) rollover() (*os.File, error) {
+	// The upgrade is not atomic: another process may have rotated in between.
+	moved, err := r.moved()
+	if err != nil {
+		return nil, err
+	}
+	if moved {
+		return r.inner.adopt()
+	}
+	return r.inner.DoRollover()
+}
+
+func (r *multiProcessRotator) Reopen() (*os.File, error) {
+	file, err := r.inner.Reopen()
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	return file, nil
+}
+
+func (r *multiProcessRotator) RecordBytesWritten(n int) {
+	r.inner.RecordBytesWritten(n)
+}
+
+func (r *multiProcessRotator) Sync() error {
+	return r.inner.Sync()
+}
+
+func (r *multiProcessRotator) Close() error {
+	err := r.inner.Close()
+	if lockErr := r.lock.close(); lockErr != nil && err == nil {
+		err = lockErr
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// Each FileHandler opens its own lock file description, so several handlers
+// in one process coordinate exactly like separate processes do.
+func TestMultiProcessSizeRotationKeepsAllLines(t *testing.T) {
+	const (
+		writers = 3
+		lines   = 300
+		maxSize = 2000
+	)
+	dir := t.TempDir()
+	var handlers []*FileHandler
+	for i := 0; i < writers; i++ {
+		cfg := (&FileHandlerConfig{
+			FileDir:       dir,
+			FileName:      "mp",
+			FileSuffix:    "log",
+			MaxFileSize:   maxSize,
+			BackupCount:   1000,
+			BufferSize:    16,
+			BulkWriteSize: 64,
+			RotatorType:   FileRotatorTypeSize,
+		}).WithMultiProcess().WithBackpressureStrategy(BackpressureStrategyBlock)
+		fm := formatter.NewTextFormatter(formatter.TextFormatterConfig{
+			BaseFormatterConfig: formatter.BaseFormatterConfig{TimeLayout: "2006-01-02 15:04:05"},
+			PatternStyle:        "%[Message]v",
+		})
+		h, err := NewFileHandler(cfg, fm, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handlers = append(handlers, h)
+	}
+
+	var wg sync.WaitGroup
+	for i, h := range handlers {
+		wg.Add(1)
+		go func(i int, h *FileHandler) {
+			defer wg.Done()
+			for n := 0; n < lines; n++ {
+				msg := fmt.Sprintf("w%d-%03d", i, n)
+				if err := h.Emit(&message.Entry{Message: msg, Level: level.InfoLevel, Time: time.Now()}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	for _, h := range handlers {
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "mp.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) < 2 {
+		t.Fatalf("expected rotated backups, got %v", paths)
+	}
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() > 2*maxSize {
+			t.Errorf("%s has %d bytes", p, st.Size())
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := sc.Text()
+			if !strings.HasPrefix(line, "w") || len(line) != len("w0-000") {
+				t.Errorf("torn line %q in %s", line, p)
+			}
+			if seen[line] {
+				t.Errorf("duplicate line %q", line)
+			}
+			seen[line] = true
+		}
+		_ = f.Close()
+	}
+	if len(seen) != writers*lines {
+		t.Fatalf("found %d lines, want %d", len(seen), writers*lines)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".mp.log.lock")); err != nil {
+		t.Fatalf("lock file: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errDialBackoff is returned without dialing while the peer is held down.
+var errDialBackoff = errors.New("waiting before dialing again")
+
+// netDialBackoff spaces the dials after failures, so that the writes to a
+// peer that is down fail fast instead of each waiting for a dial timeout.
+var netDialBackoff = NewRetryConfig(0, 500*time.Millisecond, 30*time.Second).Normalize()
+
+// netConn is a client connection dialed on demand. A failed write closes it;
+// on a stream network it is dialed again and the write retried once, as a
+// peer restart usually shows up as an error on the first write after it.
+// After a failed dial the writes fail with errDialBackoff until the next dial
+// is due.
+type netConn struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mu           sync.Mutex
+	conn         net.Conn
+	dialErr      error // of the last failed dial
+	dialFailures int
+	nextDial     time.Time
+}
+
+func newNetConn(network, address string, tlsConfig *tls.Config, timeout time.Duration) *netConn {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &netConn{network: network, address: address, tlsConfig: tlsConfig, timeout: timeout}
+}
+
+// isStream reports whether the network is a byte stream, without message boundaries.
+func (c *netConn) isStream() bool {
+	return strings.HasPrefix(c.network, "tcp") || c.network == "unix"
+}
+
+func (c *netConn) dial() error {
+	now := time.Now()
+	if now.Before(c.nextDial) {
+		return fmt.Errorf("%w until %s: %v", errDialBackoff, c.nextDial.Format(time.RFC3339), c.dialErr)
+	}
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, c.network, c.address, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(c.network, c.address)
+	}
+	if err != nil {
+		c.dialErr = err
+		c.nextDial = time.Now().Add(netDialBackoff.Backoff(c.dialFailures, nil))
+		c.dialFailures++
+		return err
+	}
+	c.conn = conn
+	c.dialErr, c.dialFailures, c.nextDial = nil, 0, time.Time{}
+	return nil
+}
+
+// Write writes each of msgs, e.g. the chunks of one message, in order.
+func (c *netConn) Write(msgs ...[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	attempts := 1
+	if c.isStream() {
+		attempts = 2
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if c.conn == nil {
+			if err = c.dial(); err != nil {
+				return err
+			}
+		}
+		if err = c.write(msgs); err == nil {
+			return nil
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+func (c *netConn) write(msgs [][]byte) error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	for _, m := range msgs {
+		if _, err := c.conn.Write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *netConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// dialContext dials address, over TLS with a non-nil tlsConfig, giving up when
+// ctx is done.
+func dialContext(ctx context.Context, dialer *net.Dialer, network, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, network, address)
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// interruptOnDone makes the pending and next I/O of conn fail once ctx is
+// done; stop ends the watch and returns once it no longer touches conn.
+func interruptOnDone(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
@@ -0,0 +1,408 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type OTLPEncoding int8
+
+const (
+	// OTLPEncodingProtobuf sends application/x-protobuf.
+	OTLPEncodingProtobuf OTLPEncoding = iota
+	// OTLPEncodingJSON sends the OTLP/JSON mapping of the same messages.
+	OTLPEncodingJSON
+)
+
+const (
+	otlpLogsPath  = "/v1/logs"
+	otlpScopeName = "github.com/ml444/glog"
+)
+
+// OTLPSeverity maps lvl to the OpenTelemetry SeverityNumber and SeverityText.
+func OTLPSeverity(lvl level.LogLevel) (int32, string) {
+	switch lvl {
+	case level.DebugLevel:
+		return 5, lvl.String()
+	case level.PrintLevel, level.InfoLevel:
+		return 9, lvl.String()
+	case level.WarnLevel:
+		return 13, lvl.String()
+	case level.ErrorLevel:
+		return 17, lvl.String()
+	case level.PanicLevel:
+		return 21, lvl.String()
+	case level.FatalLevel:
+		return 22, lvl.String()
+	default:
+		return 0, ""
+	}
+}
+
+// OTLPHandler exports the entries as OTLP LogRecords over HTTP. The message is
+// the body, the fields and the caller are attributes, the TraceID goes into
+// trace_id when it is 16 bytes of hex (an attribute "trace_id" otherwise), and
+// the service name, host and pid describe the resource.
+type OTLPHandler struct {
+	cfg      *OTLPHandlerConfig
+	client   *http.Client
+	url      string
+	resource []otlpKeyValue
+	filter   filter.IFilter
+	sender   *batchSender
+}
+
+func NewOTLPHandler(cfg *OTLPHandlerConfig, ft filter.IFilter) (*OTLPHandler, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("otlp handler: URL is required")
+	}
+	h := &OTLPHandler{
+		cfg:    cfg,
+		client: httpClient(cfg.Client, cfg.Timeout),
+		url:    cfg.URL,
+		filter: ft,
+	}
+	if !strings.HasSuffix(h.url, otlpLogsPath) {
+		h.url = strings.TrimSuffix(h.url, "/") + otlpLogsPath
+	}
+	if cfg.ServiceName != "" {
+		h.resource = append(h.resource, otlpString("service.name", cfg.ServiceName))
+	}
+	if host, err := os.Hostname(); err == nil {
+		h.resource = append(h.resource, otlpString("host.name", host))
+	}
+	h.resource = append(h.resource, otlpKeyValue{Key: "process.pid", Value: otlpAnyValue{kind: otlpInt, i: int64(os.Getpid())}})
+	for _, f := range message.FieldsFromMap(cfg.ResourceAttributes) {
+		h.resource = append(h.resource, otlpString(f.Key, f.String()))
+	}
+	h.sender = newBatchSender(cfg.Batch, cfg.Retry, cfg.Backpressure, h.send, cfg.ErrCallback)
+	return h, nil
+}
+
+// Emit encodes the LogRecord right away, so that the batches are limited by
+// their encoded size.
+func (h *OTLPHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	r := newOTLPLogRecord(e)
+	var data []byte
+	if h.cfg.Encoding == OTLPEncodingJSON {
+		var err error
+		if data, err = json.Marshal(r.jsonRecord()); err != nil {
+			return err
+		}
+	} else {
+		var p protoBuffer
+		r.encodeProto(&p)
+		data = p.b
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: data})
+}
+
+func (h *OTLPHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	req := httpRequest{
+		url:     h.url,
+		headers: h.cfg.Headers,
+		gzip:    h.cfg.Gzip,
+	}
+	if h.cfg.Encoding == OTLPEncodingJSON {
+		req.contentType = "application/json"
+		req.body = h.encodeJSON(items)
+	} else {
+		req.contentType = "application/x-protobuf"
+		req.body = h.encodeProto(items)
+	}
+	if _, err := req.do(ctx, h.client); err != nil {
+		if retryable(err) {
+			return items, err
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// encodeProto wraps the encoded records into an ExportLogsServiceRequest.
+func (h *OTLPHandler) encodeProto(items []batchItem) []byte {
+	var p protoBuffer
+	p.messageField(1, func(rl *protoBuffer) { // ResourceLogs
+		rl.messageField(1, func(res *protoBuffer) { // Resource
+			for _, kv := range h.resource {
+				res.messageField(1, kv.encodeProto)
+			}
+		})
+		rl.messageField(2, func(sl *protoBuffer) { // ScopeLogs
+			sl.messageField(1, func(scope *protoBuffer) {
+				scope.stringField(1, otlpScopeName)
+			})
+			for _, it := range items {
+				sl.bytesField(2, it.data)
+			}
+		})
+	})
+	return p.b
+}
+
+func (h *OTLPHandler) encodeJSON(items []batchItem) []byte {
+	resource, _ := json.Marshal(h.resource)
+	var buf bytes.Buffer
+	buf.WriteString(`{"resourceLogs":[{"resource":{"attributes":`)
+	buf.Write(resource)
+	buf.WriteString(`},"scopeLogs":[{"scope":{"name":"` + otlpScopeName + `"},"logRecords":[`)
+	for i, it := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(it.data)
+	}
+	buf.WriteString(`]}]}]}`)
+	return buf.Bytes()
+}
+
+// Flush waits until the entries emitted before the call have been exported or
+// given up on, and returns the last delivery error.
+func (h *OTLPHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *OTLPHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close exports what is still queued, retries included.
+func (h *OTLPHandler) Close() error {
+	h.sender.close()
+	return nil
+}
+
+type otlpValueKind int8
+
+const (
+	otlpStringValue otlpValueKind = iota
+	otlpBool
+	otlpInt
+	otlpDouble
+	otlpBytes
+)
+
+// otlpAnyValue is the AnyValue message, limited to the scalar kinds.
+type otlpAnyValue struct {
+	kind otlpValueKind
+	s    string
+	b    bool
+	i    int64
+	f    float64
+	raw  []byte
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch x := v.(type) {
+	case string:
+		return otlpAnyValue{s: x}
+	case bool:
+		return otlpAnyValue{kind: otlpBool, b: x}
+	case int:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case int8:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case int16:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case int32:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case int64:
+		return otlpAnyValue{kind: otlpInt, i: x}
+	case uint8:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case uint16:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case uint32:
+		return otlpAnyValue{kind: otlpInt, i: int64(x)}
+	case uint:
+		if uint64(x) <= math.MaxInt64 {
+			return otlpAnyValue{kind: otlpInt, i: int64(x)}
+		}
+	case uint64:
+		if x <= math.MaxInt64 {
+			return otlpAnyValue{kind: otlpInt, i: int64(x)}
+		}
+	case float32:
+		return otlpAnyValue{kind: otlpDouble, f: float64(x)}
+	case float64:
+		return otlpAnyValue{kind: otlpDouble, f: x}
+	case []byte:
+		return otlpAnyValue{kind: otlpBytes, raw: x}
+	case time.Duration:
+		return otlpAnyValue{s: x.String()}
+	}
+	return otlpAnyValue{s: message.Field{Value: v}.String()}
+}
+
+// encodeProto writes the oneof member, defaults included.
+func (v otlpAnyValue) encodeProto(p *protoBuffer) {
+	switch v.kind {
+	case otlpBool:
+		p.tag(2, protoWireVarint)
+		if v.b {
+			p.varint(1)
+		} else {
+			p.varint(0)
+		}
+	case otlpInt:
+		p.tag(3, protoWireVarint)
+		p.varint(uint64(v.i))
+	case otlpDouble:
+		p.tag(4, protoWireFixed64)
+		p.fixed64(math.Float64bits(v.f))
+	case otlpBytes:
+		p.tag(7, protoWireBytes)
+		p.varint(uint64(len(v.raw)))
+		p.b = append(p.b, v.raw...)
+	default:
+		p.tag(1, protoWireBytes)
+		p.varint(uint64(len(v.s)))
+		p.b = append(p.b, v.s...)
+	}
+}
+
+// MarshalJSON follows the OTLP/JSON mapping: 64 bit integers are strings and
+// bytes are base64.
+func (v otlpAnyValue) MarshalJSON() ([]byte, error) {
+	switch v.kind {
+	case otlpBool:
+		return json.Marshal(map[string]bool{"boolValue": v.b})
+	case otlpInt:
+		return json.Marshal(map[string]string{"intValue": strconv.FormatInt(v.i, 10)})
+	case otlpDouble:
+		if math.IsNaN(v.f) || math.IsInf(v.f, 0) {
+			return json.Marshal(map[string]string{"stringValue": strconv.FormatFloat(v.f, 'g', -1, 64)})
+		}
+		return json.Marshal(map[string]float64{"doubleValue": v.f})
+	case otlpBytes:
+		return json.Marshal(map[string][]byte{"bytesValue": v.raw})
+	default:
+		return json.Marshal(map[string]string{"stringValue": v.s})
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{s: value}}
+}
+
+func (kv otlpKeyValue) encodeProto(p *protoBuffer) {
+	p.stringField(1, kv.Key)
+	p.messageField(2, kv.Value.encodeProto)
+}
+
+type otlpLogRecord struct {
+	time           uint64
+	observedTime   uint64
+	severityNumber int32
+	severityText   string
+	body           string
+	attributes     []otlpKeyValue
+	traceID        []byte
+}
+
+func newOTLPLogRecord(e *message.Entry) *otlpLogRecord {
+	now := time.Now()
+	r := &otlpLogRecord{
+		observedTime: uint64(now.UnixNano()),
+		body:         e.Message,
+	}
+	if !e.Time.IsZero() {
+		r.time = uint64(e.Time.UnixNano())
+	}
+	r.severityNumber, r.severityText = OTLPSeverity(e.Level)
+	if e.TraceID != "" {
+		if id := otlpTraceID(e.TraceID); id != nil {
+			r.traceID = id
+		} else {
+			r.attributes = append(r.attributes, otlpString("trace_id", e.TraceID))
+		}
+	}
+	if e.Caller != nil {
+		r.attributes = append(r.attributes,
+			otlpString("code.function", e.Caller.Function),
+			otlpString("code.filepath", e.Caller.File),
+			otlpKeyValue{Key: "code.lineno", Value: otlpAnyValue{kind: otlpInt, i: int64(e.Caller.Line)}},
+		)
+	}
+	if e.RoutineID != 0 {
+		r.attributes = append(r.attributes, otlpKeyValue{Key: "thread.id", Value: otlpAnyValue{kind: otlpInt, i: e.RoutineID}})
+	}
+	for _, f := range e.Fields {
+		r.attributes = append(r.attributes, otlpKeyValue{Key: f.Key, Value: otlpValue(f.Value)})
+	}
+	return r
+}
+
+// otlpTraceID decodes a 32 digit hex trace id, dashes (UUID form) allowed. An
+// all zero id is invalid in OTLP.
+func otlpTraceID(s string) []byte {
+	s = strings.ReplaceAll(s, "-", "")
+	if len(s) != 32 {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil || bytes.Equal(id, make([]byte, 16)) {
+		return nil
+	}
+	return id
+}
+
+// encodeProto writes the LogRecord message.
+func (r *otlpLogRecord) encodeProto(p *protoBuffer) {
+	p.fixed64Field(1, r.time)
+	p.uint64Field(2, uint64(r.severityNumber))
+	p.stringField(3, r.severityText)
+	p.messageField(5, otlpAnyValue{s: r.body}.encodeProto)
+	for _, kv := range r.attributes {
+		p.messageField(6, kv.encodeProto)
+	}
+	p.bytesField(9, r.traceID)
+	p.fixed64Field(11, r.observedTime)
+}
+
+type otlpJSONLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int32          `json:"severityNumber,omitempty"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+}
+
+// jsonRecord is r in the OTLP/JSON mapping, where the trace id is hex.
+func (r *otlpLogRecord) jsonRecord() *otlpJSONLogRecord {
+	j := &otlpJSONLogRecord{
+		ObservedTimeUnixNano: strconv.FormatUint(r.observedTime, 10),
+		SeverityNumber:       r.severityNumber,
+		SeverityText:         r.severityText,
+		Body:                 otlpAnyValue{s: r.body},
+		Attributes:           r.attributes,
+		TraceID:              hex.EncodeToString(r.traceID),
+	}
+	if r.time != 0 {
+		j.TimeUnixNano = strconv.FormatUint(r.time, 10)
+	}
+	return j
+}
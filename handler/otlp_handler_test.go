@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// otlpServer records the bodies posted to /v1/logs.
+func otlpServer(t *testing.T) (*httptest.Server, func() (string, []byte)) {
+	t.Helper()
+	var mu sync.Mutex
+	var contentType string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		contentType, body = r.Header.Get("Content-Type"), data
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() (string, []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		return contentType, body
+	}
+}
+
+func otlpTestEntry() *message.Entry {
+	return &message.Entry{
+		Message: "payment failed",
+		TraceID: "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+		Time:    time.Unix(1700000000, 42),
+		Level:   level.ErrorLevel,
+		Caller:  &runtime.Frame{Function: "main.pay", File: "/src/pay.go", Line: 12},
+		Fields:  message.FieldsFromKV("amount", 42, "ok", false, "ratio", 0.5, "user", "u1"),
+	}
+}
+
+func TestOTLPHandlerJSON(t *testing.T) {
+	srv, last := otlpServer(t)
+	cfg := (&OTLPHandlerConfig{URL: srv.URL}).
+		WithEncoding(OTLPEncodingJSON).
+		WithServiceName("billing").
+		WithRetry(fastRetry())
+	h, err := NewOTLPHandler(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	if err = h.Emit(otlpTestEntry()); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	contentType, body := last()
+	if contentType != "application/json" {
+		t.Fatalf("content type = %q", contentType)
+	}
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []otlpTestKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string             `json:"timeUnixNano"`
+					SeverityNumber int                `json:"severityNumber"`
+					SeverityText   string             `json:"severityText"`
+					Body           map[string]string  `json:"body"`
+					Attributes     []otlpTestKeyValue `json:"attributes"`
+					TraceID        string             `json:"traceId"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err = json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	resource := otlpTestAttributes(req.ResourceLogs[0].Resource.Attributes)
+	if resource["service.name"] != `{"stringValue":"billing"}` || resource["process.pid"] == "" {
+		t.Fatalf("resource = %v", resource)
+	}
+	r := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if r.TimeUnixNano != "1700000000000000042" || r.SeverityNumber != 17 || r.SeverityText != "ERROR" ||
+		r.Body["stringValue"] != "payment failed" || r.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("record = %+v", r)
+	}
+	attrs := otlpTestAttributes(r.Attributes)
+	want := map[string]string{
+		"code.function": `{"stringValue":"main.pay"}`,
+		"code.lineno":   `{"intValue":"12"}`,
+		"amount":        `{"intValue":"42"}`,
+		"ok":            `{"boolValue":false}`,
+		"ratio":         `{"doubleValue":0.5}`,
+		"user":          `{"stringValue":"u1"}`,
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Fatalf("attribute %s = %s, want %s", k, attrs[k], v)
+		}
+	}
+}
+
+type otlpTestKeyValue struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func otlpTestAttributes(kvs []otlpTestKeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = string(kv.Value)
+	}
+	return m
+}
+
+// protoFields decodes one level of the protobuf wire format; varint and
+// fixed64 values are returned as 8 little endian bytes.
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", b)
+		}
+		b = b[n:]
+		var v []byte
+		switch key & 7 {
+		case protoWireVarint:
+			x, n := binary.Uvarint(b)
+			v = make([]byte, 8)
+			binary.LittleEndian.PutUint64(v, x)
+			b = b[n:]
+		case protoWireFixed64:
+			v, b = b[:8], b[8:]
+		case protoWireBytes:
+			l, n := binary.Uvarint(b)
+			v, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], v)
+	}
+	return fields
+}
+
+func TestOTLPHandlerProtobuf(t *testing.T) {
+	srv, last := otlpServer(t)
+	h, err := NewOTLPHandler((&OTLPHandlerConfig{URL: srv.URL + "/"}).WithServiceName("billing").WithRetry(fastRetry()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	emitted := otlpTestEntry()
+	if err = h.Emit(emitted); err != nil {
+		t.Fatal(err)
+	}
+	emitted.TraceID = "not-a-trace-id"
+	if err = h.Emit(emitted); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	contentType, body := last()
+	if contentType != "application/x-protobuf" {
+		t.Fatalf("content type = %q", contentType)
+	}
+	resourceLogs := protoFields(t, protoFields(t, body)[1][0])
+	resource := protoFields(t, resourceLogs[1][0])
+	host, _ := os.Hostname()
+	keys := map[string]string{}
+	for _, kv := range resource[1] {
+		f := protoFields(t, kv)
+		value := protoFields(t, f[2][0])
+		if s, ok := value[1]; ok {
+			keys[string(f[1][0])] = string(s[0])
+		}
+	}
+	if keys["service.name"] != "billing" || keys["host.name"] != host {
+		t.Fatalf("resource = %v", keys)
+	}
+	scopeLogs := protoFields(t, resourceLogs[2][0])
+	if len(scopeLogs[2]) != 2 {
+		t.Fatalf("records = %d", len(scopeLogs[2]))
+	}
+	r := protoFields(t, scopeLogs[2][0])
+	if binary.LittleEndian.Uint64(r[1][0]) != 1700000000000000042 || binary.LittleEndian.Uint64(r[2][0]) != 17 ||
+		string(r[3][0]) != "ERROR" || hex.EncodeToString(r[9][0]) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("record = %v", r)
+	}
+	if body := protoFields(t, r[5][0]); string(body[1][0]) != "payment failed" {
+		t.Fatalf("body = %q", body)
+	}
+	attrs := map[string]map[int][][]byte{}
+	for _, kv := range r[6] {
+		f := protoFields(t, kv)
+		attrs[string(f[1][0])] = protoFields(t, f[2][0])
+	}
+	if binary.LittleEndian.Uint64(attrs["code.lineno"][3][0]) != 12 || binary.LittleEndian.Uint64(attrs["ok"][2][0]) != 0 {
+		t.Fatalf("attributes = %v", attrs)
+	}
+	second := protoFields(t, scopeLogs[2][1])
+	if _, ok := second[9]; ok {
+		t.Fatalf("invalid trace id was sent as trace_id")
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/binary"
+)
+
+// protoBuffer writes the protobuf wire format, only what the OTLP messages need.
+type protoBuffer struct {
+	b []byte
+}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+func (p *protoBuffer) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	p.b = append(p.b, buf[:n]...)
+}
+
+func (p *protoBuffer) tag(field, wire int) {
+	p.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (p *protoBuffer) uint64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoWireVarint)
+	p.varint(v)
+}
+
+func (p *protoBuffer) fixed64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, protoWireFixed64)
+	p.fixed64(v)
+}
+
+func (p *protoBuffer) fixed64(v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	p.b = append(p.b, buf[:]...)
+}
+
+func (p *protoBuffer) bytesField(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(v)))
+	p.b = append(p.b, v...)
+}
+
+func (p *protoBuffer) stringField(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(v)))
+	p.b = append(p.b, v...)
+}
+
+// messageField writes the embedded message encoded by fn, even when empty.
+func (p *protoBuffer) messageField(field int, fn func(m *protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	p.tag(field, protoWireBytes)
+	p.varint(uint64(len(m.b)))
+	p.b = append(p.b, m.b...)
+}
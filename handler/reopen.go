@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IReopener is implemented by handlers that can reopen their files, e.g. after
+// an external tool such as logrotate moved them away.
+type IReopener interface {
+	Reopen() error
+}
+
+// ExternalRotator never rotates by itself. It leaves rotation to an external
+// tool and reopens its path on Reopen (see FileHandler.Reopen) or, with
+// DetectExternalRotation, when the file was moved away or truncated.
+type ExternalRotator struct {
+	cfg      *FileHandlerConfig
+	file     *os.File
+	filePath string
+}
+
+func NewExternalRotator(cfg *FileHandlerConfig) (*ExternalRotator, error) {
+	if cfg == nil {
+		return nil, errors.New("rotator config is nil")
+	}
+	r := &ExternalRotator{cfg: cfg}
+	if err := mkdir(cfg.FileDir, cfg.dirMode()); err != nil {
+		return nil, err
+	}
+	var parties []string
+	if cfg.FileName != "" {
+		parties = append(parties, cfg.FileName)
+	}
+	parties = append(parties, cfg.FileSuffix)
+	r.filePath = filepath.Join(cfg.FileDir, strings.Join(parties, "."))
+	return r, nil
+}
+
+func (r *ExternalRotator) NeedRollover(_ []byte) (*os.File, bool, error) {
+	if r.file == nil {
+		var err error
+		r.file, err = openLogFile(r.cfg, r.filePath)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return r.file, false, nil
+}
+
+func (r *ExternalRotator) DoRollover() (*os.File, error) {
+	return r.Reopen()
+}
+
+func (r *ExternalRotator) Reopen() (*os.File, error) {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+	f, err := openLogFile(r.cfg, r.filePath)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	return f, nil
+}
+
+func (r *ExternalRotator) RecordBytesWritten(_ int) {}
+
+func (r *ExternalRotator) Sync() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+func (r *ExternalRotator) Close() error {
+	if r.file == nil {
+		return errors.New("file not open")
+	}
+	return r.file.Sync()
+}
+
+// externalRotationWatcher detects that the file being written was moved away,
+// replaced or truncated (logrotate copytruncate) by another program.
+type externalRotationWatcher struct {
+	interval  time.Duration
+	nextCheck time.Time
+	file      *os.File
+	size      int64
+}
+
+func newExternalRotationWatcher(cfg *FileHandlerConfig) *externalRotationWatcher {
+	if !cfg.DetectExternalRotation {
+		return nil
+	}
+	interval := cfg.ReopenCheckInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &externalRotationWatcher{interval: interval}
+}
+
+// changed reports whether file no longer is the file at its path, or has shrunk.
+// The check runs at most once per interval.
+func (w *externalRotationWatcher) changed(file *os.File) (bool, error) {
+	now := time.Now()
+	if file != w.file {
+		st, err := file.Stat()
+		if err != nil {
+			return false, err
+		}
+		w.file = file
+		w.size = st.Size()
+		w.nextCheck = now.Add(w.interval)
+		return false, nil
+	}
+	if now.Before(w.nextCheck) {
+		return false, nil
+	}
+	w.nextCheck = now.Add(w.interval)
+	pathInfo, err := os.Stat(file.Name())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(pathInfo, fileInfo) || fileInfo.Size() < w.size {
+		return true, nil
+	}
+	w.size = fileInfo.Size()
+	return false, nil
+}
+
+func (w *externalRotationWatcher) written(n int) {
+	w.size += int64(n)
+}
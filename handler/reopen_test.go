@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func newExternalFileHandler(t *testing.T, dir string, detect bool) *FileHandler {
+	t.Helper()
+	cfg := &FileHandlerConfig{
+		FileDir:       dir,
+		FileName:      "ext",
+		FileSuffix:    "log",
+		BufferSize:    16,
+		BulkWriteSize: 256,
+		RotatorType:   FileRotatorTypeExternal,
+	}
+	if detect {
+		cfg.WithDetectExternalRotation(time.Millisecond)
+	}
+	fm := formatter.NewTextFormatter(formatter.TextFormatterConfig{
+		BaseFormatterConfig: formatter.BaseFormatterConfig{TimeLayout: "2006-01-02 15:04:05"},
+		PatternStyle:        "%[Message]v",
+	})
+	h, err := NewFileHandler(cfg, fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+func emitAndFlush(t *testing.T, h *FileHandler, msg string) {
+	t.Helper()
+	if err := h.Emit(&message.Entry{Message: msg, Level: level.InfoLevel, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileHandlerReopenAfterMove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ext.log")
+	h := newExternalFileHandler(t, dir, false)
+
+	emitAndFlush(t, h, "before")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	emitAndFlush(t, h, "after")
+
+	if got := readFile(t, path+".1"); got != "before\n" {
+		t.Fatalf("moved file = %q", got)
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Fatalf("reopened file = %q", got)
+	}
+}
+
+func TestFileHandlerDetectsMovedAndTruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ext.log")
+	h := newExternalFileHandler(t, dir, true)
+
+	emitAndFlush(t, h, "one")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	emitAndFlush(t, h, "two")
+	if got := readFile(t, path); got != "two\n" {
+		t.Fatalf("after move: file = %q", got)
+	}
+
+	// copytruncate
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	emitAndFlush(t, h, "three")
+	if got := readFile(t, path); got != "three\n" {
+		t.Fatalf("after truncate: file = %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "one\n" {
+		t.Fatalf("moved file = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backupCleaner removes the rotated backups that are older than MaxAge or exceed
+// the MaxTotalSize budget. It runs in its own goroutine after every rollover.
+type backupCleaner struct {
+	maxAge       time.Duration
+	maxTotalSize int64
+	list         func() ([]string, error)
+	removeFile   func(path string) error
+	errCallback  func(buf interface{}, err error)
+	now          func() time.Time
+
+	// mu keeps a cleanup apart from the renames and removals done in DoRollover.
+	mu        sync.Mutex
+	current   atomic.Value // string, the active file which is never removed
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newBackupCleaner returns nil when neither MaxAge nor MaxTotalSize is set.
+// list returns the paths of the backups, see collectRotatedBackupPaths, and
+// removeFile removes one, see backupCompressor.remove.
+func newBackupCleaner(cfg *FileHandlerConfig, list func() ([]string, error), removeFile func(path string) error) *backupCleaner {
+	if cfg.MaxAge <= 0 && cfg.MaxTotalSize <= 0 {
+		return nil
+	}
+	c := &backupCleaner{
+		maxAge:       cfg.MaxAge,
+		maxTotalSize: cfg.MaxTotalSize,
+		list:         list,
+		removeFile:   removeFile,
+		errCallback:  cfg.ErrCallback,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	c.current.Store("")
+	go c.run()
+	return c
+}
+
+func (c *backupCleaner) run() {
+	defer close(c.done)
+	for {
+		select {
+		case <-c.wake:
+			c.clean()
+		case <-c.stop:
+			select {
+			case <-c.wake:
+				c.clean()
+			default:
+			}
+			return
+		}
+	}
+}
+
+// trigger schedules a cleanup; current is the file being written.
+func (c *backupCleaner) trigger(current string) {
+	if c == nil {
+		return
+	}
+	c.current.Store(current)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+		// A cleanup is already pending.
+	}
+}
+
+func (c *backupCleaner) close() {
+	if c == nil {
+		return
+	}
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+}
+
+func (c *backupCleaner) lock() {
+	if c != nil {
+		c.mu.Lock()
+	}
+}
+
+func (c *backupCleaner) unlock() {
+	if c != nil {
+		c.mu.Unlock()
+	}
+}
+
+type backupFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *backupCleaner) clean() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths, err := c.list()
+	if err != nil {
+		c.report(nil, err)
+		return
+	}
+	current, _ := c.current.Load().(string)
+	files := make([]backupFile, 0, len(paths))
+	for _, p := range paths {
+		if p == current {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				c.report(p, err)
+			}
+			continue
+		}
+		files = append(files, backupFile{path: p, size: info.Size(), modTime: info.ModTime()})
+	}
+	// oldest first
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].path < files[j].path
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	if c.maxAge > 0 {
+		cutoff := c.now().Add(-c.maxAge)
+		kept := files[:0]
+		for _, f := range files {
+			if f.modTime.Before(cutoff) {
+				c.remove(f.path)
+				continue
+			}
+			kept = append(kept, f)
+		}
+		files = kept
+	}
+	if c.maxTotalSize > 0 {
+		var total int64
+		for _, f := range files {
+			total += f.size
+		}
+		for _, f := range files {
+			if total <= c.maxTotalSize {
+				break
+			}
+			if c.remove(f.path) {
+				total -= f.size
+			}
+		}
+	}
+}
+
+func (c *backupCleaner) remove(path string) bool {
+	if err := c.removeFile(path); err != nil && !os.IsNotExist(err) {
+		c.report(path, err)
+		return false
+	}
+	return true
+}
+
+func (c *backupCleaner) report(v interface{}, err error) {
+	if c.errCallback != nil {
+		c.errCallback(v, err)
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeBackup(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mt := time.Now().Add(-age)
+	if err := os.Chtimes(path, mt, mt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeRotatorRetentionByAgeAndTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "ret.log")
+	writeBackup(t, base+".2024010100", 10, 10*24*time.Hour)
+	writeBackup(t, base+".2024010200", 10, 9*24*time.Hour)
+	writeBackup(t, base+".2024010300", 100, 3*time.Hour)
+	writeBackup(t, base+".2024010400", 100, 2*time.Hour)
+	writeBackup(t, base+".2024010500", 100, time.Hour)
+	writeBackup(t, filepath.Join(dir, "other.txt"), 10, 30*24*time.Hour)
+
+	var reported []error
+	cfg := &FileHandlerConfig{
+		FileDir:      dir,
+		FileName:     "ret",
+		FileSuffix:   "log",
+		ReMatch:      `^\d{10}(\.\w+)?$`,
+		MaxAge:       7 * 24 * time.Hour,
+		MaxTotalSize: 250,
+		ErrCallback:  func(_ interface{}, err error) { reported = append(reported, err) },
+	}
+	r, err := NewTimeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close waits for the cleanup triggered by the constructor.
+	if _, _, err = r.NeedRollover(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 0 {
+		t.Fatalf("unexpected errors: %v", reported)
+	}
+
+	for name, want := range map[string]bool{
+		base + ".2024010100":            false, // too old
+		base + ".2024010200":            false, // too old
+		base + ".2024010300":            false, // oldest beyond the size budget
+		base + ".2024010400":            true,
+		base + ".2024010500":            true,
+		base:                            true,
+		filepath.Join(dir, "other.txt"): true,
+	} {
+		if got := IsFileExist(name); got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// A backup removed by the retention while it is compressed does not come back
+// compressed.
+func TestRetentionRemovesBackupBeingCompressed(t *testing.T) {
+	dir := t.TempDir()
+	c := &blockingCompressor{started: make(chan struct{}), release: make(chan struct{})}
+	cfg := (&FileHandlerConfig{
+		FileDir:     dir,
+		FileName:    "ret",
+		FileSuffix:  "log",
+		MaxFileSize: 1 << 20,
+		BackupCount: 5,
+		MaxAge:      time.Hour,
+	}).WithCompression(c)
+	r, err := NewSizeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err := r.NeedRollover(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString("old\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.DoRollover(); err != nil {
+		t.Fatal(err)
+	}
+	<-c.started
+	// The backup expires while it is compressed.
+	base := filepath.Join(dir, "ret.log")
+	mt := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(base+".1", mt, mt); err != nil {
+		t.Fatal(err)
+	}
+	r.cleaner.trigger(r.filePath)
+	deadline := time.Now().Add(5 * time.Second)
+	for IsFileExist(base+".1") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(c.release)
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{base + ".1", base + ".1.gz", base + ".1.gz.tmp"} {
+		if IsFileExist(name) {
+			t.Errorf("%s must not exist", name)
+		}
+	}
+}
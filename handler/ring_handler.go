@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type RingStats struct {
+	Entries     int    // held at the moment
+	Bytes       int    // held at the moment
+	Evicted     uint64 // pushed out by newer entries
+	Subscribers int
+	// SubscriberDropped counts the entries not sent to a live stream that
+	// could not keep up.
+	SubscriberDropped uint64
+}
+
+// RingQuery selects the entries of a RingHandler; the zero value selects all.
+type RingQuery struct {
+	Level    level.LogLevel // minimum level
+	Since    time.Time
+	Until    time.Time
+	TraceID  string
+	Contains string // substring of the message, or of the formatted entry
+	AfterSeq uint64 // entries with a greater sequence number only
+	Limit    int    // the last Limit matches
+}
+
+// RingEntry is an entry of a RingHandler with its sequence number and, with a
+// formatter, its formatted form.
+type RingEntry struct {
+	Seq   uint64
+	Entry *message.Entry
+	Line  []byte
+}
+
+func (q *RingQuery) match(r *RingEntry) bool {
+	e := r.Entry
+	if e.Level < q.Level || r.Seq <= q.AfterSeq {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.TraceID != "" && e.TraceID != q.TraceID {
+		return false
+	}
+	if q.Contains == "" {
+		return true
+	}
+	if r.Line != nil {
+		return bytes.Contains(r.Line, []byte(q.Contains))
+	}
+	if strings.Contains(e.Message, q.Contains) {
+		return true
+	}
+	for _, f := range e.Fields {
+		if strings.Contains(f.Key, q.Contains) || strings.Contains(f.String(), q.Contains) {
+			return true
+		}
+	}
+	return false
+}
+
+// RingHandler keeps the last entries in memory, bounded by MaxEntries and
+// MaxBytes, for inspection with Query or over HTTP (see HTTPHandler). Live
+// streams get the new entries as they come; one that cannot keep up misses
+// entries rather than slowing the logger down.
+type RingHandler struct {
+	// First for their 64-bit alignment on 32-bit platforms.
+	evicted           uint64
+	subscriberDropped uint64
+
+	cfg       RingHandlerConfig
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+
+	mu     sync.Mutex
+	items  []RingEntry // ring of cfg.MaxEntries
+	start  int
+	count  int
+	bytes  int
+	seq    uint64
+	subs   map[*ringSubscriber]struct{}
+	closed bool
+}
+
+type ringSubscriber struct {
+	query RingQuery
+	ch    chan RingEntry
+}
+
+func NewRingHandler(cfg *RingHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*RingHandler, error) {
+	h := &RingHandler{formatter: fm, filter: ft, subs: make(map[*ringSubscriber]struct{})}
+	if cfg != nil {
+		h.cfg = *cfg
+	}
+	if h.cfg.MaxEntries <= 0 {
+		h.cfg.MaxEntries = 5000
+	}
+	if h.cfg.SubscriberBuffer <= 0 {
+		h.cfg.SubscriberBuffer = 256
+	}
+	h.items = make([]RingEntry, h.cfg.MaxEntries)
+	return h, nil
+}
+
+func (h *RingHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	r := RingEntry{Entry: e}
+	if h.formatter != nil {
+		line, err := h.formatter.Format(e)
+		if err != nil {
+			return err
+		}
+		r.Line = bytes.TrimRight(line, "\n")
+	}
+	size := ringEntrySize(&r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.seq++
+	r.Seq = h.seq
+	for h.count > 0 && (h.count == len(h.items) || h.cfg.MaxBytes > 0 && h.bytes+size > h.cfg.MaxBytes) {
+		h.bytes -= ringEntrySize(&h.items[h.start])
+		h.items[h.start] = RingEntry{}
+		h.start = (h.start + 1) % len(h.items)
+		h.count--
+		atomic.AddUint64(&h.evicted, 1)
+	}
+	h.items[(h.start+h.count)%len(h.items)] = r
+	h.count++
+	h.bytes += size
+
+	for sub := range h.subs {
+		if !sub.query.match(&r) {
+			continue
+		}
+		select {
+		case sub.ch <- r:
+		default:
+			atomic.AddUint64(&h.subscriberDropped, 1)
+		}
+	}
+	return nil
+}
+
+// ringEntrySize is the formatted size of the entry, or an estimate of it.
+func ringEntrySize(r *RingEntry) int {
+	if r.Line != nil {
+		return len(r.Line)
+	}
+	n := len(r.Entry.Message) + len(r.Entry.TraceID) + 32
+	for _, f := range r.Entry.Fields {
+		n += len(f.Key) + len(f.String()) + 2
+	}
+	return n
+}
+
+// Query returns the held entries that match q, oldest first.
+func (h *RingHandler) Query(q RingQuery) []RingEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.query(q)
+}
+
+func (h *RingHandler) query(q RingQuery) []RingEntry {
+	var entries []RingEntry
+	for i := 0; i < h.count; i++ {
+		r := h.items[(h.start+i)%len(h.items)]
+		if q.match(&r) {
+			entries = append(entries, r)
+		}
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries
+}
+
+// Subscribe returns the held entries matching q, then a channel of the new
+// ones; cancel releases the subscription. The channel is closed by cancel or
+// by Close.
+func (h *RingHandler) Subscribe(q RingQuery) (backlog []RingEntry, entries <-chan RingEntry, cancel func()) {
+	sub := &ringSubscriber{query: q, ch: make(chan RingEntry, h.cfg.SubscriberBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	backlog = h.query(q)
+	sub.query.Limit = 0
+	if h.closed {
+		close(sub.ch)
+		return backlog, sub.ch, func() {}
+	}
+	h.subs[sub] = struct{}{}
+	return backlog, sub.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[sub]; ok {
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+func (h *RingHandler) RingStats() RingStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return RingStats{
+		Entries:           h.count,
+		Bytes:             h.bytes,
+		Evicted:           atomic.LoadUint64(&h.evicted),
+		Subscribers:       len(h.subs),
+		SubscriberDropped: atomic.LoadUint64(&h.subscriberDropped),
+	}
+}
+
+// Close ends the live streams; the held entries can still be queried.
+func (h *RingHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func ringMessages(entries []RingEntry) []string {
+	msgs := make([]string, 0, len(entries))
+	for _, r := range entries {
+		msgs = append(msgs, r.Entry.Message)
+	}
+	return msgs
+}
+
+func TestRingHandlerBounds(t *testing.T) {
+	h, _ := NewRingHandler((&RingHandlerConfig{}).WithMaxEntries(3), nil, nil)
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		emitAll(t, h, &message.Entry{Message: msg, Level: level.InfoLevel})
+	}
+	if got := strings.Join(ringMessages(h.Query(RingQuery{})), ""); got != "bcd" {
+		t.Fatalf("entries bound: %q", got)
+	}
+
+	h, _ = NewRingHandler((&RingHandlerConfig{}).WithMaxBytes(200), nil, nil)
+	for _, msg := range []string{strings.Repeat("x", 60), "y", strings.Repeat("z", 60)} {
+		emitAll(t, h, &message.Entry{Message: msg, Level: level.InfoLevel})
+	}
+	got := ringMessages(h.Query(RingQuery{}))
+	if len(got) != 2 || got[0] != "y" {
+		t.Fatalf("bytes bound: %q", got)
+	}
+	if stats := h.RingStats(); stats.Entries != 2 || stats.Evicted != 1 || stats.Bytes > 200 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func ringFixture(t *testing.T) *RingHandler {
+	t.Helper()
+	h, _ := NewRingHandler(nil, nil, nil)
+	base := time.Now().Add(-time.Hour)
+	emitAll(t, h,
+		&message.Entry{Message: "boot", Level: level.InfoLevel, Time: base},
+		&message.Entry{Message: "cache miss", Level: level.DebugLevel, Time: base.Add(50 * time.Minute), TraceID: "t1"},
+		&message.Entry{Message: "query failed", Level: level.ErrorLevel, Time: base.Add(55 * time.Minute), TraceID: "t1",
+			Fields: message.FieldsFromKV("table", "users")},
+		&message.Entry{Message: "slow", Level: level.WarnLevel, Time: base.Add(58 * time.Minute), TraceID: "t2"},
+	)
+	return h
+}
+
+func TestRingHandlerHTTPQuery(t *testing.T) {
+	srv := httptest.NewServer(ringFixture(t).HTTPHandler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", "boot,cache miss,query failed,slow"},
+		{"level=warn", "query failed,slow"},
+		{"trace_id=t1", "cache miss,query failed"},
+		{"since=15m", "cache miss,query failed,slow"},
+		{"q=users", "query failed"},
+		{"level=debug&limit=2", "query failed,slow"},
+	} {
+		resp, err := http.Get(srv.URL + "?" + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []ringRecord
+		err = json.NewDecoder(resp.Body).Decode(&records)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		var msgs []string
+		for _, rec := range records {
+			msgs = append(msgs, rec.Message)
+		}
+		if got := strings.Join(msgs, ","); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "?format=text&trace_id=t1&level=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.HasSuffix(string(body), " ERROR <t1> query failed table=users\n") || strings.Count(string(body), "\n") != 1 {
+		t.Errorf("text: %q", body)
+	}
+
+	resp, err = http.Get(srv.URL + "?level=loud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad level: status %d", resp.StatusCode)
+	}
+}
+
+// readEvent reads the id and data of the next Server-Sent Event.
+func readEvent(t *testing.T, r *bufio.Reader) (id, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, data
+		case strings.HasPrefix(line, "id: "):
+			id = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			data += line[len("data: "):]
+		}
+	}
+}
+
+func TestRingHandlerSSE(t *testing.T) {
+	h := ringFixture(t)
+	mux := http.NewServeMux()
+	mux.Handle("/debug/logs", h.HTTPHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/debug/logs?level=warn", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// The entries after the last event seen first, then the live ones.
+	if id, data := readEvent(t, r); id != "4" || !strings.Contains(data, `"msg":"slow"`) {
+		t.Fatalf("backlog event %s: %s", id, data)
+	}
+	emitAll(t, h,
+		&message.Entry{Message: "ignored", Level: level.InfoLevel, Time: time.Now()},
+		&message.Entry{Message: "disk full", Level: level.ErrorLevel, Time: time.Now()},
+	)
+	id, data := readEvent(t, r)
+	var rec ringRecord
+	if err = json.Unmarshal([]byte(data), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if id != "6" || rec.Message != "disk full" || rec.Level != "ERROR" {
+		t.Fatalf("live event %s: %+v", id, rec)
+	}
+	if stats := h.RingStats(); stats.Subscribers != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Close ends the stream.
+	_ = h.Close()
+	if _, err = io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+const ringHeartbeat = 15 * time.Second
+
+// ringRecord is the JSON form of a RingEntry.
+type ringRecord struct {
+	Seq     uint64         `json:"seq"`
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"msg"`
+	TraceID string         `json:"trace_id,omitempty"`
+	Caller  string         `json:"caller,omitempty"`
+	Func    string         `json:"func,omitempty"`
+	Fields  message.Fields `json:"fields,omitempty"`
+}
+
+func newRingRecord(r *RingEntry) ringRecord {
+	e := r.Entry
+	rec := ringRecord{
+		Seq:     r.Seq,
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+		TraceID: e.TraceID,
+		Fields:  e.Fields,
+	}
+	if e.Caller != nil {
+		rec.Caller = e.Caller.File + ":" + strconv.Itoa(e.Caller.Line)
+		rec.Func = e.Caller.Function
+	}
+	return rec
+}
+
+// ringText is the formatted entry, or a plain rendering of it without formatter.
+func ringText(r *RingEntry) []byte {
+	if r.Line != nil {
+		return r.Line
+	}
+	e := r.Entry
+	var b bytes.Buffer
+	b.WriteString(e.Time.Format(time.RFC3339Nano))
+	b.WriteByte(' ')
+	b.WriteString(e.Level.String())
+	if e.TraceID != "" {
+		b.WriteString(" <" + e.TraceID + ">")
+	}
+	b.WriteByte(' ')
+	b.WriteString(e.Message)
+	for _, f := range e.Fields {
+		b.WriteString(" " + f.Key + "=" + f.String())
+	}
+	return b.Bytes()
+}
+
+// HTTPHandler serves the entries of h, to be mounted on any path, e.g.
+// mux.Handle("/debug/logs", ring.HTTPHandler()). The query parameters select
+// the entries:
+//
+//	level     minimum level, e.g. "warn"
+//	since     RFC 3339 time, or a duration before now such as "15m"
+//	until     same as since
+//	trace_id  entries of one trace
+//	q         substring of the message or of the formatted entry
+//	limit     the last N matches
+//	format    "json" (an array, the default) or "text" (one entry per line)
+//
+// With stream=1 or "Accept: text/event-stream" the new entries are sent as
+// Server-Sent Events whose id is the entry sequence number; the held entries
+// are sent first when limit is set, or after Last-Event-ID on a reconnection.
+func (h *RingHandler) HTTPHandler() http.Handler {
+	return http.HandlerFunc(h.serveHTTP)
+}
+
+func (h *RingHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseRingQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	text := r.URL.Query().Get("format") == "text"
+	if r.URL.Query().Get("stream") == "1" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.serveStream(w, r, q, text)
+		return
+	}
+
+	entries := h.Query(q)
+	if text {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for i := range entries {
+			_, _ = w.Write(append(ringText(&entries[i]), '\n'))
+		}
+		return
+	}
+	records := make([]ringRecord, 0, len(entries))
+	for i := range entries {
+		records = append(records, newRingRecord(&entries[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(records)
+}
+
+func parseRingQuery(r *http.Request, now time.Time) (RingQuery, error) {
+	v := r.URL.Query()
+	q := RingQuery{TraceID: v.Get("trace_id"), Contains: v.Get("q")}
+	var err error
+	if s := v.Get("level"); s != "" {
+		if q.Level, err = level.ParseLevel(s); err != nil {
+			return q, err
+		}
+	}
+	if q.Since, err = parseRingTime(v.Get("since"), now); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = parseRingTime(v.Get("until"), now); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("limit: invalid value %q", s)
+		}
+	}
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		if q.AfterSeq, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return q, fmt.Errorf("Last-Event-ID: invalid value %q", s)
+		}
+	}
+	return q, nil
+}
+
+func parseRingTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func (h *RingHandler) serveStream(w http.ResponseWriter, r *http.Request, q RingQuery, text bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	backlog, entries, cancel := h.Subscribe(q)
+	defer cancel()
+	if q.Limit == 0 && q.AfterSeq == 0 {
+		backlog = nil
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for i := range backlog {
+		writeRingEvent(w, &backlog[i], text)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(ringHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, _ = w.Write([]byte(": ping\n\n"))
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			writeRingEvent(w, &entry, text)
+		}
+		flusher.Flush()
+	}
+}
+
+func writeRingEvent(w http.ResponseWriter, r *RingEntry, text bool) {
+	var data []byte
+	if text {
+		data = ringText(r)
+	} else {
+		data, _ = json.Marshal(newRingRecord(r))
+	}
+	var b bytes.Buffer
+	b.WriteString("id: " + strconv.FormatUint(r.Seq, 10) + "\n")
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	_, _ = w.Write(b.Bytes())
+}
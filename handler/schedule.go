@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IClock is the time source of the rotators, tests can drive rotation with a fake one.
+type IClock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ISchedule decides when TimeRotator and TimeAndSizeRotator roll over.
+type ISchedule interface {
+	// Next returns the first rotation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// locationSchedule is implemented by the schedules that work in a time zone; the
+// rotators format the time suffix of the file names in the same zone.
+type locationSchedule interface {
+	Location() *time.Location
+}
+
+type calendarSchedule struct {
+	loc     *time.Location
+	period  string // "hour", "day" or "week"
+	weekday time.Weekday
+	hour    int
+	minute  int
+}
+
+// HourlySchedule rotates on the hour in loc (time.Local when nil).
+func HourlySchedule(loc *time.Location) ISchedule {
+	return &calendarSchedule{loc: orLocal(loc), period: "hour"}
+}
+
+// DailySchedule rotates every day at hour:minute in loc (time.Local when nil),
+// e.g. DailySchedule(0, 0, nil) rotates at local midnight.
+func DailySchedule(hour, minute int, loc *time.Location) ISchedule {
+	return &calendarSchedule{loc: orLocal(loc), period: "day", hour: hour, minute: minute}
+}
+
+// WeeklySchedule rotates every week on weekday at hour:minute in loc (time.Local when nil).
+func WeeklySchedule(weekday time.Weekday, hour, minute int, loc *time.Location) ISchedule {
+	return &calendarSchedule{loc: orLocal(loc), period: "week", weekday: weekday, hour: hour, minute: minute}
+}
+
+func orLocal(loc *time.Location) *time.Location {
+	if loc == nil {
+		return time.Local
+	}
+	return loc
+}
+
+func (s *calendarSchedule) Location() *time.Location { return s.loc }
+
+func (s *calendarSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc)
+	y, m, d := t.Date()
+	switch s.period {
+	case "hour":
+		next := time.Date(y, m, d, t.Hour(), 0, 0, 0, s.loc)
+		for !next.After(t) {
+			next = next.Add(time.Hour)
+		}
+		return next
+	case "week":
+		days := (int(s.weekday) - int(t.Weekday()) + 7) % 7
+		next := time.Date(y, m, d+days, s.hour, s.minute, 0, 0, s.loc)
+		if !next.After(t) {
+			next = time.Date(y, m, d+days+7, s.hour, s.minute, 0, 0, s.loc)
+		}
+		return next
+	default:
+		next := time.Date(y, m, d, s.hour, s.minute, 0, 0, s.loc)
+		if !next.After(t) {
+			next = time.Date(y, m, d+1, s.hour, s.minute, 0, 0, s.loc)
+		}
+		return next
+	}
+}
+
+// cronSchedule is a standard five-field cron expression:
+// minute hour day-of-month month day-of-week.
+type cronSchedule struct {
+	loc                          *time.Location
+	minute, hour, dom, month     uint64
+	dow                          uint64
+	domRestricted, dowRestricted bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDowNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCronSchedule parses a five-field cron expression ("0 0 * * 1" is every
+// Monday 00:00) or one of @hourly, @daily, @midnight, @weekly, @monthly, @yearly.
+// Fields accept *, numbers, names (jan, mon), ranges, lists and steps. When both
+// day-of-month and day-of-week are restricted, either one matching is enough.
+// The schedule runs in loc (time.Local when nil).
+func ParseCronSchedule(expr string, loc *time.Location) (ISchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+	s := &cronSchedule{loc: orLocal(loc)}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: minute: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: hour: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of month: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("cron expression %q: month: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDowNames); err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of week: %w", expr, err)
+	}
+	// 7 is Sunday as well
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domRestricted = fields[2] != "*" && !strings.HasPrefix(fields[2], "*/")
+	s.dowRestricted = fields[4] != "*" && !strings.HasPrefix(fields[4], "*/")
+	return s, nil
+}
+
+// MustParseCronSchedule is like ParseCronSchedule but panics on error.
+func MustParseCronSchedule(expr string, loc *time.Location) ISchedule {
+	s, err := ParseCronSchedule(expr, loc)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, errors.New("empty list item")
+		}
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) Location() *time.Location { return s.loc }
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// Next returns the zero time when nothing matches within five years (e.g. "0 0 30 2 *").
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		y, m, d := next.Date()
+		if s.month&(1<<uint(m)) == 0 {
+			next = time.Date(y, m+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if !s.dayMatches(next) {
+			next = time.Date(y, m, d+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.hour&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(y, m, d, next.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+		if s.minute&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// rolloverClock holds the clock and the schedule of a time based rotator. Without
+// a schedule it keeps the behavior of FileHandlerConfig.Interval.
+type rolloverClock struct {
+	clock    IClock
+	schedule ISchedule
+	interval int64
+}
+
+func newRolloverClock(cfg *FileHandlerConfig, interval int64) rolloverClock {
+	c := rolloverClock{clock: cfg.Clock, schedule: cfg.Schedule, interval: interval}
+	if c.clock == nil {
+		c.clock = systemClock{}
+	}
+	return c
+}
+
+func (c rolloverClock) now() time.Time {
+	return c.clock.Now()
+}
+
+// first returns the unix second of the first rollover after now.
+func (c rolloverClock) first(now time.Time) int64 {
+	if c.schedule != nil {
+		return c.scheduled(now)
+	}
+	return getRolloverSecond(now, c.interval)
+}
+
+// next returns the unix second of the rollover following the one done at now.
+func (c rolloverClock) next(now time.Time) int64 {
+	if c.schedule != nil {
+		return c.scheduled(now)
+	}
+	return now.Unix() + c.interval
+}
+
+func (c rolloverClock) scheduled(t time.Time) int64 {
+	next := c.schedule.Next(t)
+	if next.IsZero() {
+		return math.MaxInt64
+	}
+	return next.Unix()
+}
+
+// stale reports whether a file last modified at modTime belongs to a period
+// that ended before the one ending at rolloverAt.
+func (c rolloverClock) stale(modTime time.Time, rolloverAt int64) bool {
+	if c.schedule != nil {
+		return c.scheduled(modTime) < rolloverAt
+	}
+	return modTime.Unix()+c.interval < rolloverAt
+}
+
+// suffixTime converts t to the time zone of the schedule for the file name suffix.
+func (c rolloverClock) suffixTime(t time.Time) time.Time {
+	if ls, ok := c.schedule.(locationSchedule); ok {
+		return t.In(ls.Location())
+	}
+	return t
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func TestScheduleNext(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	// Wednesday
+	base := time.Date(2024, 6, 12, 10, 30, 15, 0, time.UTC)
+	cases := []struct {
+		name     string
+		schedule ISchedule
+		want     time.Time
+	}{
+		{"hourly", HourlySchedule(time.UTC), time.Date(2024, 6, 12, 11, 0, 0, 0, time.UTC)},
+		{"daily midnight in zone", DailySchedule(0, 0, shanghai), time.Date(2024, 6, 13, 0, 0, 0, 0, shanghai)},
+		{"daily later today", DailySchedule(12, 0, time.UTC), time.Date(2024, 6, 12, 12, 0, 0, 0, time.UTC)},
+		{"weekly monday", WeeklySchedule(time.Monday, 0, 0, time.UTC), time.Date(2024, 6, 17, 0, 0, 0, 0, time.UTC)},
+		{"cron monday", MustParseCronSchedule("0 0 * * mon", time.UTC), time.Date(2024, 6, 17, 0, 0, 0, 0, time.UTC)},
+		{"cron step", MustParseCronSchedule("*/15 * * * *", time.UTC), time.Date(2024, 6, 12, 10, 45, 0, 0, time.UTC)},
+		{"cron list and range", MustParseCronSchedule("5 1-3,22 * * *", time.UTC), time.Date(2024, 6, 12, 22, 5, 0, 0, time.UTC)},
+		{"cron dom or dow", MustParseCronSchedule("0 0 1 * 5", time.UTC), time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC)},
+		{"cron macro", MustParseCronSchedule("@monthly", time.UTC), time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if got := c.schedule.Next(base); !got.Equal(c.want) {
+			t.Errorf("%s: Next = %v, want %v", c.name, got, c.want)
+		}
+	}
+	if got := MustParseCronSchedule("0 0 30 2 *", time.UTC).Next(base); !got.IsZero() {
+		t.Errorf("impossible cron: Next = %v, want zero", got)
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCronSchedule(bad, nil); err == nil {
+			t.Errorf("ParseCronSchedule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTimeRotatorWithScheduleAndFakeClock(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2024, 6, 12, 23, 59, 0, 0, time.UTC)}
+	cfg := &FileHandlerConfig{
+		FileDir:       dir,
+		FileName:      "sched",
+		FileSuffix:    "log",
+		TimeSuffixFmt: "20060102",
+		ReMatch:       `^\d{8}$`,
+		Schedule:      DailySchedule(0, 0, time.UTC),
+		Clock:         clock,
+	}
+	r, err := NewTimeRotator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	if _, rotate, err := r.NeedRollover(nil); err != nil || rotate {
+		t.Fatalf("rotate=%v err=%v before midnight", rotate, err)
+	}
+	clock.Set(time.Date(2024, 6, 13, 0, 0, 1, 0, time.UTC))
+	_, rotate, err := r.NeedRollover(nil)
+	if err != nil || !rotate {
+		t.Fatalf("rotate=%v err=%v after midnight", rotate, err)
+	}
+	if _, err = r.DoRollover(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "sched.log.20240613")); err != nil {
+		t.Fatalf("backup missing: %v", err)
+	}
+	if _, rotate, _ = r.NeedRollover(nil); rotate {
+		t.Fatal("next rollover must be the following midnight")
+	}
+}
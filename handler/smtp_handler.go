@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// DefaultSMTPSubject is the subject of the digests, e.g. "[ERROR] api: 3 log entries".
+const DefaultSMTPSubject = `[{{.Level}}] {{.Logger}}: {{.Count}} log entries`
+
+// SMTPDigest is the data of the subject template.
+type SMTPDigest struct {
+	Logger string
+	Host   string
+	Level  string // the highest level of the entries
+	Count  int
+	First  time.Time
+	Last   time.Time
+}
+
+var errSMTPNoStartTLS = errors.New("smtp handler: server does not offer STARTTLS")
+
+// smtpRetryable reports whether a delivery is worth retrying: transport
+// errors and 4xx replies.
+func smtpRetryable(err error) bool {
+	if errors.Is(err, errSMTPNoStartTLS) {
+		return false
+	}
+	var te *textproto.Error
+	if errors.As(err, &te) {
+		return te.Code < 500
+	}
+	return true
+}
+
+// SMTPHandler mails the formatted entries in digests, one email per batch:
+// a digest goes out when it reaches Batch.MaxCount entries or Batch.MaxBytes,
+// or Batch.MaxAge after its first entry. It is meant for a worker at
+// ErrorLevel or above.
+type SMTPHandler struct {
+	cfg       SMTPHandlerConfig
+	host      string // of the relay, for TLS and authentication
+	hostname  string
+	formatter formatter.IFormatter
+	filter    filter.IFilter
+	subject   *template.Template
+	sender    *batchSender
+}
+
+func NewSMTPHandler(cfg *SMTPHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*SMTPHandler, error) {
+	if cfg == nil || cfg.Address == "" {
+		return nil, errors.New("smtp handler: Address is required")
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("smtp handler: From and To are required")
+	}
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("smtp handler: %w", err)
+	}
+	h := &SMTPHandler{cfg: *cfg, host: host, formatter: fm, filter: ft}
+	if h.cfg.Subject == "" {
+		h.cfg.Subject = DefaultSMTPSubject
+	}
+	if h.cfg.Timeout <= 0 {
+		h.cfg.Timeout = 30 * time.Second
+	}
+	if h.cfg.Batch.MaxAge <= 0 {
+		h.cfg.Batch.MaxAge = 5 * time.Minute
+	}
+	if h.subject, err = template.New("subject").Parse(h.cfg.Subject); err != nil {
+		return nil, fmt.Errorf("smtp handler: %w", err)
+	}
+	h.hostname, _ = os.Hostname()
+	h.sender = newBatchSender(h.cfg.Batch, h.cfg.Retry, h.cfg.Backpressure, h.send, h.cfg.ErrCallback)
+	return h, nil
+}
+
+func (h *SMTPHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	if h.formatter == nil {
+		return errors.New("formatter is nil")
+	}
+	data, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	return h.sender.enqueue(batchItem{entry: e, data: bytes.TrimRight(data, "\n")})
+}
+
+func (h *SMTPHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	msg, err := h.message(items, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err = h.deliver(ctx, msg); err != nil {
+		if smtpRetryable(err) {
+			return items, err
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// message builds the digest email of items.
+func (h *SMTPHandler) message(items []batchItem, now time.Time) ([]byte, error) {
+	d := SMTPDigest{Logger: h.cfg.LoggerName, Host: h.hostname, Count: len(items)}
+	highest := level.NoneLevel
+	for _, it := range items {
+		e := it.entry
+		if e.Level > highest {
+			highest = e.Level
+		}
+		if d.First.IsZero() || e.Time.Before(d.First) {
+			d.First = e.Time
+		}
+		if e.Time.After(d.Last) {
+			d.Last = e.Time
+		}
+	}
+	d.Level = highest.String()
+	var subject strings.Builder
+	if err := h.subject.Execute(&subject, &d); err != nil {
+		return nil, fmt.Errorf("smtp handler: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", h.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(h.cfg.To, ", "))
+	// No line break may end the header early.
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	fmt.Fprintf(qp, "%d entries of %s on %s, from %s to %s:\n\n", d.Count, d.Logger, d.Host,
+		d.First.Format(time.RFC3339), d.Last.Format(time.RFC3339))
+	for _, it := range items {
+		_, _ = qp.Write(it.data)
+		_, _ = qp.Write([]byte("\n"))
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *SMTPHandler) tlsConfig() *tls.Config {
+	if h.cfg.TLSConfig == nil {
+		return &tls.Config{ServerName: h.host}
+	}
+	c := h.cfg.TLSConfig.Clone()
+	if c.ServerName == "" {
+		c.ServerName = h.host
+	}
+	return c
+}
+
+// deliver sends one email, within Timeout and until ctx is done.
+func (h *SMTPHandler) deliver(ctx context.Context, msg []byte) error {
+	deadline := time.Now().Add(h.cfg.Timeout)
+	var tlsConfig *tls.Config
+	if h.cfg.ImplicitTLS {
+		tlsConfig = h.tlsConfig()
+	}
+	conn, err := dialContext(ctx, &net.Dialer{Deadline: deadline}, "tcp", h.cfg.Address, tlsConfig)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(deadline)
+	defer interruptOnDone(ctx, conn)()
+	c, err := smtp.NewClient(conn, h.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if h.hostname != "" {
+		if err = c.Hello(h.hostname); err != nil {
+			return err
+		}
+	}
+	if !h.cfg.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(h.tlsConfig()); err != nil {
+				return err
+			}
+		} else if h.cfg.RequireTLS {
+			return errSMTPNoStartTLS
+		}
+	}
+	if h.cfg.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", h.cfg.Username, h.cfg.Password, h.host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(h.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range h.cfg.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Flush mails the entries emitted before the call without waiting for the
+// digest to fill up, and returns the last delivery error.
+func (h *SMTPHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *SMTPHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close mails what is still queued, retries included.
+func (h *SMTPHandler) Close() error {
+	h.sender.close()
+	return nil
+}
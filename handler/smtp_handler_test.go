@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type fakeMail struct {
+	from    string
+	to      []string
+	secure  bool
+	auth    string
+	subject string
+	body    string
+}
+
+// fakeSMTP is a mail relay offering STARTTLS when tls is set.
+type fakeSMTP struct {
+	ln  net.Listener
+	tls *tls.Config
+
+	mu       sync.Mutex
+	mails    []fakeMail
+	failMail int // MAIL commands answered with 451
+}
+
+func newFakeSMTP(t *testing.T, tlsConfig *tls.Config) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, tls: tlsConfig}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(t *testing.T, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+	var m fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.tls != nil && !m.secure {
+				_ = tp.PrintfLine("250-fake")
+				_ = tp.PrintfLine("250-STARTTLS")
+			} else {
+				_ = tp.PrintfLine("250-fake")
+			}
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 go ahead")
+			conn = tls.Server(conn, s.tls)
+			tp = textproto.NewConn(conn)
+			m.secure = true
+		case "AUTH":
+			m.auth = arg
+			_ = tp.PrintfLine("235 accepted")
+		case "MAIL":
+			s.mu.Lock()
+			fail := s.failMail > 0
+			s.failMail--
+			s.mu.Unlock()
+			if fail {
+				_ = tp.PrintfLine("451 try again later")
+				continue
+			}
+			m.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.to = append(m.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go on")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			m.subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+			m.body = string(body)
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() []fakeMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMail(nil), s.mails...)
+}
+
+func smtpConfig(s *fakeSMTP) *SMTPHandlerConfig {
+	return (&SMTPHandlerConfig{Address: s.ln.Addr().String(), LoggerName: "api"}).
+		WithFrom("glog@example.com").
+		WithTo("ops@example.com", "dev@example.com").
+		WithRetry(fastRetry())
+}
+
+func TestSMTPHandlerDigests(t *testing.T) {
+	s := newFakeSMTP(t, nil)
+	fm := formatter.NewTextFormatter(formatter.TextFormatterConfig{PatternStyle: "%[LevelName]s %[Message]v"})
+	h, err := NewSMTPHandler(smtpConfig(s).WithBatch(NewBatchConfig(3, 0, time.Hour)), fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	emitAll(t, h,
+		&message.Entry{Message: "slow query", Level: level.WarnLevel, Time: time.Now()},
+		&message.Entry{Message: "payment failed", Level: level.ErrorLevel, Time: time.Now()},
+		&message.Entry{Message: ".dot first", Level: level.WarnLevel, Time: time.Now()},
+		&message.Entry{Message: "retrying", Level: level.WarnLevel, Time: time.Now()},
+	)
+	// The first digest is full, the second goes on Flush.
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	mails := s.received()
+	if len(mails) != 2 {
+		t.Fatalf("mails = %+v", mails)
+	}
+	m := mails[0]
+	if m.from != "glog@example.com" || strings.Join(m.to, ",") != "ops@example.com,dev@example.com" {
+		t.Errorf("envelope = %+v", m)
+	}
+	if m.subject != "[ERROR] api: 3 log entries" {
+		t.Errorf("subject = %q", m.subject)
+	}
+	if !strings.HasPrefix(m.body, "3 entries of api on ") ||
+		!strings.HasSuffix(m.body, ":\n\nWARN slow query\nERROR payment failed\nWARN .dot first\n") {
+		t.Errorf("body = %q", m.body)
+	}
+	if mails[1].subject != "[WARN] api: 1 log entries" {
+		t.Errorf("subject = %q", mails[1].subject)
+	}
+}
+
+func TestSMTPHandlerFlushInterval(t *testing.T) {
+	s := newFakeSMTP(t, nil)
+	h, err := NewSMTPHandler(smtpConfig(s).
+		WithSubject("{{.Count}} from {{.Logger}}\r\nBcc: evil@example.com").
+		WithBatch(NewBatchConfig(100, 0, 20*time.Millisecond)), formatter.NewJSONFormatter(formatter.JSONFormatterConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	emitAll(t, h, &message.Entry{Message: "disk full", Level: level.ErrorLevel, Time: time.Now()})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	mails := s.received()
+	if len(mails) != 1 || mails[0].subject != "1 from api Bcc: evil@example.com" {
+		t.Fatalf("mails = %+v", mails)
+	}
+}
+
+func TestSMTPHandlerStartTLSAuth(t *testing.T) {
+	// Borrow the certificate of an httptest TLS server.
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	s := newFakeSMTP(t, srv.TLS)
+	s.failMail = 1
+	h, err := NewSMTPHandler(smtpConfig(s).
+		WithAuth("alerts", "secret").
+		WithRequireTLS().
+		WithTLSConfig(&tls.Config{RootCAs: roots}), formatter.NewJSONFormatter(formatter.JSONFormatterConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h, &message.Entry{Message: "breach", Level: level.FatalLevel, Time: time.Now()})
+	// The 451 reply is retried.
+	_ = h.Close()
+
+	mails := s.received()
+	if len(mails) != 1 || !mails[0].secure {
+		t.Fatalf("mails = %+v", mails)
+	}
+	auth, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(mails[0].auth, "PLAIN "))
+	if string(auth) != "\x00alerts\x00secret" {
+		t.Errorf("auth = %q", auth)
+	}
+}
+
+func TestSMTPHandlerRequireTLS(t *testing.T) {
+	s := newFakeSMTP(t, nil)
+	var mu sync.Mutex
+	var reported []error
+	cfg := smtpConfig(s).WithRequireTLS().WithErrCallback(func(_ interface{}, err error) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	})
+	h, err := NewSMTPHandler(cfg, formatter.NewJSONFormatter(formatter.JSONFormatterConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h, &message.Entry{Message: "plain text", Level: level.ErrorLevel, Time: time.Now()})
+	if err = h.Flush(context.Background()); err != errSMTPNoStartTLS {
+		t.Errorf("Flush: %v", err)
+	}
+	_ = h.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	// Not retried.
+	if len(reported) != 1 || len(s.received()) != 0 {
+		t.Fatalf("reported = %v", reported)
+	}
+}
+
+// Close interrupts a delivery to a relay that does not answer.
+func TestSMTPHandlerCloseInterruptsDelivery(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() // silent until the end of the test
+		}
+	}()
+	var reported int32
+	cfg := (&SMTPHandlerConfig{Address: ln.Addr().String()}).
+		WithFrom("glog@example.com").
+		WithTo("ops@example.com").
+		WithTimeout(time.Minute).
+		WithBatch(NewBatchConfig(1, 0, time.Hour).WithCloseTimeout(50 * time.Millisecond)).
+		WithErrCallback(func(interface{}, error) { atomic.AddInt32(&reported, 1) })
+	h, err := NewSMTPHandler(cfg, formatter.NewJSONFormatter(formatter.JSONFormatterConfig{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h, &message.Entry{Message: "stuck", Level: level.ErrorLevel, Time: time.Now()})
+	start := time.Now()
+	_ = h.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Close took %v", d)
+	}
+	if atomic.LoadInt32(&reported) != 1 {
+		t.Fatalf("reported = %d", reported)
+	}
+}
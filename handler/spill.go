@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrSpillFull = errors.New("backpressure spill queue is full")
+
+// ErrSpillDirInUse is returned by OpenSpillQueue when another queue, of this
+// process or of another one, has the directory.
+var ErrSpillDirInUse = errors.New("spill directory is in use")
+
+const (
+	spillSegmentExt  = ".spill"
+	spillHeaderSize  = 8 // record length and crc32 of the payload, big endian
+	spillMaxRecordSz = 64 << 20
+)
+
+type spillSegment struct {
+	seq     uint64
+	size    int64
+	records int
+}
+
+// SpillQueue is a bounded FIFO of records kept in segment files in one
+// directory, used by BackpressureStrategySpill. Segments that are left over
+// after a crash are recovered by OpenSpillQueue; records of the segment that
+// was being replayed may then be delivered again. The directory is locked
+// until Close, a second queue on it fails with ErrSpillDirInUse.
+type SpillQueue struct {
+	mu          sync.Mutex
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+	segments    []spillSegment // oldest first, the last one is written
+	writer      *os.File
+	reader      *os.File
+	readOff     int64
+	readCount   int
+	peekLen     int64
+	size        int64
+	count       int
+	ready       chan struct{}
+	unlock      func() error
+}
+
+func OpenSpillQueue(dir string, maxBytes, segmentSize int64) (*SpillQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &SpillQueue{
+		dir:         dir,
+		maxBytes:    maxBytes,
+		segmentSize: segmentSize,
+		ready:       make(chan struct{}, 1),
+		unlock:      unlock,
+	}
+	if err = q.recover(); err != nil {
+		_ = unlock()
+		return nil, err
+	}
+	return q, nil
+}
+
+// recover loads the segments left by a previous run. A torn record at the end
+// of a segment is cut off.
+func (q *SpillQueue) recover() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || !strings.HasSuffix(name, spillSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		size, records, err := scanSpillSegment(q.segmentPath(seq))
+		if err != nil {
+			return err
+		}
+		if records == 0 {
+			_ = os.Remove(q.segmentPath(seq))
+			continue
+		}
+		q.segments = append(q.segments, spillSegment{seq: seq, size: size, records: records})
+		q.size += size
+		q.count += records
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+	return nil
+}
+
+func scanSpillSegment(path string) (int64, int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var off int64
+	var records int
+	for {
+		payload, err := readSpillRecord(f, off)
+		if err != nil {
+			break
+		}
+		off += spillHeaderSize + int64(len(payload))
+		records++
+	}
+	if st, err := f.Stat(); err == nil && st.Size() > off {
+		if err = f.Truncate(off); err != nil {
+			return 0, 0, err
+		}
+	}
+	return off, records, nil
+}
+
+func readSpillRecord(f *os.File, off int64) ([]byte, error) {
+	var header [spillHeaderSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n > spillMaxRecordSz {
+		return nil, errors.New("spill record too large")
+	}
+	payload := make([]byte, n)
+	if _, err := f.ReadAt(payload, off+spillHeaderSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("spill record checksum mismatch")
+	}
+	return payload, nil
+}
+
+func (q *SpillQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spillSegmentExt))
+}
+
+// Len is the number of records not yet committed, including a peeked one.
+func (q *SpillQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Ready is signalled after Push.
+func (q *SpillQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+func (q *SpillQueue) Push(rec []byte) error {
+	n := int64(spillHeaderSize + len(rec))
+	q.mu.Lock()
+	if q.maxBytes > 0 && q.size+n > q.maxBytes {
+		q.mu.Unlock()
+		return ErrSpillFull
+	}
+	if err := q.prepareWriter(n); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	buf := make([]byte, n)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(rec)))
+	binary.BigEndian.PutUint32(buf[4:spillHeaderSize], crc32.ChecksumIEEE(rec))
+	copy(buf[spillHeaderSize:], rec)
+	if _, err := q.writer.Write(buf); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	last := &q.segments[len(q.segments)-1]
+	last.size += n
+	last.records++
+	q.size += n
+	q.count++
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// prepareWriter starts a new segment when there is none open for writing or
+// the record does not fit into the current one.
+func (q *SpillQueue) prepareWriter(n int64) error {
+	if q.writer != nil && (q.segmentSize <= 0 || q.segments[len(q.segments)-1].size+n <= q.segmentSize) {
+		return nil
+	}
+	var seq uint64 = 1
+	if len(q.segments) > 0 {
+		seq = q.segments[len(q.segments)-1].seq + 1
+	}
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if q.writer != nil {
+		_ = q.writer.Close()
+	}
+	q.writer = f
+	q.segments = append(q.segments, spillSegment{seq: seq})
+	return nil
+}
+
+// Peek returns the oldest record without removing it; ok is false when the
+// queue is empty. Call Commit once the record has been delivered.
+func (q *SpillQueue) Peek() (rec []byte, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count > 0 {
+		head := q.segments[0]
+		if q.readCount >= head.records {
+			q.dropHead()
+			continue
+		}
+		if q.reader == nil {
+			// The file may be gone, e.g. removed by a tmp cleaner.
+			if q.reader, err = os.Open(q.segmentPath(head.seq)); err != nil {
+				return nil, false, q.giveUpHead(err)
+			}
+		}
+		if rec, err = readSpillRecord(q.reader, q.readOff); err != nil {
+			return nil, false, q.giveUpHead(err)
+		}
+		q.peekLen = int64(spillHeaderSize + len(rec))
+		return rec, true, nil
+	}
+	return nil, false, nil
+}
+
+// giveUpHead drops the rest of the oldest segment, which cannot be read, so
+// that the next Peek goes on with the following one.
+func (q *SpillQueue) giveUpHead(err error) error {
+	head := q.segments[0]
+	q.count -= head.records - q.readCount
+	q.readCount = head.records
+	q.dropHead()
+	return fmt.Errorf("spill segment %d: %w", head.seq, err)
+}
+
+// Commit removes the record returned by the last Peek.
+func (q *SpillQueue) Commit() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.peekLen == 0 {
+		return
+	}
+	q.readOff += q.peekLen
+	q.readCount++
+	q.peekLen = 0
+	q.count--
+	if q.readCount >= q.segments[0].records {
+		q.dropHead()
+	}
+}
+
+// dropHead removes the fully read oldest segment. The segment being written
+// is kept unless the whole queue is empty.
+func (q *SpillQueue) dropHead() {
+	head := q.segments[0]
+	if len(q.segments) == 1 {
+		if q.count > 0 {
+			return
+		}
+		if q.writer != nil {
+			_ = q.writer.Close()
+			q.writer = nil
+		}
+	}
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+	_ = os.Remove(q.segmentPath(head.seq))
+	q.size -= head.size
+	q.segments = q.segments[1:]
+	q.readOff = 0
+	q.readCount = 0
+}
+
+// Replay hands the records to deliver in order until stop is closed. deliver
+// blocks until the record is taken and returns false when it gave up because
+// of stop; the record then stays queued.
+func (q *SpillQueue) Replay(stop <-chan struct{}, deliver func(rec []byte) bool, onError func(err error)) {
+	for {
+		rec, ok, err := q.Peek()
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if !ok {
+			select {
+			case <-q.ready:
+				continue
+			case <-stop:
+				return
+			}
+		}
+		if !deliver(rec) {
+			return
+		}
+		q.Commit()
+	}
+}
+
+// Drain hands all queued records to fn; only call it when no Replay is running.
+func (q *SpillQueue) Drain(fn func(rec []byte), onError func(err error)) {
+	for {
+		rec, ok, err := q.Peek()
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if !ok {
+			return
+		}
+		fn(rec)
+		q.Commit()
+	}
+}
+
+// Close closes the segment files; queued records stay on disk for the next OpenSpillQueue.
+func (q *SpillQueue) Close() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var err error
+	if q.writer != nil {
+		err = q.writer.Close()
+		q.writer = nil
+	}
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+	if q.unlock != nil {
+		_ = q.unlock()
+		q.unlock = nil
+	}
+	return err
+}
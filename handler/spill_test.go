@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func TestSpillQueueOrderAndSegments(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenSpillQueue(dir, 0, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = q.Close() }()
+
+	for i := 0; i < 20; i++ {
+		if err = q.Push([]byte(fmt.Sprintf("rec-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.spill"))
+	if len(segments) < 2 {
+		t.Fatalf("segments = %v, want several", segments)
+	}
+	for i := 0; i < 20; i++ {
+		rec, ok, err := q.Peek()
+		if err != nil || !ok {
+			t.Fatalf("peek %d: ok=%v err=%v", i, ok, err)
+		}
+		if want := fmt.Sprintf("rec-%02d", i); string(rec) != want {
+			t.Fatalf("record %d = %q, want %q", i, rec, want)
+		}
+		q.Commit()
+	}
+	if n := q.Len(); n != 0 {
+		t.Fatalf("len = %d after replay", n)
+	}
+	if segments, _ = filepath.Glob(filepath.Join(dir, "*.spill")); len(segments) != 0 {
+		t.Fatalf("segments left: %v", segments)
+	}
+}
+
+func TestSpillQueueMissingSegment(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenSpillQueue(dir, 0, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = q.Close() }()
+	for i := 0; i < 8; i++ {
+		if err = q.Push([]byte(fmt.Sprintf("rec-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Removed behind the queue's back, e.g. by a tmp cleaner.
+	if err = os.Remove(q.segmentPath(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var got []string
+	var errs []error
+	go func() {
+		defer close(done)
+		q.Replay(stop, func(rec []byte) bool {
+			got = append(got, string(rec))
+			return true
+		}, func(err error) { errs = append(errs, err) })
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	<-done
+	if len(errs) != 1 || !os.IsNotExist(errors.Unwrap(errs[0])) {
+		t.Fatalf("errors = %v", errs)
+	}
+	if len(got) != 4 || got[0] != "rec-04" || q.Len() != 0 {
+		t.Fatalf("replayed %q, len %d", got, q.Len())
+	}
+
+	// Drain gives up the same way and returns.
+	for i := 0; i < 8; i++ {
+		_ = q.Push([]byte(fmt.Sprintf("rec-%02d", i)))
+	}
+	_ = os.Remove(q.segmentPath(q.segments[0].seq))
+	errs = nil
+	q.Drain(func(rec []byte) {}, func(err error) { errs = append(errs, err) })
+	if len(errs) != 1 || q.Len() != 0 {
+		t.Fatalf("drain: errors %v, len %d", errs, q.Len())
+	}
+}
+
+func TestSpillQueueFull(t *testing.T) {
+	q, err := OpenSpillQueue(t.TempDir(), 2*(spillHeaderSize+4), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = q.Close() }()
+	for i := 0; i < 2; i++ {
+		if err = q.Push([]byte("abcd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.Push([]byte("abcd")); err != ErrSpillFull {
+		t.Fatalf("err = %v, want ErrSpillFull", err)
+	}
+}
+
+// A crashed process leaves segments behind, possibly with a torn last record.
+// The next FileHandler replays them before its own messages.
+func TestFileHandlerRecoversSpilledSegments(t *testing.T) {
+	dir := t.TempDir()
+	spillDir := filepath.Join(dir, "spill")
+	q, err := OpenSpillQueue(spillDir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"old-1\n", "old-2\n"} {
+		if err = q.Push([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = q.Close()
+	segments, _ := filepath.Glob(filepath.Join(spillDir, "*.spill"))
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 9, 1, 2})
+	_ = f.Close()
+
+	cfg := (&FileHandlerConfig{
+		FileDir:       dir,
+		FileName:      "s",
+		FileSuffix:    "log",
+		BufferSize:    1,
+		BulkWriteSize: 256,
+		RotatorType:   FileRotatorTypeSize,
+	}).WithBackpressure(NewBackpressureConfig(BackpressureStrategySpill).WithSpillDir(spillDir))
+	h, err := NewFileHandler(cfg, messageFormatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err = h.Emit(&message.Entry{Message: fmt.Sprintf("new-%02d", i), Level: level.InfoLevel, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats := h.BackpressureStats()
+	if err = h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "s.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := []string{"old-1", "old-2"}
+	for i := 0; i < 50; i++ {
+		want = append(want, fmt.Sprintf("new-%02d", i))
+	}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v", lines)
+	}
+	if stats.Spilled == 0 || stats.Replayed != stats.Spilled+2 || stats.Discarded != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if segments, _ = filepath.Glob(filepath.Join(spillDir, "*.spill")); len(segments) != 0 {
+		t.Fatalf("segments left: %v", segments)
+	}
+}
+
+func TestSpillQueueDirInUse(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenSpillQueue(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenSpillQueue(dir, 0, 0); !errors.Is(err, ErrSpillDirInUse) {
+		t.Fatalf("second queue: err = %v", err)
+	}
+	_ = q.Close()
+	if q, err = OpenSpillQueue(dir, 0, 0); err != nil {
+		t.Fatalf("after Close: %v", err)
+	}
+	_ = q.Close()
+}
+
+// The file handlers of one directory get a spill queue each by default.
+func TestFileHandlerDefaultSpillDirPerFile(t *testing.T) {
+	dir := t.TempDir()
+	var handlers []*FileHandler
+	for _, name := range []string{"app", "error"} {
+		cfg := (&FileHandlerConfig{
+			FileDir:       dir,
+			FileName:      name,
+			FileSuffix:    "log",
+			BufferSize:    1,
+			BulkWriteSize: 256,
+			RotatorType:   FileRotatorTypeSize,
+		}).WithBackpressure(NewBackpressureConfig(BackpressureStrategySpill))
+		h, err := NewFileHandler(cfg, messageFormatter(), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		handlers = append(handlers, h)
+	}
+	for i, h := range handlers {
+		if err := h.Emit(&message.Entry{Message: fmt.Sprintf("to-%d", i), Level: level.InfoLevel, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, name := range []string{"app", "error"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+".log"))
+		if err != nil || string(data) != fmt.Sprintf("to-%d\n", i) {
+			t.Errorf("%s.log = %q, %v", name, data, err)
+		}
+		if _, err = os.Stat(filepath.Join(dir, ".spill", name+".log")); err != nil {
+			t.Errorf("spill dir: %v", err)
+		}
+	}
+}
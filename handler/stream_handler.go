@@ -75,6 +75,14 @@ func (h *StreamHandler) Emit(record *message.Entry) error {
 	return h.emit(msgByte)
 }
 
+// Sync commits the stream to stable storage when it supports it, e.g. an *os.File.
+func (h *StreamHandler) Sync() error {
+	if s, ok := h.stream.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
 func (h *StreamHandler) Close() error {
 	return h.stream.Close()
 }
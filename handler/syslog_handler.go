@@ -1,92 +1,85 @@
-//go:build !windows
-
 package handler
 
 import (
-	"log/syslog"
+	"errors"
+	"fmt"
+	"strconv"
 
 	"github.com/ml444/glog/filter"
 	"github.com/ml444/glog/formatter"
-	"github.com/ml444/glog/level"
 	"github.com/ml444/glog/message"
 )
 
-type SyslogHandler struct {
-	// BaseHandler
-	Writer   *syslog.Writer
-	network  string
-	raddr    string
-	priority int
-	tag      string
+type SyslogFraming int8
+
+const (
+	// SyslogFramingAuto uses octet counting on stream networks (tcp, unix) and
+	// one message per datagram otherwise.
+	SyslogFramingAuto SyslogFraming = iota
+	// SyslogFramingOctetCounting prefixes each message with its length (RFC 6587).
+	SyslogFramingOctetCounting
+	// SyslogFramingNonTransparent ends each message with a LF on stream
+	// networks, for the receivers without octet counting support.
+	SyslogFramingNonTransparent
+)
 
-	formatter formatter.IFormatter
+// SyslogHandler sends RFC 5424 messages to a syslog server over UDP, TCP, TLS
+// or a unix socket. A formatter other than RFC5424Formatter renders the MSG
+// part of a message whose header the handler builds from its config. The
+// connection is dialed on the first message and again after a write error, so
+// the handler survives a server that is down at startup or restarted.
+type SyslogHandler struct {
+	conn      *netConn
+	framing   SyslogFraming
+	formatter *formatter.RFC5424Formatter
 	filter    filter.IFilter
 }
 
 func NewSyslogHandler(cfg *SyslogHandlerConfig, fm formatter.IFormatter, ft filter.IFilter) (*SyslogHandler, error) {
-	h := &SyslogHandler{
-		network:   cfg.Network,
-		raddr:     cfg.Address,
-		priority:  cfg.Priority,
-		tag:       cfg.Tag,
-		formatter: fm,
-		filter:    ft,
+	if cfg == nil || cfg.Address == "" {
+		return nil, errors.New("syslog handler: Address is required")
 	}
-	err := h.Init()
-	if err != nil {
-		return nil, err
+	network := cfg.Network
+	if network == "" {
+		network = "udp"
 	}
-	return h, nil
-}
-
-func (h *SyslogHandler) format(record *message.Entry) ([]byte, error) {
-	if h.formatter != nil {
-		return h.formatter.Format(record)
+	h := &SyslogHandler{
+		conn:    newNetConn(network, cfg.Address, cfg.TLSConfig, cfg.Timeout),
+		framing: cfg.Framing,
+		filter:  ft,
 	}
-	return nil, nil
-}
-
-func (h *SyslogHandler) Init() error {
-	sysLogWriter, err := syslog.Dial(h.network, h.raddr, syslog.Priority(h.priority), h.tag)
-	if err != nil {
-		return err
+	if rf, ok := fm.(*formatter.RFC5424Formatter); ok {
+		h.formatter = rf
+	} else {
+		h.formatter = formatter.NewRFC5424Formatter(cfg.formatterConfig(fm))
 	}
-	h.Writer = sysLogWriter
-	return nil
+	return h, nil
 }
 
 func (h *SyslogHandler) Emit(e *message.Entry) error {
 	if err := applyFilter(h.filter, e); err != nil {
 		return err
 	}
-	msgByte, err := h.format(e)
+	msg, err := h.formatter.Format(e)
 	if err != nil {
 		return err
 	}
-
-	msg := string(msgByte)
-
-	switch e.Level {
-	case level.PanicLevel:
-		return h.Writer.Crit(msg)
-	case level.FatalLevel:
-		return h.Writer.Crit(msg)
-	case level.ErrorLevel:
-		return h.Writer.Err(msg)
-	case level.WarnLevel:
-		return h.Writer.Warning(msg)
-	case level.InfoLevel:
-		return h.Writer.Info(msg)
-	case level.DebugLevel:
-		return h.Writer.Debug(msg)
-	default:
-		return nil
+	if h.conn.isStream() {
+		if h.framing == SyslogFramingNonTransparent {
+			msg = append(msg, '\n')
+		} else {
+			frame := make([]byte, 0, len(msg)+8)
+			frame = strconv.AppendInt(frame, int64(len(msg)), 10)
+			frame = append(frame, ' ')
+			msg = append(frame, msg...)
+		}
+	}
+	if err = h.conn.Write(msg); err != nil {
+		return fmt.Errorf("syslog handler: %w", err)
 	}
+	return nil
 }
 
 func (h *SyslogHandler) Close() error {
-	if h.Writer == nil {
-		return nil
-	}
-	return h.Writer.Close()
+	return h.conn.Close()
 }
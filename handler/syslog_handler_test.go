@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/formatter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+func syslogConfig(network, address string) *SyslogHandlerConfig {
+	return (&SyslogHandlerConfig{}).
+		WithNetwork(network).
+		WithAddress(address).
+		WithTag("api").
+		WithHostname("web-1")
+}
+
+// readOctetCounted reads one "LEN SP MSG" frame.
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	size, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		t.Fatalf("bad frame length %q", size)
+	}
+	msg := make([]byte, n)
+	if _, err = io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func TestSyslogHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	cfg := syslogConfig("udp", pc.LocalAddr().String()).
+		WithFacility(16).
+		WithSeverity(level.DebugLevel, 6)
+	h, err := NewSyslogHandler(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	err = h.Emit(&message.Entry{
+		Message: "request failed",
+		TraceID: "t-1",
+		Time:    time.Unix(1700000000, 250e6).UTC(),
+		Level:   level.ErrorLevel,
+		Fields:  message.FieldsFromKV("user", `a"b]`, "code=x", 3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<131>1 2023-11-14T22:13:20.250000Z web-1 api ` + strconv.Itoa(os.Getpid()) +
+		` - [glog@32473 trace_id="t-1" user="a\"b\]" code_x="3"] request failed`
+	if got := string(readDatagram(t, pc)); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// PrintLevel is informational, DebugLevel is remapped by the config.
+	for _, tc := range []struct {
+		lvl  level.LogLevel
+		want string
+	}{
+		{level.PrintLevel, "<134>1 "},
+		{level.DebugLevel, "<134>1 "},
+		{level.FatalLevel, "<130>1 "},
+	} {
+		if err = h.Emit(&message.Entry{Message: "m", Level: tc.lvl}); err != nil {
+			t.Fatal(err)
+		}
+		got := string(readDatagram(t, pc))
+		if !strings.HasPrefix(got, tc.want) || !strings.HasSuffix(got, " - - m") {
+			t.Fatalf("%s: got %q", tc.lvl, got)
+		}
+	}
+}
+
+func TestSyslogHandlerMessageFormatter(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	fm := formatter.NewJSONFormatter(formatter.JSONFormatterConfig{})
+	h, err := NewSyslogHandler(syslogConfig("udp", pc.LocalAddr().String()).WithPriority(4<<3), fm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	if err = h.Emit(&message.Entry{Message: "hi", Level: level.WarnLevel}); err != nil {
+		t.Fatal(err)
+	}
+	got := string(readDatagram(t, pc))
+	if !strings.HasPrefix(got, "<36>1 ") || !strings.Contains(got, ` - - {`) || strings.HasSuffix(got, "\n") {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSyslogHandlerTCPOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	h, err := NewSyslogHandler(syslogConfig("tcp", ln.Addr().String()), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	for _, msg := range []string{"first", "second\nline"} {
+		if err = h.Emit(&message.Entry{Message: msg, Level: level.InfoLevel}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{" - - first", " - - second\nline"} {
+		if got := readOctetCounted(t, r); !strings.HasPrefix(got, "<14>1 - web-1 api ") || !strings.HasSuffix(got, want) {
+			t.Fatalf("got %q", got)
+		}
+	}
+}
+
+func TestSyslogHandlerConnectsLazily(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	// The server is down at startup: creating the handler does not fail.
+	h, err := NewSyslogHandler(syslogConfig("tcp", addr).WithTimeout(time.Second), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+	if err = h.Emit(&message.Entry{Message: "lost", Level: level.InfoLevel}); err == nil {
+		t.Fatal("expected an error without server")
+	}
+	// Until the next dial is due the entries fail without dialing.
+	if err = h.Emit(&message.Entry{Message: "lost", Level: level.InfoLevel}); !errors.Is(err, errDialBackoff) {
+		t.Fatalf("err = %v, want errDialBackoff", err)
+	}
+
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skip(err)
+	}
+	h.conn.mu.Lock()
+	h.conn.nextDial = time.Now()
+	h.conn.mu.Unlock()
+	defer ln.Close()
+	if err = h.Emit(&message.Entry{Message: "delivered", Level: level.InfoLevel}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got := readOctetCounted(t, bufio.NewReader(conn)); !strings.HasSuffix(got, " delivered") {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSyslogHandlerTLSNonTransparent(t *testing.T) {
+	// Borrow the certificate of an httptest TLS server.
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	cfg := syslogConfig("tcp", ln.Addr().String()).
+		WithTLSConfig(&tls.Config{RootCAs: roots}).
+		WithFraming(SyslogFramingNonTransparent)
+	h, err := NewSyslogHandler(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = h.Close() }()
+
+	done := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		done <- line
+	}()
+	if err = h.Emit(&message.Entry{Message: "secure", Level: level.WarnLevel}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-done; !strings.HasPrefix(got, "<12>1 - web-1 api ") || !strings.HasSuffix(got, " - - secure\n") {
+		t.Fatalf("got %q", got)
+	}
+}
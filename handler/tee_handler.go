@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/message"
+)
+
+// TeeBranch is one output of a TeeHandler. The handler has its own formatter
+// and filter; Filter is the routing rule of the branch, e.g.
+// filter.LevelAtLeast(level.ErrorLevel) or filter.FieldEquals("component", "db").
+type TeeBranch struct {
+	Name    string
+	Handler IHandler
+	// Filter selects the entries of the branch, all of them when nil.
+	Filter filter.IFilter
+}
+
+// TeeBranchError is the failure of one branch.
+type TeeBranchError struct {
+	Branch string
+	Err    error
+}
+
+func (e *TeeBranchError) Error() string {
+	return "branch " + e.Branch + ": " + e.Err.Error()
+}
+
+func (e *TeeBranchError) Unwrap() error {
+	return e.Err
+}
+
+// TeeError holds the failures of the branches for one call; the other
+// branches went on.
+type TeeError struct {
+	Errors []*TeeBranchError
+}
+
+func (e *TeeError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "tee handler: " + strings.Join(msgs, "; ")
+}
+
+type TeeBranchStats struct {
+	Name         string
+	Emitted      uint64
+	Skipped      uint64 // not routed to the branch, or filtered out by its handler
+	Failed       uint64
+	Backpressure BackpressureStats
+	Sync         SyncStats
+}
+
+type TeeStatsProvider interface {
+	TeeStats() []TeeBranchStats
+}
+
+type teeBranch struct {
+	// First for their 64-bit alignment on 32-bit platforms.
+	emitted uint64
+	skipped uint64
+	failed  uint64
+	TeeBranch
+}
+
+// TeeHandler fans each entry out to the branches that accept it, in order. A
+// failing or panicking branch does not keep the entry from the others: Emit
+// returns a TeeError naming the branches that failed.
+type TeeHandler struct {
+	branches []*teeBranch
+}
+
+func NewTeeHandler(branches ...TeeBranch) (*TeeHandler, error) {
+	if len(branches) == 0 {
+		return nil, errors.New("tee handler: no branch")
+	}
+	h := &TeeHandler{branches: make([]*teeBranch, 0, len(branches))}
+	for i, b := range branches {
+		if b.Handler == nil {
+			return nil, fmt.Errorf("tee handler: branch %d has no handler", i)
+		}
+		if b.Name == "" {
+			b.Name = strconv.Itoa(i)
+		}
+		h.branches = append(h.branches, &teeBranch{TeeBranch: b})
+	}
+	return h, nil
+}
+
+func (h *TeeHandler) Emit(e *message.Entry) error {
+	var errs []*TeeBranchError
+	for _, b := range h.branches {
+		if b.Filter != nil && !b.Filter.Filter(e) {
+			atomic.AddUint64(&b.skipped, 1)
+			continue
+		}
+		err := b.emit(e)
+		switch {
+		case err == nil:
+			atomic.AddUint64(&b.emitted, 1)
+		case errors.Is(err, filter.ErrFilterOut):
+			atomic.AddUint64(&b.skipped, 1)
+		default:
+			atomic.AddUint64(&b.failed, 1)
+			errs = append(errs, &TeeBranchError{Branch: b.Name, Err: err})
+		}
+	}
+	return teeError(errs)
+}
+
+func (b *teeBranch) emit(e *message.Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return b.Handler.Emit(e)
+}
+
+func teeError(errs []*TeeBranchError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &TeeError{Errors: errs}
+}
+
+// each calls fn for every branch and collects the errors.
+func (h *TeeHandler) each(fn func(b *teeBranch) error) error {
+	var errs []*TeeBranchError
+	for _, b := range h.branches {
+		if err := fn(b); err != nil {
+			errs = append(errs, &TeeBranchError{Branch: b.Name, Err: err})
+		}
+	}
+	return teeError(errs)
+}
+
+func (h *TeeHandler) Flush(ctx context.Context) error {
+	return h.each(func(b *teeBranch) error {
+		if f, ok := b.Handler.(IFlusher); ok {
+			return f.Flush(ctx)
+		}
+		return nil
+	})
+}
+
+func (h *TeeHandler) Sync() error {
+	return h.each(func(b *teeBranch) error {
+		if s, ok := b.Handler.(ISyncer); ok {
+			return s.Sync()
+		}
+		if f, ok := b.Handler.(IFlusher); ok {
+			return f.Flush(context.Background())
+		}
+		return nil
+	})
+}
+
+func (h *TeeHandler) Reopen() error {
+	return h.each(func(b *teeBranch) error {
+		if r, ok := b.Handler.(IReopener); ok {
+			return r.Reopen()
+		}
+		return nil
+	})
+}
+
+func (h *TeeHandler) TeeStats() []TeeBranchStats {
+	stats := make([]TeeBranchStats, 0, len(h.branches))
+	for _, b := range h.branches {
+		s := TeeBranchStats{
+			Name:    b.Name,
+			Emitted: atomic.LoadUint64(&b.emitted),
+			Skipped: atomic.LoadUint64(&b.skipped),
+			Failed:  atomic.LoadUint64(&b.failed),
+		}
+		if p, ok := b.Handler.(BackpressureStatsProvider); ok {
+			s.Backpressure = p.BackpressureStats()
+		}
+		if p, ok := b.Handler.(SyncStatsProvider); ok {
+			s.Sync = p.SyncStats()
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// BackpressureStats adds up the counters of the branches, see TeeStats for
+// the detail.
+func (h *TeeHandler) BackpressureStats() BackpressureStats {
+	var total BackpressureStats
+	for _, s := range h.TeeStats() {
+		total.Enqueued += s.Backpressure.Enqueued
+		total.Dropped += s.Backpressure.Dropped
+		total.TimedOut += s.Backpressure.TimedOut
+		total.Sampled += s.Backpressure.Sampled
+		total.Spilled += s.Backpressure.Spilled
+		total.Replayed += s.Backpressure.Replayed
+		total.Discarded += s.Backpressure.Discarded
+	}
+	return total
+}
+
+// Close closes all the branches, even if some fail to.
+func (h *TeeHandler) Close() error {
+	return h.each(func(b *teeBranch) error {
+		return b.Handler.Close()
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+type failingHandler struct {
+	err      error
+	panicMsg string
+	closed   bool
+}
+
+func (h *failingHandler) Emit(_ *message.Entry) error {
+	if h.panicMsg != "" {
+		panic(h.panicMsg)
+	}
+	return h.err
+}
+
+func (h *failingHandler) Close() error {
+	h.closed = true
+	return h.err
+}
+
+func TestTeeHandlerRouting(t *testing.T) {
+	all, errs, db := &collectingHandler{}, &collectingHandler{}, &collectingHandler{}
+	h, err := NewTeeHandler(
+		TeeBranch{Name: "all", Handler: all},
+		TeeBranch{Name: "errors", Handler: errs, Filter: filter.LevelAtLeast(level.ErrorLevel)},
+		TeeBranch{Name: "db", Handler: db, Filter: filter.All(
+			filter.FieldEquals("component", "db"),
+			filter.Not(filter.LevelBelow(level.InfoLevel)),
+		)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h,
+		&message.Entry{Message: "started", Level: level.InfoLevel},
+		&message.Entry{Message: "slow query", Level: level.WarnLevel, Fields: message.FieldsFromKV("component", "db")},
+		&message.Entry{Message: "query plan", Level: level.DebugLevel, Fields: message.FieldsFromKV("component", "db")},
+		&message.Entry{Message: "crashed", Level: level.ErrorLevel},
+	)
+	if got := all.take(); !reflect.DeepEqual(got, []string{"started", "slow query", "query plan", "crashed"}) {
+		t.Errorf("all: %q", got)
+	}
+	if got := errs.take(); !reflect.DeepEqual(got, []string{"crashed"}) {
+		t.Errorf("errors: %q", got)
+	}
+	if got := db.take(); !reflect.DeepEqual(got, []string{"slow query"}) {
+		t.Errorf("db: %q", got)
+	}
+	stats := h.TeeStats()
+	if stats[1].Name != "errors" || stats[1].Emitted != 1 || stats[1].Skipped != 3 || stats[2].Emitted != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTeeHandlerIsolatesFailures(t *testing.T) {
+	boom := errors.New("disk full")
+	ok := &collectingHandler{}
+	h, err := NewTeeHandler(
+		TeeBranch{Name: "file", Handler: &failingHandler{err: boom}},
+		TeeBranch{Name: "broken", Handler: &failingHandler{panicMsg: "nil map"}},
+		TeeBranch{Name: "filtered", Handler: &failingHandler{err: filter.ErrFilterOut}},
+		TeeBranch{Handler: ok},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Emit(&message.Entry{Message: "hello", Level: level.InfoLevel})
+	var teeErr *TeeError
+	if !errors.As(err, &teeErr) || len(teeErr.Errors) != 2 {
+		t.Fatalf("err = %v", err)
+	}
+	if teeErr.Errors[0].Branch != "file" || !errors.Is(teeErr.Errors[0], boom) {
+		t.Errorf("first error = %v", teeErr.Errors[0])
+	}
+	if teeErr.Errors[1].Branch != "broken" || !strings.Contains(teeErr.Errors[1].Error(), "nil map") {
+		t.Errorf("second error = %v", teeErr.Errors[1])
+	}
+	if got := ok.take(); !reflect.DeepEqual(got, []string{"hello"}) {
+		t.Errorf("healthy branch: %q", got)
+	}
+
+	stats := h.TeeStats()
+	want := []uint64{1, 1, 0, 0} // failed
+	for i, s := range stats {
+		if s.Failed != want[i] {
+			t.Errorf("branch %s: %+v", s.Name, s)
+		}
+	}
+	if stats[2].Skipped != 1 || stats[3].Name != "3" || stats[3].Emitted != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	if err = h.Flush(context.Background()); err != nil {
+		t.Errorf("Flush: %v", err)
+	}
+	// Close reaches every branch.
+	err = h.Close()
+	if !errors.As(err, &teeErr) || len(teeErr.Errors) != 2 || !ok.closed {
+		t.Errorf("Close: %v", err)
+	}
+}
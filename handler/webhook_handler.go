@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/message"
+)
+
+const (
+	// WebhookTemplateSlack is the body of a Slack (or Mattermost, Rocket.Chat)
+	// incoming webhook.
+	WebhookTemplateSlack = `{"text": {{json .Text}}}`
+	// WebhookTemplateTeams is the body of a Microsoft Teams incoming webhook.
+	WebhookTemplateTeams = `{"@type": "MessageCard", "@context": "https://schema.org/extensions", ` +
+		`"themeColor": "D70000", "summary": {{json .Title}}, "title": {{json .Title}}, "text": {{json .Text}}}`
+)
+
+// WebhookAlert is the data of the body template.
+type WebhookAlert struct {
+	Title   string // e.g. "[ERROR] api@host-1"
+	Text    string // the title and the details, on one line
+	Level   string
+	Message string
+	Logger  string
+	Host    string
+	TraceID string
+	Caller  string // file:line
+	Time    time.Time
+	Fields  map[string]string
+	// Summary is set on the alert sent when a group window ends, More being the
+	// number of occurrences after the first one.
+	Summary bool
+	More    int
+	// Suppressed is the number of alerts left out by MaxPerMinute since the
+	// previous one sent.
+	Suppressed int
+}
+
+type WebhookStats struct {
+	Alerts     uint64 // first occurrences sent
+	Summaries  uint64 // "N more occurrences" sent
+	Grouped    uint64 // occurrences counted instead of sent
+	Suppressed uint64 // alerts and summaries left out by MaxPerMinute
+}
+
+type WebhookStatsProvider interface {
+	WebhookStats() WebhookStats
+}
+
+// WebhookHandler posts an alert per entry to a webhook, the body being
+// rendered by a template. The repeats of an alert within GroupWindow are
+// counted and sent as one summary when the window ends, and at most
+// MaxPerMinute alerts are sent in any minute. It is meant for a worker at
+// ErrorLevel or above.
+type WebhookHandler struct {
+	// First for their 64-bit alignment on 32-bit platforms.
+	alerts     uint64
+	summaries  uint64
+	grouped    uint64
+	suppressed uint64
+
+	cfg      WebhookHandlerConfig
+	client   *http.Client
+	filter   filter.IFilter
+	template *template.Template
+	host     string
+	sender   *batchSender
+
+	mu      sync.Mutex
+	groups  map[string]*webhookGroup
+	sent    []time.Time // of the alerts sent in the last minute
+	pending int         // suppressed since the last alert sent
+
+	doneChan  chan struct{}
+	sweepDone chan struct{}
+	closeOnce sync.Once
+}
+
+type webhookGroup struct {
+	first *message.Entry
+	last  *message.Entry
+	start time.Time
+	more  int
+}
+
+func NewWebhookHandler(cfg *WebhookHandlerConfig, ft filter.IFilter) (*WebhookHandler, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("webhook handler: URL is required")
+	}
+	h := &WebhookHandler{
+		cfg:       *cfg,
+		client:    httpClient(cfg.Client, cfg.Timeout),
+		filter:    ft,
+		groups:    make(map[string]*webhookGroup),
+		doneChan:  make(chan struct{}),
+		sweepDone: make(chan struct{}),
+	}
+	if h.cfg.Template == "" {
+		h.cfg.Template = WebhookTemplateSlack
+	}
+	if h.cfg.GroupWindow <= 0 {
+		h.cfg.GroupWindow = time.Minute
+	}
+	if h.cfg.MaxPerMinute <= 0 {
+		h.cfg.MaxPerMinute = 10
+	}
+	if h.cfg.Clock == nil {
+		h.cfg.Clock = systemClock{}
+	}
+	var err error
+	h.template, err = template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(h.cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("webhook handler: %w", err)
+	}
+	// Catch the templates that do not render JSON now rather than on the first error.
+	if _, err = h.render(&WebhookAlert{Title: "title", Text: "text", Fields: map[string]string{}}); err != nil {
+		return nil, err
+	}
+	h.host, _ = os.Hostname()
+	h.sender = newBatchSender(BatchConfig{MaxCount: 1}, cfg.Retry, cfg.Backpressure, h.send, cfg.ErrCallback)
+	go h.sweepLoop()
+	return h, nil
+}
+
+func webhookJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (h *WebhookHandler) Emit(e *message.Entry) error {
+	if err := applyFilter(h.filter, e); err != nil {
+		return err
+	}
+	now := h.cfg.Clock.Now()
+	key := e.Level.String() + "\x00" + e.Message
+
+	var items []batchItem
+	var err error
+	h.mu.Lock()
+	if g, ok := h.groups[key]; ok {
+		if now.Sub(g.start) < h.cfg.GroupWindow {
+			g.more++
+			g.last = e
+			h.mu.Unlock()
+			atomic.AddUint64(&h.grouped, 1)
+			return nil
+		}
+		delete(h.groups, key)
+		items = h.appendSummary(items, g, now, true)
+	}
+	h.groups[key] = &webhookGroup{first: e, last: e, start: now}
+	if h.allow(now) {
+		var it batchItem
+		if it, err = h.alert(e, nil); err == nil {
+			items = append(items, it)
+			atomic.AddUint64(&h.alerts, 1)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, it := range items {
+		if qerr := h.sender.enqueue(it); qerr != nil {
+			err = qerr
+		}
+	}
+	return err
+}
+
+// allow counts an alert against MaxPerMinute, it reports whether the alert
+// can be sent. The caller holds mu.
+func (h *WebhookHandler) allow(now time.Time) bool {
+	i := 0
+	for i < len(h.sent) && now.Sub(h.sent[i]) >= time.Minute {
+		i++
+	}
+	h.sent = h.sent[i:]
+	if len(h.sent) >= h.cfg.MaxPerMinute {
+		h.pending++
+		atomic.AddUint64(&h.suppressed, 1)
+		return false
+	}
+	h.sent = append(h.sent, now)
+	return true
+}
+
+// appendSummary appends the summary of g when it counted repeats. The caller
+// holds mu.
+func (h *WebhookHandler) appendSummary(items []batchItem, g *webhookGroup, now time.Time, limit bool) []batchItem {
+	if g.more == 0 || limit && !h.allow(now) {
+		return items
+	}
+	it, err := h.alert(g.first, g)
+	if err != nil {
+		h.report(g.last, err)
+		return items
+	}
+	it.entry = g.last
+	atomic.AddUint64(&h.summaries, 1)
+	return append(items, it)
+}
+
+// alert renders the alert of e, or the summary of g. The caller holds mu.
+func (h *WebhookHandler) alert(e *message.Entry, g *webhookGroup) (batchItem, error) {
+	a := &WebhookAlert{
+		Level:      e.Level.String(),
+		Message:    e.Message,
+		Logger:     h.cfg.LoggerName,
+		Host:       h.host,
+		TraceID:    e.TraceID,
+		Time:       e.Time,
+		Fields:     make(map[string]string, len(e.Fields)),
+		Suppressed: h.pending,
+	}
+	h.pending = 0
+	if e.Caller != nil {
+		a.Caller = filepath.Base(e.Caller.File) + ":" + strconv.Itoa(e.Caller.Line)
+	}
+	for _, f := range e.Fields {
+		a.Fields[f.Key] = f.String()
+	}
+
+	a.Title = "[" + a.Level + "] " + a.Logger
+	if a.Host != "" {
+		a.Title += "@" + a.Host
+	}
+	var text strings.Builder
+	text.WriteString(a.Title + ": " + a.Message)
+	if g != nil {
+		a.Summary, a.More = true, g.more
+		fmt.Fprintf(&text, " (%d more occurrences in %s)", g.more, h.cfg.GroupWindow)
+	} else {
+		if a.Caller != "" {
+			text.WriteString(" (" + a.Caller + ")")
+		}
+		for _, f := range e.Fields {
+			text.WriteString(" " + f.Key + "=" + f.String())
+		}
+	}
+	if a.Suppressed > 0 {
+		fmt.Fprintf(&text, " [%d alerts suppressed by rate limit]", a.Suppressed)
+	}
+	a.Text = text.String()
+
+	body, err := h.render(a)
+	return batchItem{entry: e, data: body}, err
+}
+
+func (h *WebhookHandler) render(a *WebhookAlert) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := h.template.Execute(&buf, a); err != nil {
+		return nil, fmt.Errorf("webhook handler: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook handler: template does not render JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *WebhookHandler) report(e *message.Entry, err error) {
+	if h.cfg.ErrCallback != nil {
+		h.cfg.ErrCallback([]*message.Entry{e}, err)
+	}
+}
+
+func (h *WebhookHandler) sweepLoop() {
+	defer close(h.sweepDone)
+	ticker := time.NewTicker(h.cfg.GroupWindow / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.sweep(false)
+		case <-h.doneChan:
+			return
+		}
+	}
+}
+
+// sweep sends the summaries of the groups whose window has ended, of all the
+// groups when final.
+func (h *WebhookHandler) sweep(final bool) {
+	now := h.cfg.Clock.Now()
+	var items []batchItem
+	h.mu.Lock()
+	for key, g := range h.groups {
+		if final || now.Sub(g.start) >= h.cfg.GroupWindow {
+			delete(h.groups, key)
+			// The last summaries are not capped, nothing would report them.
+			items = h.appendSummary(items, g, now, !final)
+		}
+	}
+	h.mu.Unlock()
+	for _, it := range items {
+		if err := h.sender.enqueue(it); err != nil {
+			h.report(it.entry, err)
+		}
+	}
+}
+
+// send posts one alert, the batches holding one item.
+func (h *WebhookHandler) send(ctx context.Context, items []batchItem) ([]batchItem, error) {
+	for i, it := range items {
+		req := httpRequest{
+			url:         h.cfg.URL,
+			contentType: "application/json",
+			headers:     h.cfg.Headers,
+			body:        it.data,
+		}
+		if _, err := req.do(ctx, h.client); err != nil {
+			if retryable(err) {
+				return items[i:], err
+			}
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (h *WebhookHandler) WebhookStats() WebhookStats {
+	return WebhookStats{
+		Alerts:     atomic.LoadUint64(&h.alerts),
+		Summaries:  atomic.LoadUint64(&h.summaries),
+		Grouped:    atomic.LoadUint64(&h.grouped),
+		Suppressed: atomic.LoadUint64(&h.suppressed),
+	}
+}
+
+// Flush waits until the alerts emitted before the call have been sent or
+// given up on, and returns the last delivery error. The open groups are kept.
+func (h *WebhookHandler) Flush(ctx context.Context) error {
+	return h.sender.flush(ctx)
+}
+
+func (h *WebhookHandler) BackpressureStats() BackpressureStats {
+	return h.sender.stats.Snapshot()
+}
+
+// Close sends the summaries of the open groups and what is still queued.
+func (h *WebhookHandler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.doneChan)
+		<-h.sweepDone
+		h.sweep(true)
+		h.sender.close()
+	})
+	return nil
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml444/glog/level"
+	"github.com/ml444/glog/message"
+)
+
+// webhookTexts returns the "text" of the Slack bodies posted.
+func webhookTexts(t *testing.T, h *WebhookHandler, requests func() []recordedRequest) []string {
+	t.Helper()
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	var texts []string
+	for _, r := range requests() {
+		var body struct{ Text string }
+		if err := json.Unmarshal([]byte(r.body), &body); err != nil {
+			t.Fatalf("body %q: %v", r.body, err)
+		}
+		texts = append(texts, body.Text)
+	}
+	return texts
+}
+
+func TestWebhookHandlerGroupsRepeats(t *testing.T) {
+	srv, requests := recordingServer(t)
+	clock := &fakeClock{now: time.Date(2024, 6, 12, 10, 0, 0, 0, time.UTC)}
+	h, err := NewWebhookHandler((&WebhookHandlerConfig{URL: srv.URL, LoggerName: "api"}).
+		WithHeader("Authorization", "Bearer token").
+		WithClock(clock), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	for i := 0; i < 5; i++ {
+		emitAll(t, h, &message.Entry{Message: "db down", Level: level.ErrorLevel, Time: clock.Now(),
+			Fields: message.FieldsFromKV("host", "db-1")})
+	}
+	emitAll(t, h, &message.Entry{Message: "db down", Level: level.FatalLevel, Time: clock.Now()})
+	texts := webhookTexts(t, h, requests)
+	if len(texts) != 2 || !strings.HasPrefix(texts[0], "[ERROR] api") || !strings.HasSuffix(texts[0], ": db down host=db-1") {
+		t.Fatalf("texts = %q", texts)
+	}
+	if got := requests()[0].header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// The window has not ended yet.
+	clock.Set(clock.Now().Add(30 * time.Second))
+	h.sweep(false)
+	if texts = webhookTexts(t, h, requests); len(texts) != 2 {
+		t.Fatalf("texts = %q", texts)
+	}
+	clock.Set(clock.Now().Add(31 * time.Second))
+	h.sweep(false)
+	texts = webhookTexts(t, h, requests)
+	if len(texts) != 3 || !strings.HasSuffix(texts[2], ": db down (4 more occurrences in 1m0s)") {
+		t.Fatalf("texts = %q", texts)
+	}
+	if stats := h.WebhookStats(); stats.Alerts != 2 || stats.Summaries != 1 || stats.Grouped != 4 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// A new occurrence opens a new window.
+	emitAll(t, h, &message.Entry{Message: "db down", Level: level.ErrorLevel, Time: clock.Now()})
+	if texts = webhookTexts(t, h, requests); len(texts) != 4 {
+		t.Fatalf("texts = %q", texts)
+	}
+}
+
+func TestWebhookHandlerRateLimit(t *testing.T) {
+	srv, requests := recordingServer(t)
+	clock := &fakeClock{now: time.Date(2024, 6, 12, 10, 0, 0, 0, time.UTC)}
+	h, err := NewWebhookHandler((&WebhookHandlerConfig{URL: srv.URL}).WithMaxPerMinute(2).WithClock(clock), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		emitAll(t, h, &message.Entry{Message: msg, Level: level.ErrorLevel})
+		clock.Set(clock.Now().Add(time.Second))
+	}
+	if texts := webhookTexts(t, h, requests); len(texts) != 2 {
+		t.Fatalf("texts = %q", texts)
+	}
+	// The first alert leaves the last minute.
+	clock.Set(clock.Now().Add(57 * time.Second))
+	emitAll(t, h, &message.Entry{Message: "e", Level: level.ErrorLevel})
+	texts := webhookTexts(t, h, requests)
+	if len(texts) != 3 || !strings.HasSuffix(texts[2], ": e [2 alerts suppressed by rate limit]") {
+		t.Fatalf("texts = %q", texts)
+	}
+	if stats := h.WebhookStats(); stats.Alerts != 3 || stats.Suppressed != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestWebhookHandlerTemplate(t *testing.T) {
+	if _, err := NewWebhookHandler(&WebhookHandlerConfig{URL: "http://localhost", Template: `{"text": {{.Text}}}`}, nil); err == nil {
+		t.Fatal("template rendering invalid JSON accepted")
+	}
+	if _, err := NewWebhookHandler(&WebhookHandlerConfig{URL: "http://localhost", Template: `{"text": {{json .Text}`}, nil); err == nil {
+		t.Fatal("invalid template accepted")
+	}
+
+	srv, requests := recordingServer(t)
+	h, err := NewWebhookHandler((&WebhookHandlerConfig{URL: srv.URL, LoggerName: "api"}).WithTemplate(WebhookTemplateTeams), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitAll(t, h, &message.Entry{Message: `quote " and newline` + "\n", Level: level.PanicLevel, TraceID: "t1"})
+	_ = h.Close()
+	reqs := requests()
+	if len(reqs) != 1 || reqs[0].header.Get("Content-Type") != "application/json" {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	var card map[string]interface{}
+	if err = json.Unmarshal([]byte(reqs[0].body), &card); err != nil {
+		t.Fatal(err)
+	}
+	if card["@type"] != "MessageCard" || !strings.HasPrefix(card["title"].(string), "[PANIC] api") {
+		t.Fatalf("card = %v", card)
+	}
+}
+
+func TestWebhookHandlerCloseSendsSummaries(t *testing.T) {
+	srv, requests := recordingServer(t, http.StatusServiceUnavailable)
+	h, err := NewWebhookHandler((&WebhookHandlerConfig{URL: srv.URL}).WithRetry(fastRetry()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		emitAll(t, h, &message.Entry{Message: "timeout", Level: level.ErrorLevel})
+	}
+	_ = h.Close()
+	// The first attempt fails and is retried.
+	reqs := requests()
+	if len(reqs) != 3 || reqs[0].body != reqs[1].body || !strings.Contains(reqs[2].body, "2 more occurrences") {
+		t.Fatalf("requests = %+v", reqs)
+	}
+}
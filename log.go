@@ -1,6 +1,8 @@
 package log
 
 import (
+	"context"
+	"fmt"
 	"os"
 
 	"github.com/ml444/glog/level"
@@ -79,6 +81,67 @@ func Printf(template string, args ...interface{}) { logger.Printf(template, args
 func Panicf(template string, args ...interface{}) { logger.Panicf(template, args...) }
 func Fatalf(template string, args ...interface{}) { logger.Fatalf(template, args...) }
 
+func With(kv ...interface{}) ILogger                   { return logger.With(kv...) }
+func WithFields(fields map[string]interface{}) ILogger { return logger.WithFields(fields) }
+
+func Debugw(msg string, kv ...interface{}) { logger.Debugw(msg, kv...) }
+func Infow(msg string, kv ...interface{})  { logger.Infow(msg, kv...) }
+func Warnw(msg string, kv ...interface{})  { logger.Warnw(msg, kv...) }
+func Errorw(msg string, kv ...interface{}) { logger.Errorw(msg, kv...) }
+func Printw(msg string, kv ...interface{}) { logger.Printw(msg, kv...) }
+func Panicw(msg string, kv ...interface{}) { logger.Panicw(msg, kv...) }
+func Fatalw(msg string, kv ...interface{}) { logger.Fatalw(msg, kv...) }
+
+// The Ctx functions log through the logger stored in ctx by NewContext, or the package logger.
+
+func DebugCtx(ctx context.Context, args ...interface{}) { FromContext(ctx).DebugCtx(ctx, args...) }
+func InfoCtx(ctx context.Context, args ...interface{})  { FromContext(ctx).InfoCtx(ctx, args...) }
+func WarnCtx(ctx context.Context, args ...interface{})  { FromContext(ctx).WarnCtx(ctx, args...) }
+func ErrorCtx(ctx context.Context, args ...interface{}) { FromContext(ctx).ErrorCtx(ctx, args...) }
+func PrintCtx(ctx context.Context, args ...interface{}) { FromContext(ctx).PrintCtx(ctx, args...) }
+func PanicCtx(ctx context.Context, args ...interface{}) { FromContext(ctx).PanicCtx(ctx, args...) }
+func FatalCtx(ctx context.Context, args ...interface{}) { FromContext(ctx).FatalCtx(ctx, args...) }
+
+func DebugfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).DebugfCtx(ctx, template, args...)
+}
+func InfofCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).InfofCtx(ctx, template, args...)
+}
+func WarnfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).WarnfCtx(ctx, template, args...)
+}
+func ErrorfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).ErrorfCtx(ctx, template, args...)
+}
+func PrintfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).PrintfCtx(ctx, template, args...)
+}
+func PanicfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).PanicfCtx(ctx, template, args...)
+}
+func FatalfCtx(ctx context.Context, template string, args ...interface{}) {
+	FromContext(ctx).FatalfCtx(ctx, template, args...)
+}
+
+// Flush blocks until the entries logged before the call have been written, see Logger.Flush.
+func Flush(ctx context.Context) error {
+	return logger.Flush(ctx)
+}
+
+// Sync flushes and fsyncs the package logger, see Logger.Sync.
+func Sync() error {
+	return logger.Sync()
+}
+
+// Reopen makes the file handlers of the package logger reopen their files, see Logger.Reopen.
+func Reopen() error {
+	if l, ok := logger.(interface{ Reopen() error }); ok {
+		return l.Reopen()
+	}
+	return fmt.Errorf("reopen: %w", ErrEngineUnsupported)
+}
+
 func Stop() {
 	if logger != nil {
 		if err := logger.Stop(); err != nil {
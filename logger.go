@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
@@ -51,6 +52,46 @@ type ILogger interface {
 	Fatalf(template string, args ...interface{})
 	Panicf(template string, args ...interface{})
 
+	// With returns a child logger that adds the key/value pairs to every entry.
+	With(kv ...interface{}) ILogger
+	// WithFields is like With, the fields are added in key order.
+	WithFields(fields map[string]interface{}) ILogger
+
+	Debugw(msg string, kv ...interface{})
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+
+	Printw(msg string, kv ...interface{})
+	Fatalw(msg string, kv ...interface{})
+	Panicw(msg string, kv ...interface{})
+
+	// The Ctx variants add the values of the registered context extractors
+	// (see RegisterContextExtractor) to the entry.
+	DebugCtx(ctx context.Context, args ...interface{})
+	InfoCtx(ctx context.Context, args ...interface{})
+	WarnCtx(ctx context.Context, args ...interface{})
+	ErrorCtx(ctx context.Context, args ...interface{})
+
+	PrintCtx(ctx context.Context, args ...interface{})
+	FatalCtx(ctx context.Context, args ...interface{})
+	PanicCtx(ctx context.Context, args ...interface{})
+
+	DebugfCtx(ctx context.Context, template string, args ...interface{})
+	InfofCtx(ctx context.Context, template string, args ...interface{})
+	WarnfCtx(ctx context.Context, template string, args ...interface{})
+	ErrorfCtx(ctx context.Context, template string, args ...interface{})
+
+	PrintfCtx(ctx context.Context, template string, args ...interface{})
+	FatalfCtx(ctx context.Context, template string, args ...interface{})
+	PanicfCtx(ctx context.Context, template string, args ...interface{})
+
+	// Flush blocks until the entries logged before the call have been written by
+	// the handlers, without stopping the logger.
+	Flush(ctx context.Context) error
+	// Sync is Flush followed by an fsync of the files written by the handlers.
+	Sync() error
+
 	Stop() error
 }
 
@@ -64,6 +105,7 @@ type Logger struct {
 	callerSkip         int
 	enableRecordCaller bool
 	isStop             uint32
+	fields             message.Fields
 }
 
 // type FieldFunc func(entry *message.Entry) string
@@ -108,7 +150,7 @@ func (l *Logger) init() (err error) {
 	return nil
 }
 
-func (l *Logger) send(lvl Level, msg string) {
+func (l *Logger) send(ctx context.Context, lvl Level, msg string, fields message.Fields) {
 	if atomic.LoadUint32(&l.isStop) == 1 {
 		println("it is stopped, can't send: ", msg)
 		return
@@ -119,10 +161,12 @@ func (l *Logger) send(lvl Level, msg string) {
 		Message:   msg,
 		Time:      time.Now(),
 		Level:     lvl,
+		Fields:    l.fields.Merge(fields),
 	}
 	if l.TraceIDFunc != nil {
 		entry.TraceID = l.TraceIDFunc(entry)
 	}
+	applyContext(ctx, entry)
 
 	if l.enableRecordCaller {
 		entry.Caller = GetCallerFrame(l.callerSkip)
@@ -130,16 +174,16 @@ func (l *Logger) send(lvl Level, msg string) {
 	l.engine.Send(entry)
 }
 
-func (l *Logger) log(lvl Level, args ...interface{}) {
+func (l *Logger) log(ctx context.Context, lvl Level, args ...interface{}) {
 	if lvl < l.Level {
 		return
 	}
 	msg := fmt.Sprint(args...)
-	l.send(lvl, msg)
+	l.send(ctx, lvl, msg, nil)
 	l.after(lvl)
 }
 
-func (l *Logger) logf(lvl Level, template string, args ...interface{}) {
+func (l *Logger) logf(ctx context.Context, lvl Level, template string, args ...interface{}) {
 	if lvl < l.Level {
 		return
 	}
@@ -156,7 +200,21 @@ func (l *Logger) logf(lvl Level, template string, args ...interface{}) {
 		l.recordStack(4, buf)
 		msg = buf.String()
 	}
-	l.send(lvl, msg)
+	l.send(ctx, lvl, msg, nil)
+	l.after(lvl)
+}
+
+func (l *Logger) logw(lvl Level, msg string, kv ...interface{}) {
+	if lvl < l.Level {
+		return
+	}
+	if lvl >= PanicLevel {
+		buf := new(strings.Builder)
+		buf.WriteString(msg)
+		l.recordStack(4, buf)
+		msg = buf.String()
+	}
+	l.send(context.Background(), lvl, msg, message.FieldsFromKV(kv...))
 	l.after(lvl)
 }
 
@@ -204,45 +262,139 @@ func (l *Logger) SetLevel(lvl Level) {
 	l.Level = lvl
 }
 
-func (l *Logger) Debug(args ...interface{}) { l.log(DebugLevel, args...) }
-func (l *Logger) Info(args ...interface{})  { l.log(InfoLevel, args...) }
-func (l *Logger) Warn(args ...interface{})  { l.log(WarnLevel, args...) }
-func (l *Logger) Error(args ...interface{}) { l.log(ErrorLevel, args...) }
+// With returns a child logger sharing the engine of l, whose entries carry
+// the fields of l followed by kv. See message.FieldsFromKV for the pairing rules.
+func (l *Logger) With(kv ...interface{}) ILogger {
+	return l.withFields(message.FieldsFromKV(kv...))
+}
+
+func (l *Logger) WithFields(fields map[string]interface{}) ILogger {
+	return l.withFields(message.FieldsFromMap(fields))
+}
+
+func (l *Logger) withFields(fields message.Fields) *Logger {
+	child := &Logger{
+		Name:               l.Name,
+		Level:              l.Level,
+		ThrowOnLevel:       l.ThrowOnLevel,
+		ExitFunc:           l.ExitFunc,
+		TraceIDFunc:        l.TraceIDFunc,
+		engine:             l.engine,
+		callerSkip:         l.callerSkip,
+		enableRecordCaller: l.enableRecordCaller,
+		isStop:             atomic.LoadUint32(&l.isStop),
+	}
+	// Always copy, so that siblings never share the backing array.
+	child.fields = append(make(message.Fields, 0, len(l.fields)+len(fields)), l.fields...)
+	child.fields = append(child.fields, fields...)
+	return child
+}
+
+func (l *Logger) Debug(args ...interface{}) { l.log(context.Background(), DebugLevel, args...) }
+func (l *Logger) Info(args ...interface{})  { l.log(context.Background(), InfoLevel, args...) }
+func (l *Logger) Warn(args ...interface{})  { l.log(context.Background(), WarnLevel, args...) }
+func (l *Logger) Error(args ...interface{}) { l.log(context.Background(), ErrorLevel, args...) }
 
 func (l *Logger) Debugf(template string, args ...interface{}) {
-	l.logf(DebugLevel, template, args...)
+	l.logf(context.Background(), DebugLevel, template, args...)
 }
 
 func (l *Logger) Infof(template string, args ...interface{}) {
-	l.logf(InfoLevel, template, args...)
+	l.logf(context.Background(), InfoLevel, template, args...)
 }
 
 func (l *Logger) Warnf(template string, args ...interface{}) {
-	l.logf(WarnLevel, template, args...)
+	l.logf(context.Background(), WarnLevel, template, args...)
 }
 
 func (l *Logger) Errorf(template string, args ...interface{}) {
-	l.logf(ErrorLevel, template, args...)
+	l.logf(context.Background(), ErrorLevel, template, args...)
 }
 
-func (l *Logger) Print(args ...interface{}) { l.log(PrintLevel, args...) }
-func (l *Logger) Fatal(args ...interface{}) { l.log(FatalLevel, args...) }
-func (l *Logger) Panic(args ...interface{}) { l.log(PanicLevel, args...) }
+func (l *Logger) Print(args ...interface{}) { l.log(context.Background(), PrintLevel, args...) }
+func (l *Logger) Fatal(args ...interface{}) { l.log(context.Background(), FatalLevel, args...) }
+func (l *Logger) Panic(args ...interface{}) { l.log(context.Background(), PanicLevel, args...) }
 
-func (l *Logger) Println(args ...interface{}) { l.log(PrintLevel, args...) }
-func (l *Logger) Fatalln(args ...interface{}) { l.log(FatalLevel, args...) }
-func (l *Logger) Panicln(args ...interface{}) { l.log(PanicLevel, args...) }
+func (l *Logger) Println(args ...interface{}) { l.log(context.Background(), PrintLevel, args...) }
+func (l *Logger) Fatalln(args ...interface{}) { l.log(context.Background(), FatalLevel, args...) }
+func (l *Logger) Panicln(args ...interface{}) { l.log(context.Background(), PanicLevel, args...) }
 
 func (l *Logger) Printf(template string, args ...interface{}) {
-	l.logf(PrintLevel, template, args...)
+	l.logf(context.Background(), PrintLevel, template, args...)
 }
 
 func (l *Logger) Panicf(template string, args ...interface{}) {
-	l.logf(PanicLevel, template, args...)
+	l.logf(context.Background(), PanicLevel, template, args...)
 }
 
 func (l *Logger) Fatalf(template string, args ...interface{}) {
-	l.logf(FatalLevel, template, args...)
+	l.logf(context.Background(), FatalLevel, template, args...)
+}
+
+func (l *Logger) Debugw(msg string, kv ...interface{}) { l.logw(DebugLevel, msg, kv...) }
+func (l *Logger) Infow(msg string, kv ...interface{})  { l.logw(InfoLevel, msg, kv...) }
+func (l *Logger) Warnw(msg string, kv ...interface{})  { l.logw(WarnLevel, msg, kv...) }
+func (l *Logger) Errorw(msg string, kv ...interface{}) { l.logw(ErrorLevel, msg, kv...) }
+func (l *Logger) Printw(msg string, kv ...interface{}) { l.logw(PrintLevel, msg, kv...) }
+func (l *Logger) Fatalw(msg string, kv ...interface{}) { l.logw(FatalLevel, msg, kv...) }
+func (l *Logger) Panicw(msg string, kv ...interface{}) { l.logw(PanicLevel, msg, kv...) }
+
+func (l *Logger) DebugCtx(ctx context.Context, args ...interface{}) { l.log(ctx, DebugLevel, args...) }
+func (l *Logger) InfoCtx(ctx context.Context, args ...interface{})  { l.log(ctx, InfoLevel, args...) }
+func (l *Logger) WarnCtx(ctx context.Context, args ...interface{})  { l.log(ctx, WarnLevel, args...) }
+func (l *Logger) ErrorCtx(ctx context.Context, args ...interface{}) { l.log(ctx, ErrorLevel, args...) }
+func (l *Logger) PrintCtx(ctx context.Context, args ...interface{}) { l.log(ctx, PrintLevel, args...) }
+func (l *Logger) FatalCtx(ctx context.Context, args ...interface{}) { l.log(ctx, FatalLevel, args...) }
+func (l *Logger) PanicCtx(ctx context.Context, args ...interface{}) { l.log(ctx, PanicLevel, args...) }
+
+func (l *Logger) DebugfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, DebugLevel, template, args...)
+}
+
+func (l *Logger) InfofCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, InfoLevel, template, args...)
+}
+
+func (l *Logger) WarnfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, WarnLevel, template, args...)
+}
+
+func (l *Logger) ErrorfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, ErrorLevel, template, args...)
+}
+
+func (l *Logger) PrintfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, PrintLevel, template, args...)
+}
+
+func (l *Logger) FatalfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, FatalLevel, template, args...)
+}
+
+func (l *Logger) PanicfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, PanicLevel, template, args...)
+}
+
+func (l *Logger) Flush(ctx context.Context) error {
+	if eng, ok := l.engine.(IEngineFlusher); ok {
+		return eng.Flush(ctx)
+	}
+	return fmt.Errorf("flush: %w", ErrEngineUnsupported)
+}
+
+func (l *Logger) Sync() error {
+	if eng, ok := l.engine.(IEngineFlusher); ok {
+		return eng.Sync(context.Background())
+	}
+	return fmt.Errorf("sync: %w", ErrEngineUnsupported)
+}
+
+// Reopen makes the file handlers reopen their files, e.g. after logrotate moved them.
+func (l *Logger) Reopen() error {
+	if eng, ok := l.engine.(IEngineReopener); ok {
+		return eng.Reopen()
+	}
+	return fmt.Errorf("reopen: %w", ErrEngineUnsupported)
 }
 
 func (l *Logger) Stop() error {
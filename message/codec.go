@@ -0,0 +1,96 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/ml444/glog/level"
+)
+
+// encodedEntry is the serialized form of an Entry, e.g. in the spill queue.
+// Only the printable part of Caller survives.
+type encodedEntry struct {
+	Message   string         `json:"msg"`
+	TraceID   string         `json:"trace_id,omitempty"`
+	RoutineID int64          `json:"goid,omitempty"`
+	Time      time.Time      `json:"time"`
+	Level     level.LogLevel `json:"level"`
+	Function  string         `json:"func,omitempty"`
+	File      string         `json:"file,omitempty"`
+	Line      int            `json:"line,omitempty"`
+	Fields    Fields         `json:"fields,omitempty"`
+}
+
+// MarshalEntry encodes e so that UnmarshalEntry can restore it in another
+// goroutine or process. Field values come back as JSON values.
+func MarshalEntry(e *Entry) ([]byte, error) {
+	enc := encodedEntry{
+		Message:   e.Message,
+		TraceID:   e.TraceID,
+		RoutineID: e.RoutineID,
+		Time:      e.Time,
+		Level:     e.Level,
+		Fields:    e.Fields,
+	}
+	if e.Caller != nil {
+		enc.Function = e.Caller.Function
+		enc.File = e.Caller.File
+		enc.Line = e.Caller.Line
+	}
+	return json.Marshal(enc)
+}
+
+func UnmarshalEntry(data []byte) (*Entry, error) {
+	var enc encodedEntry
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, err
+	}
+	e := &Entry{
+		Message:   enc.Message,
+		TraceID:   enc.TraceID,
+		RoutineID: enc.RoutineID,
+		Time:      enc.Time,
+		Level:     enc.Level,
+		Fields:    enc.Fields,
+	}
+	if enc.Function != "" || enc.File != "" {
+		e.Caller = &runtime.Frame{Function: enc.Function, File: enc.File, Line: enc.Line}
+	}
+	return e, nil
+}
+
+// UnmarshalJSON reads an object written by MarshalJSON, keeping the key order.
+// Numbers are kept as json.Number.
+func (fs *Fields) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*fs = nil
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return errors.New("fields: expected a JSON object")
+	}
+	var out Fields
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		var v interface{}
+		if err = dec.Decode(&v); err != nil {
+			return err
+		}
+		out = append(out, Field{Key: key, Value: v})
+	}
+	*fs = out
+	return nil
+}
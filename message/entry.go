@@ -14,4 +14,5 @@ type Entry struct {
 	Time      time.Time
 	Level     level.LogLevel
 	Caller    *runtime.Frame
+	Fields    Fields
 }
@@ -0,0 +1,171 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// badKey is used as the key of a trailing value that has no key.
+const badKey = "!BADKEY"
+
+// Field is a typed key/value pair attached to an Entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields keeps the order in which the pairs were added.
+type Fields []Field
+
+// FieldsFromKV converts alternating key/value arguments into Fields.
+// A Field argument is taken as is, a non-string key is formatted with fmt.Sprint
+// and a trailing value without key is stored under "!BADKEY".
+func FieldsFromKV(kv ...interface{}) Fields {
+	if len(kv) == 0 {
+		return nil
+	}
+	fields := make(Fields, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); {
+		switch k := kv[i].(type) {
+		case Field:
+			fields = append(fields, k)
+			i++
+			continue
+		case string:
+			if i+1 < len(kv) {
+				fields = append(fields, Field{Key: k, Value: kv[i+1]})
+			} else {
+				fields = append(fields, Field{Key: badKey, Value: k})
+			}
+		default:
+			if i+1 < len(kv) {
+				fields = append(fields, Field{Key: fmt.Sprint(k), Value: kv[i+1]})
+			} else {
+				fields = append(fields, Field{Key: badKey, Value: k})
+			}
+		}
+		i += 2
+	}
+	return fields
+}
+
+// FieldsFromMap converts m into Fields sorted by key.
+func FieldsFromMap(m map[string]interface{}) Fields {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make(Fields, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, Field{Key: k, Value: m[k]})
+	}
+	return fields
+}
+
+// Merge returns a new slice holding fs followed by more; fs is never modified.
+func (fs Fields) Merge(more Fields) Fields {
+	if len(more) == 0 {
+		return fs
+	}
+	if len(fs) == 0 {
+		return more
+	}
+	out := make(Fields, 0, len(fs)+len(more))
+	out = append(out, fs...)
+	return append(out, more...)
+}
+
+// Get returns the value of the last field named key.
+func (fs Fields) Get(key string) (interface{}, bool) {
+	for i := len(fs) - 1; i >= 0; i-- {
+		if fs[i].Key == key {
+			return fs[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// String formats the value the way the text formatter renders it. fmt calls
+// Error and String, and recovers their panics on nil pointer receivers.
+func (f Field) String() string {
+	if v, ok := f.Value.(string); ok {
+		return v
+	}
+	return fmt.Sprint(f.Value)
+}
+
+func (fs Fields) MarshalJSON() ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(marshalFieldValue(f.Value))
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func marshalFieldValue(v interface{}) []byte {
+	if _, ok := v.(error); ok {
+		if _, isMarshaler := v.(json.Marshaler); !isMarshaler {
+			// Not Error, which panics on a typed nil.
+			v = fmt.Sprint(v)
+		}
+	}
+	val, err := json.Marshal(v)
+	if err != nil {
+		val, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return val
+}
+
+func (fs Fields) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, f := range fs {
+		el := xml.StartElement{Name: xml.Name{Local: xmlElementName(f.Key)}}
+		if err := e.EncodeElement(f.String(), el); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// xmlElementName replaces the characters that are not allowed in an XML name.
+func xmlElementName(key string) string {
+	if key == "" {
+		return "_"
+	}
+	b := strings.Builder{}
+	b.Grow(len(key))
+	for i, r := range key {
+		valid := r == '_' || r == '-' || r == '.' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if i == 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')) {
+			valid = false
+		}
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
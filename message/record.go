@@ -14,4 +14,5 @@ type Record struct {
 	HostName   string `json:"host,omitempty"`
 	TraceID    string `json:"trace_id,omitempty"`
 	Message    string `json:"msg,omitempty"`
+	Fields     Fields `json:"fields,omitempty" xml:"Fields,omitempty"`
 }
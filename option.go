@@ -48,3 +48,8 @@ func SetOnError(fn func(v interface{}, err error)) OptionFunc {
 func SetTraceIDFunc(fn func(entry *message.Entry) string) OptionFunc {
 	return func(cfg *Config) { cfg.TraceIDFunc = fn }
 }
+
+// SetReopenOnSIGHUP reopen the log files on SIGHUP, e.g. after logrotate moved them.
+func SetReopenOnSIGHUP(enable bool) OptionFunc {
+	return func(cfg *Config) { cfg.ReopenOnSIGHUP = enable }
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9 || js || wasip1
+
+package log
+
+import "os"
+
+func reopenNotifySignals() []os.Signal {
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+func reopenNotifySignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
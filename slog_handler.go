@@ -0,0 +1,177 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/petermattis/goid"
+
+	"github.com/ml444/glog/message"
+)
+
+// SlogHandler is a slog.Handler that sends records through the engine of a Logger,
+// so that slog output shares the workers, backpressure and handlers of glog.
+//
+//	slog.SetDefault(slog.New(log.NewSlogHandler(logger)))
+type SlogHandler struct {
+	logger *Logger
+	fields message.Fields
+	prefix string // dotted group path, ends with "." when not empty
+}
+
+var _ slog.Handler = &SlogHandler{}
+
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{logger: l, fields: l.fields}
+}
+
+// Flush flushes the logger behind the handler, see Logger.Flush.
+func (h *SlogHandler) Flush(ctx context.Context) error {
+	return h.logger.Flush(ctx)
+}
+
+// Sync syncs the logger behind the handler, see Logger.Sync.
+func (h *SlogHandler) Sync() error {
+	return h.logger.Sync()
+}
+
+// SlogLevelToLevel maps a slog.Level to the nearest glog level at or below it,
+// the reverse of LevelToSlogLevel.
+func SlogLevelToLevel(lvl slog.Level) Level {
+	switch {
+	case lvl < slog.LevelInfo:
+		return DebugLevel
+	case lvl < slog.LevelWarn:
+		return InfoLevel
+	case lvl < slog.LevelError:
+		return WarnLevel
+	case lvl < slog.LevelError+4:
+		return ErrorLevel
+	case lvl < slog.LevelError+8:
+		return PanicLevel
+	default:
+		return FatalLevel
+	}
+}
+
+// LevelToSlogLevel maps a glog level to a slog.Level. PrintLevel becomes
+// slog.LevelInfo; PanicLevel and FatalLevel are placed above slog.LevelError.
+func LevelToSlogLevel(lvl Level) slog.Level {
+	switch lvl {
+	case DebugLevel:
+		return slog.LevelDebug
+	case PrintLevel, InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	case PanicLevel:
+		return slog.LevelError + 4
+	case FatalLevel:
+		return slog.LevelError + 8
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// Enabled checks the level of the logger and the thresholds of its workers.
+func (h *SlogHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	l := SlogLevelToLevel(lvl)
+	if l < h.logger.Level || atomic.LoadUint32(&h.logger.isStop) == 1 {
+		return false
+	}
+	if eng, ok := h.logger.engine.(interface{ Enabled(Level) bool }); ok {
+		return eng.Enabled(l)
+	}
+	return true
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	entry := &message.Entry{
+		RoutineID: goid.Get(),
+		Message:   r.Message,
+		Time:      r.Time,
+		Level:     SlogLevelToLevel(r.Level),
+		Fields:    h.fields,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if r.NumAttrs() > 0 {
+		fields := make(message.Fields, 0, len(h.fields)+r.NumAttrs())
+		fields = append(fields, h.fields...)
+		r.Attrs(func(a slog.Attr) bool {
+			fields = appendSlogAttr(fields, h.prefix, a)
+			return true
+		})
+		entry.Fields = fields
+	}
+	if h.logger.TraceIDFunc != nil {
+		entry.TraceID = h.logger.TraceIDFunc(entry)
+	}
+	if ctx != nil {
+		applyContext(ctx, entry)
+	}
+	if h.logger.enableRecordCaller && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.Caller = &frame
+	}
+	h.logger.engine.Send(entry)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make(message.Fields, 0, len(h.fields)+len(attrs))
+	fields = append(fields, h.fields...)
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, h.prefix, a)
+	}
+	return &SlogHandler{logger: h.logger, fields: fields, prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{logger: h.logger, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// appendSlogAttr flattens a into fields, joining group names with ".".
+func appendSlogAttr(fields message.Fields, prefix string, a slog.Attr) message.Fields {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		if len(group) == 0 {
+			return fields
+		}
+		if a.Key != "" {
+			prefix = prefix + a.Key + "."
+		}
+		for _, ga := range group {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, message.Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// slogAttrsFromFields converts glog fields to slog attributes.
+func slogAttrsFromFields(fields message.Fields) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	return attrs
+}
@@ -0,0 +1,251 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/ml444/glog/message"
+)
+
+// SlogLogger implements ILogger on top of any slog.Handler. It lets code written
+// against glog run on a slog pipeline while a service migrates between the two.
+type SlogLogger struct {
+	Name         string
+	Level        Level
+	ThrowOnLevel Level
+	ExitFunc     func(code int)
+	handler      slog.Handler
+}
+
+var (
+	_ StdLogger = &SlogLogger{}
+	_ ILogger   = &SlogLogger{}
+)
+
+func NewSlogLogger(h slog.Handler) *SlogLogger {
+	return &SlogLogger{
+		Level:        DebugLevel,
+		ThrowOnLevel: NoneLevel,
+		ExitFunc:     os.Exit,
+		handler:      h,
+	}
+}
+
+// Handler returns the underlying slog.Handler.
+func (l *SlogLogger) Handler() slog.Handler {
+	return l.handler
+}
+
+func (l *SlogLogger) enabled(ctx context.Context, lvl Level) bool {
+	return lvl >= l.Level && l.handler.Enabled(ctx, LevelToSlogLevel(lvl))
+}
+
+// handle passes ctx on to the slog.Handler; context extractors are applied by
+// glog's own SlogHandler, other handlers read ctx themselves.
+func (l *SlogLogger) handle(ctx context.Context, lvl Level, msg string, fields message.Fields) {
+	var pcs [1]uintptr
+	// skip [runtime.Callers, handle, log*, exported method]
+	runtime.Callers(4, pcs[:])
+	r := slog.NewRecord(time.Now(), LevelToSlogLevel(lvl), msg, pcs[0])
+	if len(fields) > 0 {
+		r.AddAttrs(slogAttrsFromFields(fields)...)
+	}
+	if err := l.handler.Handle(ctx, r); err != nil {
+		println("glog slog handler error: ", err.Error())
+	}
+	l.after(lvl)
+}
+
+func (l *SlogLogger) log(ctx context.Context, lvl Level, args ...interface{}) {
+	if !l.enabled(ctx, lvl) {
+		return
+	}
+	l.handle(ctx, lvl, fmt.Sprint(args...), nil)
+}
+
+func (l *SlogLogger) logf(ctx context.Context, lvl Level, template string, args ...interface{}) {
+	if !l.enabled(ctx, lvl) {
+		return
+	}
+	msg := template
+	if msg == "" {
+		msg = fmt.Sprint(args...)
+	} else {
+		msg = fmt.Sprintf(template, args...)
+	}
+	l.handle(ctx, lvl, msg, nil)
+}
+
+func (l *SlogLogger) logw(lvl Level, msg string, kv ...interface{}) {
+	ctx := context.Background()
+	if !l.enabled(ctx, lvl) {
+		return
+	}
+	l.handle(ctx, lvl, msg, message.FieldsFromKV(kv...))
+}
+
+func (l *SlogLogger) after(lvl Level) {
+	if lvl < PanicLevel {
+		return
+	}
+	if l.ThrowOnLevel != NoneLevel && lvl >= l.ThrowOnLevel {
+		l.ExitFunc(-1)
+	}
+}
+
+func (l *SlogLogger) GetLoggerName() string {
+	return l.Name
+}
+
+func (l *SlogLogger) SetLoggerName(name string) {
+	l.Name = name
+}
+
+func (l *SlogLogger) GetLevel() Level {
+	return l.Level
+}
+
+func (l *SlogLogger) SetLevel(lvl Level) {
+	l.Level = lvl
+}
+
+func (l *SlogLogger) With(kv ...interface{}) ILogger {
+	return l.withFields(message.FieldsFromKV(kv...))
+}
+
+func (l *SlogLogger) WithFields(fields map[string]interface{}) ILogger {
+	return l.withFields(message.FieldsFromMap(fields))
+}
+
+func (l *SlogLogger) withFields(fields message.Fields) *SlogLogger {
+	child := *l
+	if len(fields) > 0 {
+		child.handler = l.handler.WithAttrs(slogAttrsFromFields(fields))
+	}
+	return &child
+}
+
+func (l *SlogLogger) Debug(args ...interface{}) { l.log(context.Background(), DebugLevel, args...) }
+func (l *SlogLogger) Info(args ...interface{})  { l.log(context.Background(), InfoLevel, args...) }
+func (l *SlogLogger) Warn(args ...interface{})  { l.log(context.Background(), WarnLevel, args...) }
+func (l *SlogLogger) Error(args ...interface{}) { l.log(context.Background(), ErrorLevel, args...) }
+
+func (l *SlogLogger) Print(args ...interface{}) { l.log(context.Background(), PrintLevel, args...) }
+func (l *SlogLogger) Fatal(args ...interface{}) { l.log(context.Background(), FatalLevel, args...) }
+func (l *SlogLogger) Panic(args ...interface{}) { l.log(context.Background(), PanicLevel, args...) }
+
+func (l *SlogLogger) Println(args ...interface{}) { l.log(context.Background(), PrintLevel, args...) }
+func (l *SlogLogger) Fatalln(args ...interface{}) { l.log(context.Background(), FatalLevel, args...) }
+func (l *SlogLogger) Panicln(args ...interface{}) { l.log(context.Background(), PanicLevel, args...) }
+
+func (l *SlogLogger) Debugf(template string, args ...interface{}) {
+	l.logf(context.Background(), DebugLevel, template, args...)
+}
+
+func (l *SlogLogger) Infof(template string, args ...interface{}) {
+	l.logf(context.Background(), InfoLevel, template, args...)
+}
+
+func (l *SlogLogger) Warnf(template string, args ...interface{}) {
+	l.logf(context.Background(), WarnLevel, template, args...)
+}
+
+func (l *SlogLogger) Errorf(template string, args ...interface{}) {
+	l.logf(context.Background(), ErrorLevel, template, args...)
+}
+
+func (l *SlogLogger) Printf(template string, args ...interface{}) {
+	l.logf(context.Background(), PrintLevel, template, args...)
+}
+
+func (l *SlogLogger) Fatalf(template string, args ...interface{}) {
+	l.logf(context.Background(), FatalLevel, template, args...)
+}
+
+func (l *SlogLogger) Panicf(template string, args ...interface{}) {
+	l.logf(context.Background(), PanicLevel, template, args...)
+}
+
+func (l *SlogLogger) Debugw(msg string, kv ...interface{}) { l.logw(DebugLevel, msg, kv...) }
+func (l *SlogLogger) Infow(msg string, kv ...interface{})  { l.logw(InfoLevel, msg, kv...) }
+func (l *SlogLogger) Warnw(msg string, kv ...interface{})  { l.logw(WarnLevel, msg, kv...) }
+func (l *SlogLogger) Errorw(msg string, kv ...interface{}) { l.logw(ErrorLevel, msg, kv...) }
+func (l *SlogLogger) Printw(msg string, kv ...interface{}) { l.logw(PrintLevel, msg, kv...) }
+func (l *SlogLogger) Fatalw(msg string, kv ...interface{}) { l.logw(FatalLevel, msg, kv...) }
+func (l *SlogLogger) Panicw(msg string, kv ...interface{}) { l.logw(PanicLevel, msg, kv...) }
+
+func (l *SlogLogger) DebugCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, DebugLevel, args...)
+}
+func (l *SlogLogger) InfoCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, InfoLevel, args...)
+}
+func (l *SlogLogger) WarnCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, WarnLevel, args...)
+}
+func (l *SlogLogger) ErrorCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, ErrorLevel, args...)
+}
+func (l *SlogLogger) PrintCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, PrintLevel, args...)
+}
+func (l *SlogLogger) FatalCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, FatalLevel, args...)
+}
+func (l *SlogLogger) PanicCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, PanicLevel, args...)
+}
+
+func (l *SlogLogger) DebugfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, DebugLevel, template, args...)
+}
+
+func (l *SlogLogger) InfofCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, InfoLevel, template, args...)
+}
+
+func (l *SlogLogger) WarnfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, WarnLevel, template, args...)
+}
+
+func (l *SlogLogger) ErrorfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, ErrorLevel, template, args...)
+}
+
+func (l *SlogLogger) PrintfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, PrintLevel, template, args...)
+}
+
+func (l *SlogLogger) FatalfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, FatalLevel, template, args...)
+}
+
+func (l *SlogLogger) PanicfCtx(ctx context.Context, template string, args ...interface{}) {
+	l.logf(ctx, PanicLevel, template, args...)
+}
+
+// Flush flushes the handler when it supports it, e.g. the handler returned by NewSlogHandler.
+func (l *SlogLogger) Flush(ctx context.Context) error {
+	if f, ok := l.handler.(interface{ Flush(context.Context) error }); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+func (l *SlogLogger) Sync() error {
+	if s, ok := l.handler.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Stop is a no-op; a slog.Handler has no lifecycle of its own.
+func (l *SlogLogger) Stop() error {
+	return nil
+}
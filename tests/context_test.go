@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+type tenantKey struct{}
+
+func TestContextExtractorsAndLoggerInContext(t *testing.T) {
+	log.RegisterContextExtractor("region", func(ctx context.Context) (interface{}, bool) {
+		v, ok := ctx.Value(tenantKey{}).(string)
+		return v, ok
+	})
+	defer log.RegisterContextExtractor("region", nil)
+
+	buf := &closeBuffer{}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "ctx",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 8).
+				SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: buf}).
+				SetJSONFormatterConfig(&log.JSONFormatterConfig{}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+
+	ctx := log.ContextWithTraceID(context.Background(), "trace-1")
+	ctx = log.ContextWithUser(ctx, "alice")
+	ctx = context.WithValue(ctx, tenantKey{}, "eu")
+	ctx = log.NewContext(ctx, logger.With("component", "api"))
+
+	log.ErrorfCtx(ctx, "failed: %d", 42)
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	var rec struct {
+		TraceID string                 `json:"trace_id"`
+		Msg     string                 `json:"msg"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	out := bytes.TrimSpace(buf.Bytes())
+	if err := json.Unmarshal(out, &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", out, err)
+	}
+	if rec.TraceID != "trace-1" || rec.Msg != "failed: 42" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.Fields["component"] != "api" || rec.Fields["user"] != "alice" || rec.Fields["region"] != "eu" {
+		t.Fatalf("unexpected fields %+v", rec.Fields)
+	}
+	if _, ok := rec.Fields["trace_id"]; ok {
+		t.Fatal("trace id must not be duplicated into the fields")
+	}
+}
+
+// The methods without a context run the extractors against context.Background.
+func TestContextExtractorsWithoutContext(t *testing.T) {
+	var calls, nilCtx int
+	log.RegisterContextExtractor("region", func(ctx context.Context) (interface{}, bool) {
+		calls++
+		if ctx == nil {
+			nilCtx++
+			return nil, false
+		}
+		v, ok := ctx.Value(tenantKey{}).(string)
+		return v, ok
+	})
+	defer log.RegisterContextExtractor("region", nil)
+
+	buf := &closeBuffer{}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "ctx",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 8).
+				SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: buf}).
+				SetJSONFormatterConfig(&log.JSONFormatterConfig{}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	logger.Info("a")
+	logger.Infof("%s", "b")
+	logger.Infow("c", "k", 1)
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if calls != 3 || nilCtx != 0 {
+		t.Fatalf("calls = %d, with a nil context = %d", calls, nilCtx)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte(`"msg"`)); n != 3 || bytes.Contains(buf.Bytes(), []byte("region")) {
+		t.Fatalf("records = %d: %q", n, buf.Bytes())
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+func newFieldsLogger(t *testing.T, stream *closeBuffer, wc *log.WorkerConfig) *log.Logger {
+	t.Helper()
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:       "fields",
+		LoggerLevel:      log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{wc.SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: stream})},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	return logger
+}
+
+func TestWithFieldsJSON(t *testing.T) {
+	buf := &closeBuffer{}
+	logger := newFieldsLogger(t, buf, log.NewWorkerConfig(log.PrintLevel, 8).
+		SetJSONFormatterConfig(&log.JSONFormatterConfig{}))
+
+	child := logger.With("request_id", "r-1", "attempt", 2)
+	child.Infow("handled", "status", 200)
+	logger.Info("no fields")
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.Bytes())
+	}
+	var rec struct {
+		Msg    string                 `json:"msg"`
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(lines[0], &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", lines[0], err)
+	}
+	if rec.Msg != "handled" || rec.Fields["request_id"] != "r-1" || rec.Fields["attempt"] != float64(2) || rec.Fields["status"] != float64(200) {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	if bytes.Contains(lines[1], []byte(`"fields":`)) {
+		t.Fatalf("parent logger must not carry child fields: %s", lines[1])
+	}
+}
+
+func TestWithFieldsText(t *testing.T) {
+	buf := &closeBuffer{}
+	textCfg := log.NewDefaultTextFormatterConfig().
+		WithBaseFormatterConfig(log.NewDefaultBaseFormatterConfig()).
+		WithPatternStyle("%[Message]v")
+	logger := newFieldsLogger(t, buf, log.NewWorkerConfig(log.PrintLevel, 8).SetTextFormatterConfig(textCfg))
+
+	logger.WithFields(map[string]interface{}{"user": "bob smith", "id": 7}).Errorw("failed", "component", "db")
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	got := strings.TrimSpace(string(buf.Bytes()))
+	want := `failed id=7 user="bob smith" component=db`
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWithFieldsXML(t *testing.T) {
+	buf := &closeBuffer{}
+	logger := newFieldsLogger(t, buf, log.NewWorkerConfig(log.PrintLevel, 8).
+		SetXMLFormatterConfig(&log.XMLFormatterConfig{}))
+
+	logger.Infow("xml", "tenant", "acme")
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	var rec struct {
+		Fields struct {
+			Tenant string `xml:"tenant"`
+		} `xml:"Fields"`
+	}
+	if err := xml.Unmarshal(bytes.TrimSpace(buf.Bytes()), &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.Bytes(), err)
+	}
+	if rec.Fields.Tenant != "acme" {
+		t.Fatalf("tenant = %q, want acme", rec.Fields.Tenant)
+	}
+}
+
+type codeError struct{ code int }
+
+func (e *codeError) Error() string { return "code " + strconv.Itoa(e.code) }
+
+func TestTypedNilErrorField(t *testing.T) {
+	var err *codeError
+	for _, wc := range []*log.WorkerConfig{
+		log.NewWorkerConfig(log.PrintLevel, 8).SetTextFormatterConfig(log.NewDefaultTextFormatterConfig().WithPatternStyle("%[Message]v")),
+		log.NewWorkerConfig(log.PrintLevel, 8).SetJSONFormatterConfig(&log.JSONFormatterConfig{}),
+	} {
+		buf := &closeBuffer{}
+		logger := newFieldsLogger(t, buf, wc)
+		logger.Errorw("lookup", "err", err)
+		if err := logger.Stop(); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		// JSON escapes the angle brackets.
+		if got := string(buf.Bytes()); !strings.Contains(got, "<nil>") && !strings.Contains(got, `\u003cnil\u003e`) {
+			t.Errorf("got %q", got)
+		}
+	}
+}
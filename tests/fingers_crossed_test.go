@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+	"github.com/ml444/glog/message"
+)
+
+type messageHandler struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (h *messageHandler) Emit(e *message.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, e.Message)
+	return nil
+}
+
+func (h *messageHandler) Close() error { return nil }
+
+func TestFingersCrossedThroughLogger(t *testing.T) {
+	h := &messageHandler{}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.DebugLevel, 16).
+				SetHandler(h).
+				SetFingersCrossedConfig(log.NewFingersCrossedConfig(log.ErrorLevel)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Debug("connecting")
+	logger.Info("serving")
+	logger.Debug("query")
+	logger.Error("query failed")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	h.mu.Lock()
+	got := h.messages
+	h.mu.Unlock()
+	want := []string{"serving", "connecting", "query", "query failed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+	stats := logger.Stats().Workers[0].FingersCrossed
+	if stats.Buffered != 2 || stats.Triggers != 1 || stats.Flushed != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
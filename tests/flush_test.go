@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/ml444/glog"
+)
+
+func TestLoggerFlushWritesFileWithoutStopping(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "flush",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 256).SetFileHandlerConfig(
+				log.NewDefaultFileHandlerConfig(dir).
+					WithFileName("flush").
+					WithRotatorType(log.FileRotatorTypeSize),
+			).SetTextFormatterConfig(log.NewDefaultTextFormatterConfig().WithPatternStyle("%[Message]v")),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	for i := 0; i < 100; i++ {
+		logger.Infof("line:%d", i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logger.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "flush.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("line:")); n != 100 {
+		t.Fatalf("found %d lines after Flush, want 100", n)
+	}
+
+	logger.Info("after flush")
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "flush.log"))
+	if !bytes.Contains(data, []byte("after flush")) {
+		t.Fatal("logger must keep running after Flush")
+	}
+}
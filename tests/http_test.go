@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+func TestHTTPHandlerThroughLogger(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "svc",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.InfoLevel, 16).
+				SetHTTPHandlerConfig(log.NewDefaultHTTPHandlerConfig(srv.URL)).
+				SetJSONFormatterConfig(log.NewDefaultJSONFormatterConfig()),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Debug("skipped")
+	logger.Infow("shipped", "id", 7)
+	logger.Error("failed")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	fields, _ := rec["fields"].(map[string]interface{})
+	if rec["msg"] != "shipped" || fields["id"] != float64(7) {
+		t.Fatalf("record = %v", rec)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	log "github.com/ml444/glog"
+)
+
+func TestReopenOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hup.log")
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:     "hup",
+		LoggerLevel:    log.DebugLevel,
+		ReopenOnSIGHUP: true,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 16).SetFileHandlerConfig(
+				log.NewDefaultFileHandlerConfig(dir).
+					WithFileName("hup").
+					WithRotatorType(log.FileRotatorTypeExternal),
+			).SetTextFormatterConfig(log.NewDefaultTextFormatterConfig().WithPatternStyle("%[Message]v")),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Info("before")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file was not reopened after SIGHUP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	logger.Info("after")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "after\n" {
+		t.Fatalf("reopened file = %q", data)
+	}
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+func TestRingHandlerThroughLogger(t *testing.T) {
+	ring, err := log.NewRingHandler(log.NewDefaultRingHandlerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.DebugLevel, 16).
+				AddBranch(log.NewBranchConfig("ring", log.DebugLevel).SetHandler(ring)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Debug("cache warm")
+	logger.Warnw("disk almost full", "used", 0.93)
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/logs", ring.HTTPHandler())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/logs?level=warn", nil))
+	var records []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if len(records) != 1 || records[0]["msg"] != "disk almost full" || records[0]["level"] != "WARN" {
+		t.Fatalf("records = %v", records)
+	}
+	if stats := ring.RingStats(); stats.Entries != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
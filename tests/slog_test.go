@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+func TestSlogHandlerSendsThroughEngine(t *testing.T) {
+	buf := &closeBuffer{}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "slog",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.InfoLevel, 8).
+				SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: buf}).
+				SetJSONFormatterConfig(&log.JSONFormatterConfig{}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	h := log.NewSlogHandler(logger)
+	if h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("debug must be disabled by the worker threshold")
+	}
+	if !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Fatal("warn must be enabled")
+	}
+
+	sl := slog.New(h).With("service", "api").WithGroup("req")
+	sl.Debug("dropped")
+	sl.Warn("slow", "path", "/x", slog.Group("db", "rows", 3))
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	out := bytes.TrimSpace(buf.Bytes())
+	if bytes.Count(out, []byte("\n")) != 0 {
+		t.Fatalf("want exactly one record, got %q", out)
+	}
+	var rec struct {
+		Level  string                 `json:"level"`
+		Msg    string                 `json:"msg"`
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(out, &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", out, err)
+	}
+	if rec.Level != "WARN" || rec.Msg != "slow" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.Fields["service"] != "api" || rec.Fields["req.path"] != "/x" || rec.Fields["req.db.rows"] != float64(3) {
+		t.Fatalf("unexpected fields %+v", rec.Fields)
+	}
+}
+
+func TestSlogLoggerOnTopOfSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.NewSlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	l.Debug("hidden")
+	l.With("component", "db").Errorw("query failed", "table", "users")
+	l.Infof("%d rows", 2)
+
+	got := buf.String()
+	if strings.Contains(got, "hidden") {
+		t.Fatalf("debug record must be dropped by the slog handler: %q", got)
+	}
+	for _, want := range []string{"level=ERROR", `msg="query failed"`, "component=db", "table=users", `msg="2 rows"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("output %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestSlogLevelRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		level log.Level
+		slog  slog.Level
+		back  log.Level
+	}{
+		{log.DebugLevel, slog.LevelDebug, log.DebugLevel},
+		{log.PrintLevel, slog.LevelInfo, log.InfoLevel},
+		{log.InfoLevel, slog.LevelInfo, log.InfoLevel},
+		{log.WarnLevel, slog.LevelWarn, log.WarnLevel},
+		{log.ErrorLevel, slog.LevelError, log.ErrorLevel},
+		{log.PanicLevel, slog.LevelError + 4, log.PanicLevel},
+		{log.FatalLevel, slog.LevelError + 8, log.FatalLevel},
+	} {
+		got := log.LevelToSlogLevel(tc.level)
+		if got != tc.slog {
+			t.Errorf("LevelToSlogLevel(%s) = %s, want %s", tc.level, got, tc.slog)
+		}
+		if back := log.SlogLevelToLevel(got); back != tc.back {
+			t.Errorf("SlogLevelToLevel(%s) = %s, want %s", got, back, tc.back)
+		}
+	}
+	// The levels in between go to the nearest glog level below.
+	if got := log.SlogLevelToLevel(slog.LevelError + 6); got != log.PanicLevel {
+		t.Errorf("SlogLevelToLevel(ERROR+6) = %s", got)
+	}
+	if got := log.SlogLevelToLevel(slog.LevelError + 12); got != log.FatalLevel {
+		t.Errorf("SlogLevelToLevel(ERROR+12) = %s", got)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+// serveSMTP accepts the mails sent to ln, without TLS nor authentication.
+func serveSMTP(ln net.Listener, received func(data string)) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			tp := textproto.NewConn(conn)
+			_ = tp.PrintfLine("220 fake ESMTP")
+			for {
+				line, err := tp.ReadLine()
+				if err != nil {
+					return
+				}
+				switch strings.ToUpper(strings.Fields(line)[0]) {
+				case "DATA":
+					_ = tp.PrintfLine("354 go on")
+					data, _ := tp.ReadDotBytes()
+					received(string(data))
+					_ = tp.PrintfLine("250 queued")
+				case "QUIT":
+					_ = tp.PrintfLine("221 bye")
+					return
+				default:
+					_ = tp.PrintfLine("250 ok")
+				}
+			}
+		}()
+	}
+}
+
+func TestSMTPHandlerThroughLogger(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	var mails []string
+	go serveSMTP(ln, func(data string) {
+		mu.Lock()
+		mails = append(mails, data)
+		mu.Unlock()
+	})
+
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "billing",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.ErrorLevel, 16).
+				SetSMTPHandlerConfig(log.NewDefaultSMTPHandlerConfig(ln.Addr().String(), "glog@example.com", "ops@example.com")),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Warn("not mailed")
+	logger.Error("invoice failed")
+	logger.Fatal("database gone")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mails) != 1 || !strings.Contains(mails[0], "Subject: [FATAL] billing: 2 log entries\n") ||
+		!strings.Contains(mails[0], "invoice failed") || strings.Contains(mails[0], "not mailed") {
+		t.Fatalf("mails = %q", mails)
+	}
+}
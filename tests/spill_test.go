@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+	"github.com/ml444/glog/message"
+)
+
+type recordingHandler struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	msgs    []string
+}
+
+func (h *recordingHandler) Emit(e *message.Entry) error {
+	h.once.Do(func() {
+		close(h.started)
+	})
+	<-h.release
+	h.mu.Lock()
+	h.msgs = append(h.msgs, e.Message)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordingHandler) Close() error { return nil }
+
+func TestWorkerBackpressureSpillReplaysInOrder(t *testing.T) {
+	h := &recordingHandler{started: make(chan struct{}), release: make(chan struct{})}
+	logger, err := log.NewLogger(&log.Config{
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 1).
+				SetBackpressure(log.NewBackpressureConfig(log.BackpressureStrategySpill).WithSpillDir(t.TempDir())).
+				SetHandler(h),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Info("m-000")
+	<-h.started
+	for i := 1; i < 100; i++ {
+		logger.Infof("m-%03d", i)
+	}
+	queue := logger.Stats().Workers[0].QueueBackpressure
+	if queue.Spilled == 0 || queue.Dropped != 0 || queue.Discarded != 0 {
+		t.Fatalf("stats under pressure: %+v", queue)
+	}
+
+	close(h.release)
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	h.mu.Lock()
+	msgs := append([]string(nil), h.msgs...)
+	h.mu.Unlock()
+	if len(msgs) != 100 {
+		t.Fatalf("handled %d entries, want 100", len(msgs))
+	}
+	for i, msg := range msgs {
+		if want := fmt.Sprintf("m-%03d", i); msg != want {
+			t.Fatalf("entry %d = %q, want %q", i, msg, want)
+		}
+	}
+	queue = logger.Stats().Workers[0].QueueBackpressure
+	if queue.Replayed != queue.Spilled {
+		t.Fatalf("replayed %d of %d spilled", queue.Replayed, queue.Spilled)
+	}
+}
+
+func TestWorkerBackpressureSpillDiscardsWhenFull(t *testing.T) {
+	h := &recordingHandler{started: make(chan struct{}), release: make(chan struct{})}
+	var errs int
+	var mu sync.Mutex
+	logger, err := log.NewLogger(&log.Config{
+		LoggerLevel: log.DebugLevel,
+		OnError: func(_ interface{}, err error) {
+			mu.Lock()
+			errs++
+			mu.Unlock()
+		},
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.PrintLevel, 1).
+				SetBackpressure(log.NewBackpressureConfig(log.BackpressureStrategySpill).
+					WithSpillDir(t.TempDir()).
+					WithSpillMaxBytes(1024)).
+				SetHandler(h),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+
+	logger.Info("block")
+	<-h.started
+	for i := 0; i < 100; i++ {
+		logger.Infof("m-%03d", i)
+	}
+	queue := logger.Stats().Workers[0].QueueBackpressure
+	if queue.Discarded == 0 || queue.Spilled == 0 {
+		t.Fatalf("stats with a full spill queue: %+v", queue)
+	}
+	mu.Lock()
+	if errs == 0 {
+		t.Fatal("OnError was not called for discarded entries")
+	}
+	mu.Unlock()
+
+	close(h.release)
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if got, want := uint64(len(h.msgs)), queue.Enqueued+queue.Spilled; got != want {
+		t.Fatalf("handled %d entries, want the %d enqueued and spilled ones", got, want)
+	}
+}
+
+func TestWorkerSpillDirInUse(t *testing.T) {
+	newLogger := func() (*log.Logger, error) {
+		return log.NewLogger(&log.Config{
+			LoggerName: fmt.Sprintf("spill-lock-%d", os.Getpid()),
+			WorkerConfigList: []*log.WorkerConfig{
+				log.NewWorkerConfig(log.InfoLevel, 1).
+					SetBackpressure(log.NewBackpressureConfig(log.BackpressureStrategySpill)).
+					SetHandler(&recordingHandler{started: make(chan struct{}), release: make(chan struct{})}),
+			},
+		})
+	}
+	first, err := newLogger()
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	// The default spill directory derives from the logger name.
+	if _, err = newLogger(); !errors.Is(err, log.ErrSpillDirInUse) {
+		t.Fatalf("second logger: err = %v", err)
+	}
+	if err = first.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := newLogger()
+	if err != nil {
+		t.Fatalf("after Stop: %v", err)
+	}
+	_ = second.Stop()
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+	"github.com/ml444/glog/filter"
+	"github.com/ml444/glog/message"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Close() error { return nil }
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []string
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+type errorHandler struct{}
+
+func (errorHandler) Emit(_ *message.Entry) error { return errors.New("unreachable") }
+func (errorHandler) Close() error                { return nil }
+
+func TestTeeBranchesThroughLogger(t *testing.T) {
+	jsonOut, textOut := &syncBuffer{}, &syncBuffer{}
+	var mu sync.Mutex
+	var reported []error
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "svc",
+		LoggerLevel: log.DebugLevel,
+		OnError: func(_ interface{}, err error) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.DebugLevel, 16).
+				AddBranch(log.NewBranchConfig("json", log.InfoLevel).
+					SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: jsonOut}).
+					SetJSONFormatterConfig(log.NewDefaultJSONFormatterConfig())).
+				AddBranch(log.NewBranchConfig("db", log.DebugLevel).
+					SetFilter(filter.FieldEquals("component", "db")).
+					SetStreamHandlerConfig(&log.StreamHandlerConfig{Streamer: textOut}).
+					SetTextFormatterConfig(&log.TextFormatterConfig{PatternStyle: "%[LevelName]s %[Message]v"})).
+				AddBranch(log.NewBranchConfig("remote", log.ErrorLevel).
+					SetHandler(errorHandler{})),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer func() { _ = logger.Stop() }()
+
+	logger.Debugw("query plan", "component", "db")
+	logger.Info("started")
+	logger.Errorw("query failed", "component", "db")
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	json1 := jsonOut.lines()
+	if len(json1) != 2 {
+		t.Fatalf("json branch: %q", json1)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(json1[1]), &rec); err != nil || rec["msg"] != "query failed" {
+		t.Fatalf("json record %q: %v", json1[1], err)
+	}
+	text := textOut.lines()
+	if len(text) != 2 || !strings.Contains(text[0], "query plan") || !strings.Contains(text[1], "query failed") {
+		t.Fatalf("db branch: %q", text)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "branch remote: unreachable") {
+		t.Fatalf("reported = %v", reported)
+	}
+	branches := logger.Stats().Workers[0].Branches
+	if len(branches) != 3 || branches[2].Name != "remote" || branches[2].Failed != 1 || branches[0].Emitted != 2 {
+		t.Fatalf("branches = %+v", branches)
+	}
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/ml444/glog"
+)
+
+func TestWebhookHandlerThroughLogger(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body struct{ Text string }
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body %q: %v", data, err)
+		}
+		mu.Lock()
+		texts = append(texts, body.Text)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	logger, err := log.NewLogger(&log.Config{
+		LoggerName:  "svc",
+		LoggerLevel: log.DebugLevel,
+		WorkerConfigList: []*log.WorkerConfig{
+			log.NewWorkerConfig(log.ErrorLevel, 16).
+				SetWebhookHandlerConfig(log.NewDefaultWebhookHandlerConfig(srv.URL)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+
+	logger.Warn("not an alert")
+	for i := 0; i < 3; i++ {
+		logger.Errorw("payment failed", "provider", "acme")
+	}
+	if err := logger.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if stats := logger.Stats().Workers[0].Webhook; stats.Alerts != 1 || stats.Grouped != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	// Stop sends the summary of the open window.
+	if err := logger.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(texts) != 2 || !strings.HasPrefix(texts[0], "[ERROR] svc") || !strings.HasSuffix(texts[0], "payment failed provider=acme") ||
+		!strings.HasSuffix(texts[1], "payment failed (2 more occurrences in 1m0s)") {
+		t.Fatalf("texts = %q", texts)
+	}
+}